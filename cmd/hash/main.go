@@ -1,34 +1,253 @@
 package main
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
 	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/app/hash"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/auth"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/hashing"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/routing"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/stats"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/tracing"
+	"io"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 )
 
+// maxPort is the highest TCP port number
+const maxPort = 65535
+
 func main() {
-	if len(os.Args) < 2 {
+	config := hash.DefaultConfig()
+	flag.IntVar(&config.Router.MaxStatsEntries, "max-stats-entries", config.Router.MaxStatsEntries,
+		"maximum number of distinct route and method combinations to keep stats for")
+	flag.IntVar(&config.Router.MaxTrackedMisses, "max-tracked-misses", config.Router.MaxTrackedMisses,
+		"maximum number of distinct unmatched paths to count individually")
+	flag.StringVar(&config.Router.SnapshotDir, "stats-snapshot-dir", config.Router.SnapshotDir,
+		"directory to write stats snapshots to on demand and on shutdown, snapshots are disabled if empty")
+	snapshotFormat := flag.String("stats-snapshot-format", string(config.Router.SnapshotFormat),
+		"format of stats snapshots, either json or csv")
+	accessLogPath := flag.String("access-log", "", "file to write access log lines to, or - for stdout, access logging is disabled if empty")
+	accessLogFormat := flag.String("access-log-format", string(config.Router.AccessLogFormat), "format of access log lines, either combined or json")
+	accessLogMaxMB := flag.Int("access-log-max-mb", 100, "size in megabytes the access log file is rotated at, rotation is disabled if 0")
+	accessLogBackups := flag.Int("access-log-backups", 5, "number of rotated access log files to keep")
+	traceFile := flag.String("trace-file", "", "file to write finished spans to as OTLP JSON, one batch per line")
+	traceEndpoint := flag.String("trace-endpoint", "", "OTLP/HTTP collector URL to post finished spans to, such as http://localhost:4318/v1/traces")
+	apiKeys := flag.String("api-keys", "", "file of API key hashes and their scopes, authentication is disabled if empty")
+	flag.StringVar(&config.IDFormat, "id-format", config.IDFormat,
+		"format of the ids issued for submitted passwords, one of sequential, random, uuidv7 or ulid")
+	hashDelay := flag.String("hash-delay", config.HashDelay.String(),
+		"how long passwords wait before being hashed, as none, a duration such as 5s, or a duration and jitter such as 3s+4s")
+	flag.IntVar(&config.HashWorkers, "hash-workers", hashing.DefaultWorkers,
+		"number of passwords each tenant hashes at once, with the rest waiting in their priority lane")
+	laneWeights := flag.String("lane-weights", config.LaneWeights.String(),
+		"share of workers given to each priority lane while several have passwords waiting, as lane=weight pairs")
+	flag.DurationVar(&config.HashTTL, "hash-ttl", config.HashTTL,
+		"how long hashes are kept unless submitted with their own ttl, such as 24h, hashes are kept until deleted if 0")
+	flag.IntVar(&config.StoreShards, "store-shards", hashing.DefaultShards,
+		"number of independently locked shards each tenant's hashes are split across")
+	flag.IntVar(&config.MaxEntries, "max-entries", config.MaxEntries,
+		"number of hashes each tenant keeps in memory before evicting the least recently used, unbounded if 0")
+	flag.Int64Var(&config.MaxBytes, "max-bytes", config.MaxBytes,
+		"approximate bytes of hashes each tenant keeps in memory before evicting the least recently used, unbounded if 0")
+	flag.StringVar(&config.SpillDir, "spill-dir", config.SpillDir,
+		"directory to write evicted hashes to so they can still be retrieved, evicted hashes are dropped if empty")
+	tenants := flag.String("tenants", "", "file of tenant namespaces with their hash algorithm and quota, only the default tenant exists if empty")
+	hashAPIKey := flag.Bool("hash-api-key", false,
+		"read an API key from stdin and print its hash for use in the -api-keys file, then exit, keeping the key out of shell history and process lists")
+	flag.IntVar(&config.AdminPort, "admin-port", config.AdminPort,
+		"port to serve the shutdown, stats, routes and metrics endpoints on, if 0 they share the service port when -api-keys is set and use the next port otherwise")
+	flag.StringVar(&config.AdminAddress, "admin-address", config.AdminAddress, "address the admin port listens on")
+	flag.BoolVar(&config.ConfirmShutdown, "confirm-shutdown", config.ConfirmShutdown,
+		"require shutdown requests to be repeated with the confirmation token returned by the first")
+	logLevel := flag.String("log-level", logging.InfoLevel.String(), "minimum level of log entries to write, one of debug, info, warn or error")
+	logFormat := flag.String("log-format", string(logging.LogfmtFormat), "format of log entries, either logfmt or json")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <port>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *hashAPIKey {
+		key, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			fmt.Println(fmt.Errorf("failed to read API key: %v", err))
+			os.Exit(1)
+		}
+		key = strings.TrimRight(key, "\r\n")
+		if key == "" {
+			fmt.Println("An API key must be provided on stdin")
+			os.Exit(1)
+		}
+		fmt.Println(hashing.GetHash(key))
+		os.Exit(0)
+	}
+
+	format, err := stats.ParseExportFormat(*snapshotFormat)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	config.Router.SnapshotFormat = format
+
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	logFmt, err := logging.ParseFormat(*logFormat)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	config.Logger = logging.New(os.Stdout, level, logFmt)
+
+	config.Router.AccessLogFormat, err = routing.ParseAccessLogFormat(*accessLogFormat)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if *apiKeys != "" {
+		config.Router.Keys, err = auth.LoadKeyFile(*apiKeys)
+		if err != nil {
+			fmt.Println(fmt.Errorf("failed to load API keys: %v", err))
+			os.Exit(1)
+		}
+	}
+
+	if _, err := hashing.NewIDStrategy(config.IDFormat, config.Clock); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	config.HashDelay, err = hashing.ParseDelayPolicy(*hashDelay)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	config.LaneWeights, err = hashing.ParseLaneWeights(*laneWeights)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if config.HashWorkers < 1 {
+		fmt.Println("hash workers must be at least 1")
+		os.Exit(1)
+	}
+	if config.StoreShards < 1 {
+		fmt.Println("store shards must be at least 1")
+		os.Exit(1)
+	}
+	if config.MaxEntries < 0 || config.MaxBytes < 0 {
+		fmt.Println("max entries and max bytes must not be negative")
+		os.Exit(1)
+	}
+	if (config.MaxEntries > 0 && config.MaxEntries < config.StoreShards) ||
+		(config.MaxBytes > 0 && config.MaxBytes < int64(config.StoreShards)) {
+		fmt.Println("max entries and max bytes must be at least the number of store shards")
+		os.Exit(1)
+	}
+	if config.HashTTL < 0 {
+		fmt.Println("hash ttl must not be negative")
+		os.Exit(1)
+	}
+
+	if *tenants != "" {
+		config.Tenants, err = hashing.LoadTenantFile(*tenants)
+		if err != nil {
+			fmt.Println(fmt.Errorf("failed to load tenants: %v", err))
+			os.Exit(1)
+		}
+	}
+
+	if flag.NArg() < 1 {
 		fmt.Println("A port must provided on the command line")
 		os.Exit(1)
 	}
 
-	port := os.Args[1]
+	port := flag.Arg(0)
 	portInt, err := strconv.Atoi(port)
 	if err != nil {
 		fmt.Println(fmt.Errorf("failed to parse `%v` as a port number", port))
 		os.Exit(1)
 	}
-	hashService := hash.NewService(portInt)
+	if config.AdminPort == 0 && config.Router.Keys == nil {
+		// without keys nothing protects the admin endpoints, so they are kept off the service port
+		config.AdminPort = portInt + 1
+	}
+	if config.AdminPort == portInt {
+		fmt.Println("The admin port must differ from the service port")
+		os.Exit(1)
+	}
+	if config.AdminPort > maxPort {
+		fmt.Println(fmt.Errorf("admin port %v is beyond the highest port %v, set -admin-port explicitly", config.AdminPort, maxPort))
+		os.Exit(1)
+	}
+
+	// files are opened once everything else is validated, and closed explicitly on any later exit as os.Exit skips
+	// deferred calls
+	var opened []io.Closer
+	if *accessLogPath == "-" {
+		config.Router.AccessLog = os.Stdout
+	} else if *accessLogPath != "" {
+		accessLog, err := logging.OpenRotatingFile(*accessLogPath, int64(*accessLogMaxMB)*1024*1024, *accessLogBackups)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer accessLog.Close()
+		opened = append(opened, accessLog)
+		config.Router.AccessLog = accessLog
+	}
+
+	var exporter tracing.Exporter
+	if *traceEndpoint != "" {
+		exporter = tracing.NewHTTPExporter(*traceEndpoint)
+	} else if *traceFile != "" {
+		file, err := os.OpenFile(*traceFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Println(err)
+			exit(1, opened)
+		}
+		defer file.Close()
+		opened = append(opened, file)
+		exporter = tracing.NewWriterExporter(file)
+	}
+	if exporter != nil {
+		config.Tracer = tracing.NewTracer("hash", exporter, config.Logger.With(logging.String("component", "tracing")))
+		defer config.Tracer.Shutdown()
+	}
 
-	ctrlC := make(chan os.Signal)
+	hashService, err := hash.NewServiceWithConfig(portInt, config)
+	if err != nil {
+		fmt.Println(err)
+		exit(1, opened)
+	}
+
+	ctrlC := make(chan os.Signal, 1)
 	signal.Notify(ctrlC, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-ctrlC
-		fmt.Println("Interrupt caught, requesting shutdown")
+		config.Logger.Info("interrupt caught, requesting shutdown")
 		hashService.Stop()
 	}()
-	hashService.Start()
-}
\ No newline at end of file
+	err = hashService.Start()
+	if err != nil {
+		fmt.Println(err)
+		exit(1, opened)
+	}
+}
+
+// exit closes the given files before exiting with code, as os.Exit doesn't run the deferred calls that would
+func exit(code int, files []io.Closer) {
+	for _, file := range files {
+		file.Close()
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,82 @@
+package hash
+
+import (
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/clock"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/hashing"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/routing"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/tracing"
+	"time"
+)
+
+// Config holds the tunable settings of the hashing service
+type Config struct {
+	Router routing.Config
+
+	// AdminPort is the port the admin endpoints (stats, routes, metrics and shutdown) listen on. They are served
+	// alongside the hash endpoints when zero, as long as API keys are configured
+	AdminPort int
+	// AdminAddress is the host name or IP address the admin port listens on. Without API keys the admin endpoints are
+	// only served on a separate admin port bound to a loopback address, as nothing else would keep them from anyone
+	AdminAddress string
+	// ConfirmShutdown requires a shutdown request to be repeated with the single use token returned by the first one
+	ConfirmShutdown bool
+	// ConfirmationTTL is how long a shutdown confirmation token stays valid
+	ConfirmationTTL time.Duration
+
+	// IDFormat is the format of the IDs issued for submitted passwords, such as hashing.SequentialIDs or
+	// hashing.ULIDIDs. Requests for IDs in any other format don't match the hash retrieval routes
+	IDFormat string
+
+	// HashDelay decides how long each submitted password waits before it is hashed. The zero policy waits
+	// hashing.DefaultDelay
+	HashDelay hashing.DelayPolicy
+
+	// HashWorkers is the number of passwords each tenant hashes at once. hashing.DefaultWorkers are used when zero
+	HashWorkers int
+	// LaneWeights is the share of each tenant's workers given to each priority lane while several lanes have
+	// passwords waiting. Lanes without a weight use their default weight
+	LaneWeights hashing.LaneWeights
+
+	// HashTTL is how long hashes are kept unless a submission gives its own ttl. Hashes are kept until deleted when zero
+	HashTTL time.Duration
+
+	// StoreShards is the number of independently locked shards each tenant's hashes are split across.
+	// hashing.DefaultShards are used when zero
+	StoreShards int
+	// MaxEntries and MaxBytes bound the records each tenant holds in memory, evicting the least recently used beyond
+	// them. Memory is unbounded when both are zero
+	MaxEntries int
+	MaxBytes   int64
+	// SpillDir is the directory evicted records are written to so they can still be retrieved, with a directory per
+	// tenant inside it. Evicted records are dropped when empty
+	SpillDir string
+
+	// Tenants are the namespaces hashes can be kept in besides the default one, each with its own ID sequence,
+	// algorithm and quota. NewServiceWithConfig returns an error if they are invalid, which hashing.ReadTenants already
+	// checks
+	Tenants []hashing.Tenant
+
+	// Logger receives the service's log entries, and the router's unless the router config has its own. The default
+	// logger is used when nil
+	Logger *logging.Logger
+	// Tracer records spans across the router, hash endpoint and hash store, and the router's unless the router config
+	// has its own. Tracing is disabled when nil. The caller owns the tracer and shuts it down once the service stops
+	Tracer *tracing.Tracer
+	// Clock is what hash delays, TTLs, shutdown confirmations and request timings are measured against, and the
+	// router's unless the router config has its own. The system clock is used when nil
+	Clock clock.Clock
+}
+
+// DefaultConfig returns the Config used by NewService
+func DefaultConfig() Config {
+	return Config{
+		Router:          routing.DefaultConfig(),
+		IDFormat:        hashing.SequentialIDs,
+		HashDelay:       hashing.DefaultDelayPolicy(),
+		LaneWeights:     hashing.DefaultLaneWeights(),
+		AdminAddress:    "127.0.0.1",
+		ConfirmationTTL: DefaultConfirmationTTL,
+		Logger:          logging.Default(),
+	}
+}
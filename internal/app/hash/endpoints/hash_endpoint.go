@@ -3,22 +3,76 @@ package endpoints
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/auth"
 	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/hashing"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/requestid"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/routing"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/tracing"
 	"net/http"
-	"strconv"
+	"time"
 )
 
 const passwordField = "password"
 const idField = "id"
+const tenantField = "tenant"
+const ttlField = "ttl"
+const notBeforeField = "notBefore"
+const priorityField = "priority"
 
 // HashEndpoint is a wrapper around the hash endpoint and its interaction with the InMemoryHashStore
 type HashEndpoint struct {
 	store hashing.HashStorer
+	// tenants holds a store per tenant. Every request uses store when nil
+	tenants *hashing.Tenants
+	logger *logging.Logger
+	tracer *tracing.Tracer
 }
 
 // HashEndpointForStore returns a new instance of HashEndpoint based on the provided InMemoryHashStore
 func HashEndpointForStore(store hashing.HashStorer) *HashEndpoint {
-	return &HashEndpoint{store: store}
+	return NewHashEndpoint(store, logging.Default(), nil)
+}
+
+// NewHashEndpoint returns a new instance of HashEndpoint based on the provided InMemoryHashStore that writes its log
+// entries to the given logger and records spans with the given tracer, which may be nil
+func NewHashEndpoint(store hashing.HashStorer, logger *logging.Logger, tracer *tracing.Tracer) *HashEndpoint {
+	return &HashEndpoint{store: store, logger: logger, tracer: tracer}
+}
+
+// NewTenantHashEndpoint returns a new instance of HashEndpoint serving each tenant's hashes from its own store. The
+// tenant is taken from the request path, or else from the API key used, and the default tenant is used when neither
+// names one. Keys limited to a tenant, and any other non-admin keys, can only use their own tenant
+func NewTenantHashEndpoint(tenants *hashing.Tenants, logger *logging.Logger, tracer *tracing.Tracer) *HashEndpoint {
+	return &HashEndpoint{store: tenants.Default(), tenants: tenants, logger: logger, tracer: tracer}
+}
+
+// storeFor returns the store serving the request's tenant along with the tenant's name, writing a 404 and returning
+// false if the tenant is unknown or the caller may not use it
+func (he *HashEndpoint) storeFor(writer http.ResponseWriter, req *http.Request) (hashing.HashStorer, string, bool) {
+	if he.tenants == nil {
+		return he.store, hashing.DefaultTenant, true
+	}
+
+	tenant := routing.PathParam(req, tenantField)
+	principal, authenticated := auth.FromContext(req.Context())
+	own := principal.Tenant
+	if own == "" {
+		own = hashing.DefaultTenant
+	}
+	if tenant == "" {
+		tenant = own
+	}
+
+	store, ok := he.tenants.Store(tenant)
+	// other tenants are reported as unknown rather than forbidden so their existence isn't revealed
+	if !ok || (authenticated && tenant != own && !principal.HasScope(auth.ScopeAdmin)) {
+		routing.WriteError(writer, req, http.StatusNotFound, routing.ErrorResponse{
+			Error: fmt.Sprintf("unknown tenant '%v'", tenant),
+		})
+		return nil, tenant, false
+	}
+	return store, tenant, true
 }
 
 // HandlePost is responsible for submitting new passwords to be hashed
@@ -28,24 +82,100 @@ func (he *HashEndpoint) HandlePost(writer http.ResponseWriter, req *http.Request
 		return
 	}
 
+	ctx, span := he.tracer.Start(req.Context(), "HashEndpoint.HandlePost")
+	defer span.End()
+	logger := he.logger.With(requestid.Field(ctx))
 	err := req.ParseForm()
 	if err != nil {
-		fmt.Println(err)
-		writer.WriteHeader(http.StatusBadRequest)
-		writer.Write([]byte("unable to parse form data"))
+		logger.Warn("unable to parse hash submission", logging.Err(err))
+		routing.WriteError(writer, req, http.StatusBadRequest, routing.ErrorResponse{
+			Error: "unable to parse form data",
+		})
 		return
 	}
 
-	userPassword := req.Form.Get(passwordField)
+	store, tenant, ok := he.storeFor(writer, req)
+	if !ok {
+		return
+	}
+	span.SetAttributes(tracing.String("hash.tenant", tenant))
+	logger = logger.With(logging.String("tenant", tenant))
+
+	// the password is only ever held as a Secret here so it can't end up in a log entry
+	userPassword := logging.Secret(req.Form.Get(passwordField))
 	if userPassword == "" {
-		writer.WriteHeader(http.StatusBadRequest)
-		writer.Write([]byte(fmt.Sprintf("must provide '%v' field", passwordField)))
+		routing.WriteError(writer, req, http.StatusBadRequest, routing.ErrorResponse{
+			Error: fmt.Sprintf("must provide '%v' field", passwordField),
+		})
 		return
 	}
 
-	submitResp := he.store.SubmitPassword(userPassword)
+	options := hashing.SubmitOptions{}
+	if ttl := req.Form.Get(ttlField); ttl != "" {
+		options.TTL, err = time.ParseDuration(ttl)
+		if err != nil || options.TTL <= 0 {
+			routing.WriteError(writer, req, http.StatusBadRequest, routing.ErrorResponse{
+				Error: fmt.Sprintf("'%v' must be a positive duration such as 90s or 24h, got '%v'", ttlField, ttl),
+			})
+			return
+		}
+	}
+
+	if notBefore := req.Form.Get(notBeforeField); notBefore != "" {
+		options.NotBefore, err = time.Parse(time.RFC3339, notBefore)
+		if err != nil {
+			routing.WriteError(writer, req, http.StatusBadRequest, routing.ErrorResponse{
+				Error: fmt.Sprintf("'%v' must be an RFC 3339 timestamp such as 2020-01-02T15:04:05Z, got '%v'",
+					notBeforeField, notBefore),
+			})
+			return
+		}
+	}
+
+	options.Priority = hashing.Priority(req.Form.Get(priorityField))
+	span.SetAttributes(tracing.String("hash.priority", string(options.Priority)))
+
+	if principal, ok := auth.FromContext(ctx); ok {
+		// interactive passwords jump ahead of everyone else's, so only keys trusted not to flood the lane may use it
+		if options.Priority == hashing.PriorityInteractive && !principal.HasScope(auth.ScopeHashInteractive) {
+			routing.WriteError(writer, req, http.StatusForbidden, routing.ErrorResponse{
+				Error: fmt.Sprintf("API key for '%v' lacks the '%v' scope needed for %v priority",
+					principal.Name, auth.ScopeHashInteractive, hashing.PriorityInteractive),
+			})
+			return
+		}
+		ctx = hashing.NewOwnerContext(ctx, principal.Name)
+	}
+	submitResp, err := store.SubmitPasswordWithOptions(ctx, userPassword.Reveal(), options)
+	if err == hashing.ErrQuotaExceeded {
+		logger.Warn("hash quota exceeded")
+		routing.WriteError(writer, req, http.StatusTooManyRequests, routing.ErrorResponse{
+			Error: fmt.Sprintf("hash quota for tenant '%v' exceeded", tenant),
+		})
+		return
+	} else if err == hashing.ErrScheduleTooFar {
+		routing.WriteError(writer, req, http.StatusBadRequest, routing.ErrorResponse{
+			Error: fmt.Sprintf("'%v' is too far in the future", notBeforeField),
+		})
+		return
+	} else if err == hashing.ErrUnknownPriority {
+		routing.WriteError(writer, req, http.StatusBadRequest, routing.ErrorResponse{
+			Error: fmt.Sprintf("'%v' must be one of %v, %v or %v, got '%v'", priorityField,
+				hashing.PriorityInteractive, hashing.PriorityNormal, hashing.PriorityBulk, options.Priority),
+		})
+		return
+	} else if err != nil {
+		logger.Error("failed to submit password", logging.Err(err))
+		routing.WriteError(writer, req, http.StatusInternalServerError, routing.ErrorResponse{
+			Error: "failed to submit password",
+		})
+		return
+	}
+	span.SetAttributes(tracing.String("hash.id", string(submitResp.ID)))
+	logger.Debug("password submitted for hashing", logging.String("id", string(submitResp.ID)))
 	bytes, err := json.Marshal(submitResp)
 	if err != nil {
+		logger.Error("failed to marshal submit response", logging.Err(err))
 		writer.WriteHeader(http.StatusInternalServerError)
 		writer.Write([]byte("failed to marshal response"))
 		return
@@ -56,6 +186,13 @@ func (he *HashEndpoint) HandlePost(writer http.ResponseWriter, req *http.Request
 
 }
 
+// canRead returns true if the caller may see the given record. Without authentication every record can be read,
+// otherwise only the key that submitted it, or an admin, can read it
+func canRead(req *http.Request, record hashing.HashRecord) bool {
+	principal, authenticated := auth.FromContext(req.Context())
+	return !authenticated || principal.HasScope(auth.ScopeAdmin) || principal.Name == record.Owner
+}
+
 // HandleGet is responsible for getting hashes out of the store
 func (he *HashEndpoint) HandleGet(writer http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodGet {
@@ -63,32 +200,51 @@ func (he *HashEndpoint) HandleGet(writer http.ResponseWriter, req *http.Request)
 		return
 	}
 
+	_, span := he.tracer.Start(req.Context(), "HashEndpoint.HandleGet")
+	defer span.End()
+	logger := he.logger.With(requestid.Field(req.Context()))
 	err := req.ParseForm()
 	if err != nil {
-		fmt.Println(err)
-		writer.WriteHeader(http.StatusBadRequest)
-		writer.Write([]byte("unable to parse form data"))
+		logger.Warn("unable to parse hash request", logging.Err(err))
+		routing.WriteError(writer, req, http.StatusBadRequest, routing.ErrorResponse{
+			Error: "unable to parse form data",
+		})
 		return
 	}
 
-	idParam := req.Form.Get(idField)
-	id, err := strconv.Atoi(idParam)
-	if err != nil {
-		fmt.Println(err)
-		writer.WriteHeader(http.StatusBadRequest)
-		writer.Write([]byte(fmt.Sprintf("provided id '%v' is not a valid integer", idParam)))
+	store, tenant, ok := he.storeFor(writer, req)
+	if !ok {
 		return
 	}
+	span.SetAttributes(tracing.String("hash.tenant", tenant))
 
-	getResp := he.store.GetHash(int64(id))
-	if getResp.Hash == "" {
-		writer.WriteHeader(http.StatusNotFound)
-		writer.Write([]byte(fmt.Sprintf("no hash for id '%v' available", id)))
+	id, ok := requestedID(writer, req, store, logger)
+	if !ok {
+		return
+	}
+	span.SetAttributes(tracing.String("hash.id", string(id)))
+	record, ok := store.GetRecord(id)
+	// hashes owned by someone else are reported as missing rather than forbidden so their existence isn't revealed
+	if !ok || !canRead(req, record) {
+		routing.WriteError(writer, req, http.StatusNotFound, routing.ErrorResponse{
+			Error: fmt.Sprintf("no hash for id '%v' available", id),
+		})
 		return
 	}
+	if record.Status == hashing.StatusExpired {
+		routing.WriteError(writer, req, http.StatusGone, routing.ErrorResponse{
+			Error: fmt.Sprintf("hash for id '%v' has expired", id),
+		})
+		return
+	}
+	getResp := hashing.GetResponse{ID: id, Hash: record.Hash}
+	if !record.Expires.IsZero() {
+		getResp.ExpiresAt = &record.Expires
+	}
 
 	bytes, err := json.Marshal(getResp)
 	if err != nil {
+		logger.Error("failed to marshal hash response", logging.Err(err))
 		writer.WriteHeader(http.StatusInternalServerError)
 		writer.Write([]byte("failed to marshal response"))
 		return
@@ -96,4 +252,76 @@ func (he *HashEndpoint) HandleGet(writer http.ResponseWriter, req *http.Request)
 
 	writer.WriteHeader(http.StatusOK)
 	writer.Write(bytes)
-}
\ No newline at end of file
+}
+
+// HandleDelete is responsible for removing hashes from the store before they would otherwise expire, cancelling any
+// password still waiting to be hashed
+func (he *HashEndpoint) HandleDelete(writer http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodDelete {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	_, span := he.tracer.Start(req.Context(), "HashEndpoint.HandleDelete")
+	defer span.End()
+	logger := he.logger.With(requestid.Field(req.Context()))
+	err := req.ParseForm()
+	if err != nil {
+		logger.Warn("unable to parse hash deletion", logging.Err(err))
+		routing.WriteError(writer, req, http.StatusBadRequest, routing.ErrorResponse{
+			Error: "unable to parse form data",
+		})
+		return
+	}
+
+	store, tenant, ok := he.storeFor(writer, req)
+	if !ok {
+		return
+	}
+	span.SetAttributes(tracing.String("hash.tenant", tenant))
+
+	id, ok := requestedID(writer, req, store, logger)
+	if !ok {
+		return
+	}
+	span.SetAttributes(tracing.String("hash.id", string(id)))
+	record, ok := store.GetRecord(id)
+	if !ok {
+		// a password still waiting to be hashed is cancelled, so its hash doesn't appear after the delete
+		record.Owner, ok = store.PendingOwner(id)
+	}
+	if !ok || !canRead(req, record) || !store.DeleteHash(id) {
+		routing.WriteError(writer, req, http.StatusNotFound, routing.ErrorResponse{
+			Error: fmt.Sprintf("no hash for id '%v' available", id),
+		})
+		return
+	}
+	logger.Debug("hash deleted", logging.String("tenant", tenant), logging.String("id", string(id)))
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// HandleRecord serves both retrieval and deletion of a single hash, for routes registered for both methods
+func (he *HashEndpoint) HandleRecord(writer http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodDelete {
+		he.HandleDelete(writer, req)
+		return
+	}
+	he.HandleGet(writer, req)
+}
+
+// requestedID returns the hash ID from the request path, writing a 400 and returning false if it isn't in the format
+// the store issues
+func requestedID(writer http.ResponseWriter, req *http.Request, store hashing.HashStorer, logger *logging.Logger) (hashing.ID, bool) {
+	idParam := routing.PathParam(req, idField)
+	ids := store.IDs()
+	if !ids.Valid(idParam) {
+		logger.Debug("invalid hash id requested", logging.String("id", idParam))
+		message := fmt.Sprintf("provided id '%v' is not a valid %v id", idParam, ids.Name())
+		if ids.Name() == hashing.SequentialIDs {
+			message = fmt.Sprintf("provided id '%v' is not a valid integer", idParam)
+		}
+		routing.WriteError(writer, req, http.StatusBadRequest, routing.ErrorResponse{Error: message})
+		return "", false
+	}
+	return hashing.ID(idParam), true
+}
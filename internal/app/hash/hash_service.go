@@ -1,19 +1,36 @@
 package hash
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/app/hash/endpoints"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/auth"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/clock"
 	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/hashing"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/metrics"
 	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/routing"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/tracing"
+	"net"
 	"net/http"
+	"sync"
 )
 
 // Service ties the router and the hash store together
 type Service struct {
 	router *routing.Router
-	hashStore *hashing.InMemoryHashStore
+	// adminRouter serves the admin endpoints on their own port. They share router when nil
+	adminRouter *routing.Router
+	// adminEnabled is false when the admin endpoints would be open to anyone who can reach them, so they aren't served
+	adminEnabled bool
+	shutdownGuard *shutdownGuard
+	tenants *hashing.Tenants
+	// ids validates the IDs in request paths, matching the format every tenant's store issues
+	ids hashing.IDStrategy
+	metrics *metrics.Registry
+	logger *logging.Logger
+	tracer *tracing.Tracer
 	done chan struct{}
+	stopOnce sync.Once
 }
 
 // SimpleMessage is an object with a message
@@ -23,53 +40,216 @@ type SimpleMessage struct {
 
 // NewService returns a new instance of the hashing service
 func NewService(port int) *Service {
-	return &Service{
-		router:    routing.NewRouter(port),
-		hashStore: hashing.NewInMemoryHashStore(),
+	service, _ := NewServiceWithConfig(port, DefaultConfig())
+	return service
+}
+
+// NewServiceWithConfig returns a new instance of the hashing service using the provided settings. An unknown ID format
+// or invalid tenants are an error
+func NewServiceWithConfig(port int, config Config) (*Service, error) {
+	logger := config.Logger
+	if logger == nil {
+		logger = logging.Default()
+	}
+	serviceClock := config.Clock
+	if serviceClock == nil {
+		serviceClock = clock.System
+	}
+	if config.Router.Clock == nil {
+		config.Router.Clock = serviceClock
+	}
+	if config.Router.Tracer == nil {
+		config.Router.Tracer = config.Tracer
+	}
+	if config.Router.Logger == nil {
+		config.Router.Logger = logger.With(logging.String("component", "router"))
+	}
+	ids, err := hashing.NewIDStrategy(config.IDFormat, serviceClock)
+	if err != nil {
+		return nil, err
+	}
+	tenants, err := hashing.NewTenants(hashing.Config{
+		IDFormat:    config.IDFormat,
+		Delay:       config.HashDelay,
+		Workers:     config.HashWorkers,
+		LaneWeights: config.LaneWeights,
+		DefaultTTL:  config.HashTTL,
+		Shards:      config.StoreShards,
+		MaxEntries:  config.MaxEntries,
+		MaxBytes:    config.MaxBytes,
+		SpillDir:    config.SpillDir,
+		Logger:      logger.With(logging.String("component", "store")),
+		Tracer:      config.Tracer,
+		Clock:       serviceClock,
+	}, config.Tenants)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create hash stores: %v", err)
+	}
+
+	service := &Service{
+		router:    routing.NewRouterWithConfig(port, config.Router),
+		tenants:   tenants,
+		ids:       ids,
+		metrics: metrics.NewRegistry(),
+		logger: logger.With(logging.String("component", "service")),
+		tracer: config.Tracer,
 		done: make(chan struct{}, 0),
 	}
+
+	if config.AdminPort > 0 {
+		adminConfig := config.Router
+		adminConfig.Address = config.AdminAddress
+		// admin stats are reported as a section of the main router's stats, so only it writes snapshots
+		adminConfig.SnapshotDir = ""
+		adminConfig.Logger = logger.With(logging.String("component", "admin"))
+		service.adminRouter = routing.NewRouterWithConfig(config.AdminPort, adminConfig)
+	}
+	service.adminEnabled = config.Router.Keys != nil || (config.AdminPort > 0 && loopback(config.AdminAddress))
+	if config.ConfirmShutdown {
+		ttl := config.ConfirmationTTL
+		if ttl <= 0 {
+			ttl = DefaultConfirmationTTL
+		}
+		service.shutdownGuard = &shutdownGuard{ttl: ttl, clock: serviceClock}
+	}
+	return service, nil
 }
 
-// Start will register all endpoints and start the HTTP server
-func (h *Service) Start() {
-	hashEndpoint := endpoints.HashEndpointForStore(h.hashStore)
-	h.router.RegisterPaths(map[string]http.HandlerFunc{
-		"/hash": hashEndpoint.HandlePost,
-		"/hash/{id}": hashEndpoint.HandleGet,
-		"/shutdown": h.shutdownHandler,
+// Start will register all endpoints and start the HTTP servers, blocking until the service is stopped. If either port
+// can't be bound nothing is served, the service is stopped and the error returned
+func (h *Service) Start() error {
+	hashEndpoint := endpoints.NewTenantHashEndpoint(h.tenants, h.logger.With(logging.String("component", "hash")), h.tracer)
+	tenantConstraint := routing.Constraint{Name: "tenant", Match: hashing.ValidTenantName}
+	idConstraints := map[string]routing.Constraint{}
+	tenantIDConstraints := map[string]routing.Constraint{"tenant": tenantConstraint}
+	// sequential IDs are left unconstrained so a malformed one gets a 400 from the endpoint, as it always has, rather
+	// than a 404 from the router
+	if h.ids.Name() != hashing.SequentialIDs {
+		idConstraint := routing.Constraint{Name: h.ids.Name(), Match: h.ids.Valid}
+		idConstraints["id"] = idConstraint
+		tenantIDConstraints["id"] = idConstraint
+	}
+	// deleting a hash changes the store, so it needs the same scope as submitting one
+	deleteScopes := map[string]auth.Scope{http.MethodDelete: auth.ScopeHashWrite}
+	h.router.RegisterRoutes([]routing.Route{
+		{Path: "/hash", Methods: []string{http.MethodPost}, Handler: hashEndpoint.HandlePost, Scope: auth.ScopeHashWrite},
+		{Path: "/hash/{id}", Methods: []string{http.MethodGet, http.MethodDelete}, Handler: hashEndpoint.HandleRecord,
+			Scope: auth.ScopeHashRead, MethodScopes: deleteScopes, Constraints: idConstraints},
+		{Path: "/tenants/{tenant}/hash", Methods: []string{http.MethodPost}, Handler: hashEndpoint.HandlePost, Scope: auth.ScopeHashWrite,
+			Constraints: map[string]routing.Constraint{"tenant": tenantConstraint}},
+		{Path: "/tenants/{tenant}/hash/{id}", Methods: []string{http.MethodGet, http.MethodDelete}, Handler: hashEndpoint.HandleRecord,
+			Scope: auth.ScopeHashRead, MethodScopes: deleteScopes, Constraints: tenantIDConstraints},
 	})
-	h.router.RegisterStatsEndpoint()
+	for _, name := range h.tenants.Names() {
+		store, _ := h.tenants.Store(name)
+		h.router.AddStatsSection(tenantStatsSection(name), store.Stats())
+		h.router.AddStatsGauges(tenantStatsSection(name), queueGauges(store))
+	}
+
+	h.metrics.Register(h.router)
+	h.metrics.Register(storeCollector(h.tenants))
+
+	admin := h.router
+	if h.adminRouter != nil {
+		admin = h.adminRouter
+		h.router.AddStatsSection("admin", h.adminRouter.Stats())
+	}
+	if h.adminEnabled {
+		admin.RegisterRoutes([]routing.Route{
+			{Path: "/shutdown", Methods: []string{http.MethodPost}, Handler: h.shutdownHandler, Scope: auth.ScopeAdmin},
+		})
+		admin.RegisterRoutes(h.router.StatsEndpoints())
+		admin.RegisterRoutes(h.router.RoutesEndpoints())
+		admin.RegisterRoutes(h.router.MetricsEndpoints(h.metrics))
+	} else {
+		h.logger.Warn("admin endpoints disabled as nothing would protect them, configure API keys or an admin port on a loopback address")
+	}
+
+	// both ports are bound before either is served, so a port that is already taken fails startup rather than leaving
+	// the service running without its admin endpoints
+	err := h.router.Listen()
+	if err == nil && h.adminRouter != nil {
+		err = h.adminRouter.Listen()
+	}
+	if err != nil {
+		h.logger.Error("unable to listen", logging.Err(err))
+		h.stopOnce.Do(h.abort)
+		return err
+	}
+
+	if h.adminRouter != nil {
+		go h.adminRouter.Serve()
+	}
 	h.router.Serve()
 	<-h.done
+	return nil
 }
 
-func (h *Service) shutdownHandler(writer http.ResponseWriter, req *http.Request) {
-	resp := SimpleMessage{Message: "server shutting down"}
-	bytes, err := json.Marshal(resp)
-	if err != nil {
-		writer.WriteHeader(http.StatusInternalServerError)
-		writer.Write([]byte("failed to generate server shutdown message"))
-		return
+// loopback returns true if address only accepts connections from the local machine
+func loopback(address string) bool {
+	if address == "localhost" {
+		return true
 	}
+	ip := net.ParseIP(address)
+	return ip != nil && ip.IsLoopback()
+}
 
-	writer.WriteHeader(http.StatusOK)
-	writer.Write(bytes)
-
-	// call this in a goroutine so this request can return correctly
-	go h.Stop()
+// tenantStatsSection returns the name of the stats section holding a tenant's store timings. The default tenant keeps
+// the plain "hashing" section it had before there were tenants
+func tenantStatsSection(tenant string) string {
+	if tenant == hashing.DefaultTenant {
+		return "hashing"
+	}
+	return "hashing " + tenant
 }
 
-// Stop shuts down the HTTP server gracefully and waits for all pending password hashes to finish
+// Stop shuts down the HTTP servers gracefully and waits for all pending password hashes to finish, except those
+// scheduled with notBefore to start beyond the hash delay, which are dropped. Only the first call has any effect
 func (h *Service) Stop() {
-	fmt.Println("Hash Service shutting down")
+	h.stopOnce.Do(h.stop)
+}
+
+// Flush blocks until every password submitted so far has been hashed. With a fake clock, the clock must be advanced
+// past the hash delay for it to return
+func (h *Service) Flush() {
+	h.tenants.Flush()
+}
+
+// abort stops hashing for a service that never started serving, so has no servers to shut down
+func (h *Service) abort() {
+	h.router.CloseListener()
+	if h.adminRouter != nil {
+		h.adminRouter.CloseListener()
+	}
+	h.tenants.Close()
+	h.tenants.Flush()
+}
+
+func (h *Service) stop() {
+	h.logger.Info("hash service shutting down")
 	err := h.router.Shutdown()
 	if err != nil {
-		fmt.Println("error while shutting down router: ", err)
+		h.logger.Error("error while shutting down router", logging.Err(err))
+	}
+	if h.adminRouter != nil {
+		err = h.adminRouter.Shutdown()
+		if err != nil {
+			h.logger.Error("error while shutting down admin router", logging.Err(err))
+		}
+	}
+	h.logger.Info("http server shutdown")
+
+	path, err := h.router.WriteStatsSnapshot()
+	if err == nil {
+		h.logger.Info("stats snapshot written", logging.String("path", path))
+	} else if err != routing.ErrSnapshotsDisabled {
+		h.logger.Error("error while writing stats snapshot", logging.Err(err))
 	}
-	fmt.Println("HTTP Server shutdown")
 
-	h.hashStore.Flush()
-	fmt.Println("All hash processing finished")
+	// closing first drops jobs scheduled far in the future, which would otherwise hold up the flush until they are due
+	h.tenants.Close()
+	h.tenants.Flush()
+	h.logger.Info("all hash processing finished")
 
 	h.done<-struct{}{}
 }
\ No newline at end of file
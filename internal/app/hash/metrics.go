@@ -0,0 +1,90 @@
+package hash
+
+import (
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/hashing"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/metrics"
+)
+
+// storeCollector reports every tenant's store metrics in a form the metrics registry understands, with each sample
+// labelled by tenant
+func storeCollector(tenants *hashing.Tenants) metrics.Collector {
+	return metrics.CollectorFunc(func() []metrics.Family {
+		queueDepth := gauge("hash_queue_depth", "Password hash jobs waiting to be processed.")
+		laneDepth := gauge("hash_lane_queue_depth", "Password hash jobs past their delay waiting for a worker in each priority lane.")
+		inFlight := gauge("hash_jobs_in_flight", "Password hash jobs currently being computed.")
+		size := gauge("hash_store_size", "Hashes available for retrieval.")
+		expired := gauge("hash_records_expired", "Expired hashes still reported as expired rather than unknown.")
+		spilled := gauge("hash_records_spilled", "Hashes evicted from memory to disk.")
+		hits := counter("hash_cache_hits_total", "Hash retrievals served from memory.")
+		spillHits := counter("hash_cache_spill_hits_total", "Hash retrievals served from disk.")
+		misses := counter("hash_cache_misses_total", "Hash retrievals of unknown IDs.")
+		evictions := counter("hash_cache_evictions_total", "Hashes evicted from memory, whether spilled to disk or dropped.")
+		hashDuration := histogram("hash_computation_duration_seconds", "Time taken to compute each password hash.")
+		queueWait := histogram("hash_queue_wait_seconds", "Time password hash jobs waited before being computed.")
+		lockWait := histogram("hash_store_lock_wait_seconds", "Time spent waiting for the hash store lock.")
+
+		for _, name := range tenants.Names() {
+			store, _ := tenants.Store(name)
+			storeMetrics := store.Metrics()
+			labels := []metrics.Label{{Name: "tenant", Value: name}}
+			queueDepth.Samples = append(queueDepth.Samples, metrics.Sample{Labels: labels, Value: float64(storeMetrics.QueueDepth)})
+			for _, priority := range hashing.Priorities {
+				laneLabels := []metrics.Label{{Name: "tenant", Value: name}, {Name: "lane", Value: string(priority)}}
+				laneDepth.Samples = append(laneDepth.Samples,
+					metrics.Sample{Labels: laneLabels, Value: float64(storeMetrics.LaneDepth[priority])})
+			}
+			inFlight.Samples = append(inFlight.Samples, metrics.Sample{Labels: labels, Value: float64(storeMetrics.InFlight)})
+			size.Samples = append(size.Samples, metrics.Sample{Labels: labels, Value: float64(storeMetrics.Size)})
+			expired.Samples = append(expired.Samples, metrics.Sample{Labels: labels, Value: float64(storeMetrics.Expired)})
+			spilled.Samples = append(spilled.Samples, metrics.Sample{Labels: labels, Value: float64(storeMetrics.Spilled)})
+			hits.Samples = append(hits.Samples, metrics.Sample{Labels: labels, Value: float64(storeMetrics.Hits)})
+			spillHits.Samples = append(spillHits.Samples, metrics.Sample{Labels: labels, Value: float64(storeMetrics.SpillHits)})
+			misses.Samples = append(misses.Samples, metrics.Sample{Labels: labels, Value: float64(storeMetrics.Misses)})
+			evictions.Samples = append(evictions.Samples, metrics.Sample{Labels: labels, Value: float64(storeMetrics.Evictions)})
+			hashDuration.Samples = append(hashDuration.Samples,
+				metrics.HistogramSamples(labels, storeMetrics.HashDuration, metrics.DefaultBuckets)...)
+			queueWait.Samples = append(queueWait.Samples,
+				metrics.HistogramSamples(labels, storeMetrics.QueueWait, metrics.DefaultBuckets)...)
+			lockWait.Samples = append(lockWait.Samples,
+				metrics.HistogramSamples(labels, storeMetrics.LockWait, metrics.DefaultBuckets)...)
+		}
+		return []metrics.Family{queueDepth, laneDepth, inFlight, size, expired, spilled, hits, spillHits, misses, evictions,
+			hashDuration, queueWait, lockWait}
+	})
+}
+
+// queueGauges reports a store's queue in the stats endpoint, with the depth of each lane named after its priority
+func queueGauges(store *hashing.InMemoryHashStore) func() map[string]int64 {
+	return func() map[string]int64 {
+		storeMetrics := store.Metrics()
+		gauges := map[string]int64{"queueDepth": storeMetrics.QueueDepth, "inFlight": storeMetrics.InFlight}
+		for _, priority := range hashing.Priorities {
+			gauges["laneDepth "+string(priority)] = storeMetrics.LaneDepth[priority]
+		}
+		return gauges
+	}
+}
+
+func counter(name string, help string) metrics.Family {
+	return metrics.Family{
+		Name: name,
+		Help: help,
+		Type: metrics.Counter,
+	}
+}
+
+func gauge(name string, help string) metrics.Family {
+	return metrics.Family{
+		Name: name,
+		Help: help,
+		Type: metrics.Gauge,
+	}
+}
+
+func histogram(name string, help string) metrics.Family {
+	return metrics.Family{
+		Name: name,
+		Help: help,
+		Type: metrics.Histogram,
+	}
+}
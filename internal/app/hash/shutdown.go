@@ -0,0 +1,121 @@
+package hash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/clock"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/requestid"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/routing"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// ConfirmationTokenHeader is the header a shutdown confirmation token may be sent in
+	ConfirmationTokenHeader = "X-Confirmation-Token"
+	// ConfirmationTokenField is the form field a shutdown confirmation token may be sent in
+	ConfirmationTokenField = "token"
+	// DefaultConfirmationTTL is how long a shutdown confirmation token stays valid unless configured otherwise
+	DefaultConfirmationTTL = 30 * time.Second
+)
+
+// ConfirmationResponse is returned by a shutdown request that must be confirmed before the service stops
+type ConfirmationResponse struct {
+	ConfirmationToken string `json:"confirmationToken"`
+	ExpiresInSeconds  int    `json:"expiresInSeconds"`
+}
+
+// shutdownGuard hands out single use tokens that confirm a shutdown request
+type shutdownGuard struct {
+	ttl     time.Duration
+	clock   clock.Clock
+	token   string
+	expires time.Time
+	lock    sync.Mutex
+}
+
+// issue replaces any outstanding token with a new one
+func (g *shutdownGuard) issue() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.token = hex.EncodeToString(raw)
+	g.expires = g.clock.Now().Add(g.ttl)
+	return g.token, nil
+}
+
+// consume reports whether the token is the outstanding, unexpired one. A matching token can't be used again
+func (g *shutdownGuard) consume(token string) bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.token == "" || g.clock.Now().After(g.expires) {
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(g.token)) != 1 {
+		return false
+	}
+	g.token = ""
+	return true
+}
+
+func (h *Service) shutdownHandler(writer http.ResponseWriter, req *http.Request) {
+	if h.shutdownGuard != nil {
+		token := req.Header.Get(ConfirmationTokenHeader)
+		if token == "" {
+			token = req.FormValue(ConfirmationTokenField)
+		}
+		if token == "" {
+			h.requestConfirmation(writer, req)
+			return
+		}
+		if !h.shutdownGuard.consume(token) {
+			routing.WriteError(writer, req, http.StatusBadRequest, routing.ErrorResponse{Error: "invalid or expired confirmation token"})
+			return
+		}
+	}
+
+	resp := SimpleMessage{Message: "server shutting down"}
+	bytes, err := json.Marshal(resp)
+	if err != nil {
+		h.logger.Error("failed to marshal shutdown message", logging.Err(err))
+		writer.WriteHeader(http.StatusInternalServerError)
+		writer.Write([]byte("failed to generate server shutdown message"))
+		return
+	}
+
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(bytes)
+
+	// call this in a goroutine so this request can return correctly
+	go h.Stop()
+}
+
+func (h *Service) requestConfirmation(writer http.ResponseWriter, req *http.Request) {
+	token, err := h.shutdownGuard.issue()
+	if err != nil {
+		h.logger.Error("failed to generate shutdown confirmation token", logging.Err(err), requestid.Field(req.Context()))
+		routing.WriteError(writer, req, http.StatusInternalServerError, routing.ErrorResponse{Error: "failed to generate confirmation token"})
+		return
+	}
+
+	bytes, err := json.Marshal(ConfirmationResponse{
+		ConfirmationToken: token,
+		ExpiresInSeconds:  int(h.shutdownGuard.ttl / time.Second),
+	})
+	if err != nil {
+		h.logger.Error("failed to marshal shutdown confirmation", logging.Err(err), requestid.Field(req.Context()))
+		routing.WriteError(writer, req, http.StatusInternalServerError, routing.ErrorResponse{Error: "failed to generate confirmation token"})
+		return
+	}
+
+	writer.WriteHeader(http.StatusAccepted)
+	writer.Write(bytes)
+}
@@ -4,11 +4,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/app/hash"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/auth"
 	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/hashing"
 	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/routing"
 	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/test"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -16,6 +22,9 @@ import (
 
 const input = `password`
 
+// epoch is the time fake clocks start at
+var epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
 // raw hash: "b109f3bbbc244eb82441917ed06d618b9008dd09b3befd1b5e07394c706a8bb980b1d7785e5976ec049b46df5f1326af5a2ea6d103fd07c95385ffab0cacbc86"
 const knownSHA512HashBase64 = "YjEwOWYzYmJiYzI0NGViODI0NDE5MTdlZDA2ZDYxOGI5MDA4ZGQwOWIzYmVmZDFiNWUwNzM5NGM3MDZhOGJiOTgwYjFkNzc4NWU1OTc2ZWMwNDliNDZkZjVmMTMyNmFmNWEyZWE2ZDEwM2ZkMDdjOTUzODVmZmFiMGNhY2JjODY="
 
@@ -23,8 +32,13 @@ const knownSHA512HashBase64 = "YjEwOWYzYmJiYzI0NGViODI0NDE5MTdlZDA2ZDYxOGI5MDA4Z
 func TestHashService(t *testing.T) {
 	t.Run("hash endpoint supports PUT", func(t *testing.T) {
 		port := 50123
-		service := hash.NewService(port)
+		config := hash.DefaultConfig()
+		clock := test.NewFakeClock(epoch)
+		config.Clock = clock
+		service, err := hash.NewServiceWithConfig(port, config)
+		test.AssertNil(t, err, "service created")
 		go service.Start()
+		test.WaitForServer(t, port)
 
 		expectedID := 1
 		resp, err := postPassword(input, port)
@@ -36,13 +50,19 @@ func TestHashService(t *testing.T) {
 		test.AssertNil(t, err, "HTTP error should be null")
 		assertPostResponse(t, resp, expectedID)
 
+		releaseHashes(clock, 2)
 		service.Stop()
 	})
 
 	t.Run("able to retrieve hash", func(t *testing.T) {
 		port := 50124
-		service := hash.NewService(port)
+		config := hash.DefaultConfig()
+		clock := test.NewFakeClock(epoch)
+		config.Clock = clock
+		service, err := hash.NewServiceWithConfig(port, config)
+		test.AssertNil(t, err, "service created")
 		go service.Start()
+		test.WaitForServer(t, port)
 
 		expectedID := 1
 		resp, err := postPassword(input, port)
@@ -53,11 +73,12 @@ func TestHashService(t *testing.T) {
 		test.AssertNil(t, err, "HTTP error should be null")
 		test.AssertEqual(t, resp.StatusCode, 404, "immediate query should be not found")
 		bodyBytes, err := ioutil.ReadAll(resp.Body)
-		test.AssertEqual(t, string(bodyBytes), "no hash for id '1' available", "body indicates error")
+		test.AssertEqual(t, errorMessage(t, string(bodyBytes)), "no hash for id '1' available", "body indicates error")
 		resp.Body.Close()
 
-		// sleeping in tests should generally be avoided
-		time.Sleep(6 * time.Second)
+		clock.BlockUntil(1)
+		clock.Advance(hashing.DefaultDelay)
+		service.Flush()
 
 		resp, err = http.Get(fmt.Sprintf("http://localhost:%v/hash/%v", port, expectedID))
 		test.AssertNil(t, err, "HTTP error should be null")
@@ -65,15 +86,36 @@ func TestHashService(t *testing.T) {
 
 		resp.Body.Close()
 
+		resp, err = http.Get(fmt.Sprintf("http://localhost:%v/hash/abc", port))
+		test.AssertNil(t, err, "HTTP error should be null")
+		test.AssertEqual(t, resp.StatusCode, http.StatusBadRequest, "malformed id rejected")
+		bodyBytes, err = ioutil.ReadAll(resp.Body)
+		test.AssertEqual(t, errorMessage(t, string(bodyBytes)), "provided id 'abc' is not a valid integer",
+			"body explains the id is invalid")
+		resp.Body.Close()
+
 		service.Stop()
 	})
 
 	t.Run("test shutdown call", func(t *testing.T) {
 		port := 50125
-		service := hash.NewService(port)
-		go service.Start()
+		adminPort := 50141
+		service, err := hash.NewServiceWithConfig(port, withAdminPort(hash.DefaultConfig(), adminPort))
+		test.AssertNil(t, err, "service created")
+		stopped := make(chan struct{})
+		go func() {
+			service.Start()
+			close(stopped)
+		}()
+		test.WaitForServer(t, port)
+		test.WaitForServer(t, adminPort)
+
+		resp, err := http.Get(fmt.Sprintf("http://localhost:%v/shutdown", adminPort))
+		test.AssertNil(t, err, "HTTP error should be null")
+		resp.Body.Close()
+		test.AssertEqual(t, resp.StatusCode, http.StatusMethodNotAllowed, "GET doesn't shut down the service")
 
-		resp, err := http.Get(fmt.Sprintf("http://localhost:%v/shutdown", port))
+		resp, err = http.Post(fmt.Sprintf("http://localhost:%v/shutdown", adminPort), "", nil)
 		test.AssertNil(t, err, "HTTP error should be null")
 		test.AssertEqual(t, resp.StatusCode, 200, "request accepted ok")
 
@@ -88,20 +130,28 @@ func TestHashService(t *testing.T) {
 		test.AssertEqual(t, respObj, expected, "body indicates shutdown started")
 		resp.Body.Close()
 
+		<-stopped
 		resp, err = postPassword(input, port)
 		test.AssertNotNil(t, err, "HTTP should be rejected resulting in error")
 	})
 
 	t.Run("test stats call", func(t *testing.T) {
-		port := 50125
-		service := hash.NewService(port)
+		port := 50126
+		adminPort := 50142
+		config := withAdminPort(hash.DefaultConfig(), adminPort)
+		clock := test.NewFakeClock(epoch)
+		config.Clock = clock
+		service, err := hash.NewServiceWithConfig(port, config)
+		test.AssertNil(t, err, "service created")
 		go service.Start()
+		test.WaitForServer(t, port)
+		test.WaitForServer(t, adminPort)
 
 		resp, err := postPassword(input, port)
 		test.AssertNil(t, err, "HTTP error should be null")
 		test.AssertEqual(t, resp.StatusCode, 201, "201 indicating password hash created")
 
-		resp, err = http.Get(fmt.Sprintf("http://localhost:%v/stats", port))
+		resp, err = http.Get(fmt.Sprintf("http://localhost:%v/stats", adminPort))
 		test.AssertNil(t, err, "HTTP error should be null")
 		test.AssertEqual(t, resp.StatusCode, 200, "request accepted ok")
 
@@ -114,16 +164,660 @@ func TestHashService(t *testing.T) {
 		test.AssertEqual(t, len(statsResp.StatsList), 1, "expected number of endpoint stats")
 		test.AssertEqual(t, statsResp.StatsList[0].Name, "/hash POST", "properly report POST call name")
 		test.AssertEqual(t, statsResp.StatsList[0].Total, 1, "properly report POST call count")
+		test.AssertEqual(t, statsResp.StatsList[0].StatusClasses["2xx"], 1, "properly report POST status")
+		test.AssertEqual(t, statsResp.StatsList[0].ErrorRate, 0.0, "properly report POST error rate")
+
+		releaseHashes(clock, 1)
+		service.Stop()
+	})
+
+	t.Run("test routes call", func(t *testing.T) {
+		port := 50127
+		adminPort := 50143
+		service, err := hash.NewServiceWithConfig(port, withAdminPort(hash.DefaultConfig(), adminPort))
+		test.AssertNil(t, err, "service created")
+		go service.Start()
+		test.WaitForServer(t, port)
+		test.WaitForServer(t, adminPort)
+
+		resp, err := http.Get(fmt.Sprintf("http://localhost:%v/routes", adminPort))
+		test.AssertNil(t, err, "HTTP error should be null")
+		test.AssertEqual(t, resp.StatusCode, 200, "request accepted ok")
+
+		bodyBytes, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		routesResp := routing.RoutesResponse{}
+		err = json.Unmarshal(bodyBytes, &routesResp)
+		test.AssertNil(t, err, "body should be valid json")
+
+		test.AssertEqual(t, len(routesResp.Routes), 4, "all hash routes listed, the admin routes being on the admin port")
+		test.AssertEqual(t, routesResp.Routes[1].Pattern, "/hash/{id}", "parameterized hash route listed")
+		test.AssertEqual(t, routesResp.Routes[1].Methods[0], http.MethodGet, "hash retrieval is GET only")
+		test.AssertEqual(t, routesResp.Routes[1].Params[0], "id", "id parameter listed")
+
+		service.Stop()
+	})
+
+	t.Run("test metrics call", func(t *testing.T) {
+		port := 50129
+		adminPort := 50144
+		config := withAdminPort(hash.DefaultConfig(), adminPort)
+		clock := test.NewFakeClock(epoch)
+		config.Clock = clock
+		service, err := hash.NewServiceWithConfig(port, config)
+		test.AssertNil(t, err, "service created")
+		go service.Start()
+		test.WaitForServer(t, port)
+		test.WaitForServer(t, adminPort)
+
+		resp, err := postPassword(input, port)
+		test.AssertNil(t, err, "HTTP error should be null")
+		resp.Body.Close()
+
+		resp, err = http.Get(fmt.Sprintf("http://localhost:%v/metrics", adminPort))
+		test.AssertNil(t, err, "HTTP error should be null")
+		test.AssertEqual(t, resp.StatusCode, 200, "request accepted ok")
+		test.AssertEqual(t, resp.Header.Get("Content-Type"), "text/plain; version=0.0.4; charset=utf-8", "prometheus text format")
+
+		bodyBytes, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		body := string(bodyBytes)
+		test.AssertEqual(t, strings.Contains(body, `http_requests_total{route="/hash",method="POST",status="201"} 1`), true, "POST counted by status")
+		test.AssertEqual(t, strings.Contains(body, `hash_queue_depth{tenant="default"} 1`), true, "submitted password queued")
+		test.AssertEqual(t, strings.Contains(body, "# TYPE hash_computation_duration_seconds histogram"), true, "hash duration histogram present")
+
+		releaseHashes(clock, 1)
+		service.Stop()
+	})
+
+	t.Run("stats snapshot written on shutdown", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "stats")
+		test.AssertNil(t, err, "temp dir should be created")
+		defer os.RemoveAll(dir)
+
+		port := 50130
+		config := hash.DefaultConfig()
+		config.Router.SnapshotDir = dir
+		service, err := hash.NewServiceWithConfig(port, config)
+		test.AssertNil(t, err, "service created")
+		go service.Start()
+		test.WaitForServer(t, port)
+
+		resp, err := http.Get(fmt.Sprintf("http://localhost:%v/routes", port))
+		test.AssertNil(t, err, "HTTP error should be null")
+		resp.Body.Close()
+
+		service.Stop()
+
+		files, err := ioutil.ReadDir(dir)
+		test.AssertNil(t, err, "snapshot dir readable")
+		test.AssertEqual(t, len(files), 1, "one snapshot written")
+		test.AssertEqual(t, filepath.Ext(files[0].Name()), ".json", "default format is json")
+	})
+
+	t.Run("misspelled endpoint suggests correct path", func(t *testing.T) {
+		port := 50128
+		service := hash.NewService(port)
+		go service.Start()
+		test.WaitForServer(t, port)
+
+		resp, err := http.Get(fmt.Sprintf("http://localhost:%v/hsah/1", port))
+		test.AssertNil(t, err, "HTTP error should be null")
+		test.AssertEqual(t, resp.StatusCode, 404, "misspelled route not found")
+
+		bodyBytes, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		errResp := routing.ErrorResponse{}
+		err = json.Unmarshal(bodyBytes, &errResp)
+		test.AssertNil(t, err, "body should be valid json")
+		test.AssertEqual(t, errResp.Suggestion, "/hash/{id}", "suggests the hash retrieval route")
+
+		service.Stop()
+	})
+
+	t.Run("api keys enforced", func(t *testing.T) {
+		port := 50131
+		config := hash.DefaultConfig()
+		config.Router.Keys = auth.NewKeyStore()
+		config.Router.Keys.Add("reader-key", auth.Principal{Name: "reader", Scopes: []auth.Scope{auth.ScopeHashRead}})
+		service, err := hash.NewServiceWithConfig(port, config)
+		test.AssertNil(t, err, "service created")
+		go service.Start()
+		test.WaitForServer(t, port)
+
+		resp, err := http.PostForm(fmt.Sprintf("http://localhost:%v/hash", port), url.Values{"password": {"angryMonkey"}})
+		test.AssertNil(t, err, "HTTP error should be null")
+		resp.Body.Close()
+		test.AssertEqual(t, resp.StatusCode, http.StatusUnauthorized, "submitting needs a key")
+
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("http://localhost:%v/hash", port),
+			strings.NewReader("password=angryMonkey"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer reader-key")
+		resp, err = http.DefaultClient.Do(req)
+		test.AssertNil(t, err, "HTTP error should be null")
+		resp.Body.Close()
+		test.AssertEqual(t, resp.StatusCode, http.StatusForbidden, "reading key can't submit")
+
+		resp, err = http.Get(fmt.Sprintf("http://localhost:%v/stats", port))
+		test.AssertNil(t, err, "HTTP error should be null")
+		resp.Body.Close()
+		test.AssertEqual(t, resp.StatusCode, http.StatusUnauthorized, "stats need an admin key")
+
+		service.Stop()
+	})
+
+	t.Run("tenants kept apart", func(t *testing.T) {
+		port := 50135
+		config := hash.DefaultConfig()
+		config.Tenants = []hashing.Tenant{{Name: "acme", Algorithm: hashing.SHA256, MaxHashes: 1}}
+		config.Router.Keys = auth.NewKeyStore()
+		config.Router.Keys.Add("acme-key", auth.Principal{Name: "acme", Scopes: []auth.Scope{auth.ScopeHashWrite}, Tenant: "acme"})
+		config.Router.Keys.Add("default-key", auth.Principal{Name: "default", Scopes: []auth.Scope{auth.ScopeHashWrite}})
+		config.Router.Keys.Add("admin-key", auth.Principal{Name: "ops", Scopes: []auth.Scope{auth.ScopeAdmin}})
+		clock := test.NewFakeClock(epoch)
+		config.Clock = clock
+		service, err := hash.NewServiceWithConfig(port, config)
+		test.AssertNil(t, err, "service created")
+		go service.Start()
+		test.WaitForServer(t, port)
+
+		submit := func(path string, key string) *http.Response {
+			req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("http://localhost:%v%v", port, path),
+				strings.NewReader("password=angryMonkey"))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("X-API-Key", key)
+			resp, err := http.DefaultClient.Do(req)
+			test.AssertNil(t, err, "HTTP error should be null")
+			return resp
+		}
+
+		resp := submit("/hash", "acme-key")
+		assertPostResponse(t, resp, 1)
+		resp.Body.Close()
+		resp = submit("/hash", "default-key")
+		assertPostResponse(t, resp, 1)
+		resp.Body.Close()
+
+		resp = submit("/tenants/acme/hash", "acme-key")
+		resp.Body.Close()
+		test.AssertEqual(t, resp.StatusCode, http.StatusTooManyRequests, "acme over its quota")
+		resp = submit("/tenants/acme/hash", "default-key")
+		resp.Body.Close()
+		test.AssertEqual(t, resp.StatusCode, http.StatusNotFound, "other tenants hidden")
+		resp = submit("/tenants/globex/hash", "admin-key")
+		resp.Body.Close()
+		test.AssertEqual(t, resp.StatusCode, http.StatusNotFound, "unknown tenant not found")
+
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("http://localhost:%v/hash", port),
+			strings.NewReader("password=angryMonkey&tenant=acme"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-API-Key", "admin-key")
+		resp, err = http.DefaultClient.Do(req)
+		test.AssertNil(t, err, "HTTP error should be null")
+		assertPostResponse(t, resp, 2)
+		resp.Body.Close()
+
+		req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%v/metrics", port), nil)
+		req.Header.Set("X-API-Key", "admin-key")
+		resp, err = http.DefaultClient.Do(req)
+		test.AssertNil(t, err, "HTTP error should be null")
+		bodyBytes, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		test.AssertEqual(t, strings.Contains(string(bodyBytes), `hash_queue_depth{tenant="acme"} 1`), true,
+			"queue depth reported per tenant, ignoring a tenant form field")
+
+		releaseHashes(clock, 3)
+		service.Stop()
+	})
+
+	t.Run("hashes only readable by their owner", func(t *testing.T) {
+		port := 50136
+		config := hash.DefaultConfig()
+		config.Router.Keys = auth.NewKeyStore()
+		readWrite := []auth.Scope{auth.ScopeHashWrite, auth.ScopeHashRead}
+		config.Router.Keys.Add("alice-key", auth.Principal{Name: "alice", Scopes: readWrite})
+		config.Router.Keys.Add("bob-key", auth.Principal{Name: "bob", Scopes: readWrite})
+		config.Router.Keys.Add("admin-key", auth.Principal{Name: "ops", Scopes: []auth.Scope{auth.ScopeAdmin}})
+		clock := test.NewFakeClock(epoch)
+		config.Clock = clock
+		service, err := hash.NewServiceWithConfig(port, config)
+		test.AssertNil(t, err, "service created")
+		go service.Start()
+		test.WaitForServer(t, port)
+
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("http://localhost:%v/hash", port),
+			strings.NewReader(fmt.Sprintf("password=%s", input)))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-API-Key", "alice-key")
+		resp, err := http.DefaultClient.Do(req)
+		test.AssertNil(t, err, "HTTP error should be null")
+		assertPostResponse(t, resp, 1)
+		resp.Body.Close()
+
+		clock.BlockUntil(1)
+		clock.Advance(hashing.DefaultDelay)
+		service.Flush()
+
+		get := func(key string) *http.Response {
+			req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%v/hash/1", port), nil)
+			req.Header.Set("X-API-Key", key)
+			resp, err := http.DefaultClient.Do(req)
+			test.AssertNil(t, err, "HTTP error should be null")
+			return resp
+		}
+
+		resp = get("bob-key")
+		bodyBytes, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		test.AssertEqual(t, resp.StatusCode, http.StatusNotFound, "other keys can't read the hash")
+		test.AssertEqual(t, errorMessage(t, string(bodyBytes)), "no hash for id '1' available",
+			"indistinguishable from a missing hash")
+
+		resp = get("alice-key")
+		assertGetResponse(t, resp, 1, knownSHA512HashBase64)
+		resp.Body.Close()
+
+		resp = get("admin-key")
+		assertGetResponse(t, resp, 1, knownSHA512HashBase64)
+		resp.Body.Close()
+
+		service.Stop()
+	})
+
+	t.Run("hashes expire and can be deleted", func(t *testing.T) {
+		port := 50138
+		config := hash.DefaultConfig()
+		clock := test.NewFakeClock(epoch)
+		config.Clock = clock
+		service, err := hash.NewServiceWithConfig(port, config)
+		test.AssertNil(t, err, "service created")
+		go service.Start()
+		test.WaitForServer(t, port)
+
+		submit := func(body string) *http.Response {
+			resp, err := http.Post(fmt.Sprintf("http://localhost:%v/hash", port), "application/x-www-form-urlencoded",
+				strings.NewReader(body))
+			test.AssertNil(t, err, "HTTP error should be null")
+			return resp
+		}
+		send := func(method string, id int) (*http.Response, string) {
+			req, _ := http.NewRequest(method, fmt.Sprintf("http://localhost:%v/hash/%v", port, id), nil)
+			resp, err := http.DefaultClient.Do(req)
+			test.AssertNil(t, err, "HTTP error should be null")
+			bodyBytes, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			test.AssertNil(t, err, "body should be readable")
+			return resp, string(bodyBytes)
+		}
+
+		resp := submit(fmt.Sprintf("password=%s&ttl=-1s", input))
+		resp.Body.Close()
+		test.AssertEqual(t, resp.StatusCode, http.StatusBadRequest, "negative ttl rejected")
+
+		resp = submit(fmt.Sprintf("password=%s&ttl=1s", input))
+		submitResp := hashing.SubmitResponse{}
+		err = json.NewDecoder(resp.Body).Decode(&submitResp)
+		resp.Body.Close()
+		test.AssertNil(t, err, "body should be valid json")
+		test.AssertEqual(t, submitResp.ID, hashing.ID("1"), "first id issued")
+		test.AssertNotNil(t, submitResp.ExpiresAt, "expiry returned")
+		resp = submit(fmt.Sprintf("password=%s", input))
+		assertPostResponse(t, resp, 2)
+		resp.Body.Close()
+
+		// both hashes and the expiry sweeper wait on the clock
+		clock.BlockUntil(3)
+		clock.Advance(hashing.DefaultDelay)
+		service.Flush()
+
+		resp, body := send(http.MethodGet, 1)
+		test.AssertEqual(t, resp.StatusCode, http.StatusGone, "expired hash is gone")
+		test.AssertEqual(t, errorMessage(t, body), "hash for id '1' has expired", "expiry explained")
+		resp, _ = send(http.MethodGet, 3)
+		test.AssertEqual(t, resp.StatusCode, http.StatusNotFound, "unknown id still not found")
+
+		resp, _ = send(http.MethodDelete, 2)
+		test.AssertEqual(t, resp.StatusCode, http.StatusNoContent, "hash deleted")
+		resp, _ = send(http.MethodGet, 2)
+		test.AssertEqual(t, resp.StatusCode, http.StatusNotFound, "deleted hash not found")
+		resp, _ = send(http.MethodDelete, 2)
+		test.AssertEqual(t, resp.StatusCode, http.StatusNotFound, "deleted hash can't be deleted again")
+
+		resp = submit(fmt.Sprintf("password=%s", input))
+		assertPostResponse(t, resp, 3)
+		resp.Body.Close()
+		resp, _ = send(http.MethodDelete, 3)
+		test.AssertEqual(t, resp.StatusCode, http.StatusNoContent, "pending hash deleted")
+		// the cancelled job and the expiry sweeper wait on the clock
+		clock.BlockUntil(2)
+		clock.Advance(hashing.DefaultDelay)
+		service.Flush()
+		resp, _ = send(http.MethodGet, 3)
+		test.AssertEqual(t, resp.StatusCode, http.StatusNotFound, "cancelled hash never appears")
+
+		service.Stop()
+	})
+
+	t.Run("hash delay and schedule configurable", func(t *testing.T) {
+		port := 50139
+		config := hash.DefaultConfig()
+		config.HashDelay = hashing.DelayPolicy{Kind: hashing.NoDelay}
+		clock := test.NewFakeClock(epoch)
+		config.Clock = clock
+		service, err := hash.NewServiceWithConfig(port, config)
+		test.AssertNil(t, err, "service created")
+		go service.Start()
+		test.WaitForServer(t, port)
+
+		submit := func(body string) (*http.Response, string) {
+			resp, err := http.Post(fmt.Sprintf("http://localhost:%v/hash", port), "application/x-www-form-urlencoded",
+				strings.NewReader(body))
+			test.AssertNil(t, err, "HTTP error should be null")
+			bodyBytes, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			test.AssertNil(t, err, "body should be readable")
+			return resp, string(bodyBytes)
+		}
+
+		resp, body := submit(fmt.Sprintf("password=%s&notBefore=tomorrow", input))
+		test.AssertEqual(t, resp.StatusCode, http.StatusBadRequest, "unreadable schedule rejected")
+		test.AssertEqual(t, strings.HasPrefix(errorMessage(t, body), "'notBefore' must be an RFC 3339 timestamp"), true,
+			"format explained")
+		later := clock.Now().Add(hashing.DefaultMaxSchedule + time.Hour).Format(time.RFC3339)
+		resp, body = submit(fmt.Sprintf("password=%s&notBefore=%s", input, url.QueryEscape(later)))
+		test.AssertEqual(t, resp.StatusCode, http.StatusBadRequest, "distant schedule rejected")
+		test.AssertEqual(t, errorMessage(t, body), "'notBefore' is too far in the future", "limit explained")
+
+		resp, _ = submit(fmt.Sprintf("password=%s", input))
+		test.AssertEqual(t, resp.StatusCode, http.StatusCreated, "hash submitted")
+
+		service.Flush()
+		resp, err = http.Get(fmt.Sprintf("http://localhost:%v/hash/1", port))
+		test.AssertNil(t, err, "HTTP error should be null")
+		assertGetResponse(t, resp, 1, knownSHA512HashBase64)
+		resp.Body.Close()
+
+		tomorrow := clock.Now().Add(hashing.DefaultMaxSchedule).Format(time.RFC3339)
+		resp, _ = submit(fmt.Sprintf("password=%s&notBefore=%s", input, url.QueryEscape(tomorrow)))
+		test.AssertEqual(t, resp.StatusCode, http.StatusCreated, "hash scheduled for tomorrow")
+		stopped := make(chan struct{})
+		go func() {
+			service.Stop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			t.Fatal("shutdown waited for the hash scheduled for tomorrow")
+		}
+	})
+
+	t.Run("submissions queued by priority", func(t *testing.T) {
+		port := 50140
+		adminPort := 50145
+		config := withAdminPort(hash.DefaultConfig(), adminPort)
+		config.Router.Keys = auth.NewKeyStore()
+		config.Router.Keys.Add("writer-key", auth.Principal{Name: "writer", Scopes: []auth.Scope{auth.ScopeHashWrite}})
+		config.Router.Keys.Add("signup-key", auth.Principal{Name: "signup",
+			Scopes: []auth.Scope{auth.ScopeHashWrite, auth.ScopeHashInteractive}})
+		config.Router.Keys.Add("admin-key", auth.Principal{Name: "ops", Scopes: []auth.Scope{auth.ScopeAdmin}})
+		clock := test.NewFakeClock(epoch)
+		config.Clock = clock
+		service, err := hash.NewServiceWithConfig(port, config)
+		test.AssertNil(t, err, "service created")
+		go service.Start()
+		test.WaitForServer(t, port)
+		test.WaitForServer(t, adminPort)
+
+		submit := func(body string, key string) (*http.Response, string) {
+			req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("http://localhost:%v/hash", port), strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("X-API-Key", key)
+			resp, err := http.DefaultClient.Do(req)
+			test.AssertNil(t, err, "HTTP error should be null")
+			bodyBytes, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			test.AssertNil(t, err, "body should be readable")
+			return resp, string(bodyBytes)
+		}
+		admin := func(path string) []byte {
+			req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%v%v", adminPort, path), nil)
+			req.Header.Set("X-API-Key", "admin-key")
+			resp, err := http.DefaultClient.Do(req)
+			test.AssertNil(t, err, "HTTP error should be null")
+			bodyBytes, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			test.AssertNil(t, err, "body should be readable")
+			return bodyBytes
+		}
+
+		resp, body := submit(fmt.Sprintf("password=%s&priority=urgent", input), "writer-key")
+		test.AssertEqual(t, resp.StatusCode, http.StatusBadRequest, "unknown priority rejected")
+		test.AssertEqual(t, errorMessage(t, body), "'priority' must be one of interactive, normal or bulk, got 'urgent'",
+			"lanes listed")
+		resp, _ = submit(fmt.Sprintf("password=%s&priority=bulk", input), "writer-key")
+		test.AssertEqual(t, resp.StatusCode, http.StatusCreated, "bulk password accepted")
+		resp, body = submit(fmt.Sprintf("password=%s&priority=interactive", input), "writer-key")
+		test.AssertEqual(t, resp.StatusCode, http.StatusForbidden, "interactive priority needs its own scope")
+		test.AssertEqual(t, errorMessage(t, body),
+			"API key for 'writer' lacks the 'hash:interactive' scope needed for interactive priority",
+			"missing scope explained")
+		resp, _ = submit(fmt.Sprintf("password=%s&priority=interactive", input), "signup-key")
+		test.AssertEqual(t, resp.StatusCode, http.StatusCreated, "interactive password accepted with the scope")
+
+		metricsBody := string(admin("/metrics"))
+		test.AssertEqual(t, strings.Contains(metricsBody, `hash_queue_depth{tenant="default"} 2`), true,
+			"delayed passwords queued")
+		test.AssertEqual(t, strings.Contains(metricsBody, `hash_lane_queue_depth{tenant="default",lane="bulk"} 0`), true,
+			"delayed passwords aren't waiting for a worker")
+
+		statsResp := routing.RouterStatsResponse{}
+		err = json.Unmarshal(admin("/stats"), &statsResp)
+		test.AssertNil(t, err, "body should be valid json")
+		test.AssertEqual(t, statsResp.Gauges["hashing"]["queueDepth"], int64(2), "queue depth in stats")
+		_, ok := statsResp.Gauges["hashing"]["laneDepth interactive"]
+		test.AssertEqual(t, ok, true, "lane depth in stats")
+
+		releaseHashes(clock, 2)
+		service.Stop()
+	})
+
+	t.Run("opaque ids issued and enforced", func(t *testing.T) {
+		port := 50137
+		config := hash.DefaultConfig()
+		config.IDFormat = hashing.ULIDIDs
+		clock := test.NewFakeClock(epoch)
+		config.Clock = clock
+		service, err := hash.NewServiceWithConfig(port, config)
+		test.AssertNil(t, err, "service created")
+		go service.Start()
+		test.WaitForServer(t, port)
+
+		resp, err := postPassword(input, port)
+		test.AssertNil(t, err, "HTTP error should be null")
+		test.AssertEqual(t, resp.StatusCode, http.StatusCreated, "password accepted")
+		bodyBytes, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		submitResp := hashing.SubmitResponse{}
+		err = json.Unmarshal(bodyBytes, &submitResp)
+		test.AssertNil(t, err, "body should be valid json")
+		test.AssertEqual(t, len(submitResp.ID), 26, "ulid issued: "+string(bodyBytes))
+
+		resp, err = http.Get(fmt.Sprintf("http://localhost:%v/hash/%v", port, submitResp.ID))
+		test.AssertNil(t, err, "HTTP error should be null")
+		resp.Body.Close()
+		test.AssertEqual(t, resp.StatusCode, http.StatusNotFound, "hash not ready yet")
+
+		resp, err = http.Get(fmt.Sprintf("http://localhost:%v/hash/1", port))
+		test.AssertNil(t, err, "HTTP error should be null")
+		bodyBytes, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		errResp := routing.ErrorResponse{}
+		err = json.Unmarshal(bodyBytes, &errResp)
+		test.AssertNil(t, err, "router rejects integer ids")
+		test.AssertEqual(t, errResp.Suggestion, "/hash/{id}", "id format doesn't match the route")
+
+		releaseHashes(clock, 1)
+		service.Stop()
+
+		config.IDFormat = "bogus"
+		_, err = hash.NewServiceWithConfig(port, config)
+		test.AssertNotNil(t, err, "unknown id format rejected")
+	})
+
+	t.Run("shutdown confirmed with token", func(t *testing.T) {
+		port := 50132
+		adminPort := 50146
+		config := withAdminPort(hash.DefaultConfig(), adminPort)
+		config.ConfirmShutdown = true
+		service, err := hash.NewServiceWithConfig(port, config)
+		test.AssertNil(t, err, "service created")
+		stopped := make(chan struct{})
+		go func() {
+			service.Start()
+			close(stopped)
+		}()
+		test.WaitForServer(t, port)
+		test.WaitForServer(t, adminPort)
+		shutdownURL := fmt.Sprintf("http://localhost:%v/shutdown", adminPort)
+
+		resp, err := http.PostForm(shutdownURL, url.Values{hash.ConfirmationTokenField: {"guess"}})
+		test.AssertNil(t, err, "HTTP error should be null")
+		resp.Body.Close()
+		test.AssertEqual(t, resp.StatusCode, http.StatusBadRequest, "unknown token rejected")
+
+		resp, err = http.Post(shutdownURL, "", nil)
+		test.AssertNil(t, err, "HTTP error should be null")
+		test.AssertEqual(t, resp.StatusCode, http.StatusAccepted, "first call asks for confirmation")
+		bodyBytes, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		confirmation := hash.ConfirmationResponse{}
+		err = json.Unmarshal(bodyBytes, &confirmation)
+		test.AssertNil(t, err, "body should be valid json")
+		test.AssertEqual(t, len(confirmation.ConfirmationToken), 32, "token returned")
+		test.AssertEqual(t, confirmation.ExpiresInSeconds, 30, "token expiry returned")
+
+		req, _ := http.NewRequest(http.MethodPost, shutdownURL, nil)
+		req.Header.Set(hash.ConfirmationTokenHeader, confirmation.ConfirmationToken)
+		resp, err = http.DefaultClient.Do(req)
+		test.AssertNil(t, err, "HTTP error should be null")
+		resp.Body.Close()
+		test.AssertEqual(t, resp.StatusCode, http.StatusOK, "confirmed shutdown accepted")
+
+		<-stopped
+	})
+
+	t.Run("admin endpoints only served when protected", func(t *testing.T) {
+		port := 50147
+		adminPort := 50148
+		config := hash.DefaultConfig()
+		config.AdminPort = adminPort
+		config.AdminAddress = "0.0.0.0"
+		for _, config := range []hash.Config{hash.DefaultConfig(), config} {
+			service, err := hash.NewServiceWithConfig(port, config)
+			test.AssertNil(t, err, "service created")
+			go service.Start()
+			test.WaitForServer(t, port)
+
+			for _, target := range []int{port, adminPort} {
+				resp, err := http.Post(fmt.Sprintf("http://localhost:%v/shutdown", target), "", nil)
+				if err != nil {
+					continue // no admin port
+				}
+				resp.Body.Close()
+				test.AssertEqual(t, resp.StatusCode, http.StatusNotFound, "shutdown open to anyone not served")
+				resp, err = http.Get(fmt.Sprintf("http://localhost:%v/stats", target))
+				test.AssertNil(t, err, "HTTP error should be null")
+				resp.Body.Close()
+				test.AssertEqual(t, resp.StatusCode, http.StatusNotFound, "stats open to anyone not served")
+			}
+			service.Stop()
+		}
+	})
+
+	t.Run("admin endpoints on separate port", func(t *testing.T) {
+		port := 50133
+		adminPort := 50134
+		config := hash.DefaultConfig()
+		config.AdminPort = adminPort
+		service, err := hash.NewServiceWithConfig(port, config)
+		test.AssertNil(t, err, "service created")
+		stopped := make(chan struct{})
+		go func() {
+			service.Start()
+			close(stopped)
+		}()
+		test.WaitForServer(t, port)
+		test.WaitForServer(t, adminPort)
+
+		for _, path := range []string{"/stats", "/routes", "/metrics"} {
+			resp, err := http.Get(fmt.Sprintf("http://localhost:%v%v", port, path))
+			test.AssertNil(t, err, "HTTP error should be null")
+			resp.Body.Close()
+			test.AssertEqual(t, resp.StatusCode, http.StatusNotFound, fmt.Sprintf("%v not served on main port", path))
+
+			resp, err = http.Get(fmt.Sprintf("http://localhost:%v%v", adminPort, path))
+			test.AssertNil(t, err, "HTTP error should be null")
+			resp.Body.Close()
+			test.AssertEqual(t, resp.StatusCode, http.StatusOK, fmt.Sprintf("%v served on admin port", path))
+		}
+
+		resp, err := http.Post(fmt.Sprintf("http://localhost:%v/shutdown", port), "", nil)
+		test.AssertNil(t, err, "HTTP error should be null")
+		resp.Body.Close()
+		test.AssertEqual(t, resp.StatusCode, http.StatusNotFound, "shutdown not served on main port")
+
+		resp, err = http.Post(fmt.Sprintf("http://localhost:%v/shutdown", adminPort), "", nil)
+		test.AssertNil(t, err, "HTTP error should be null")
+		resp.Body.Close()
+		test.AssertEqual(t, resp.StatusCode, http.StatusOK, "shutdown served on admin port")
+
+		<-stopped
+		_, err = http.Get(fmt.Sprintf("http://localhost:%v/stats", adminPort))
+		test.AssertNotNil(t, err, "admin port closed after shutdown")
+	})
+
+	t.Run("taken admin port fails startup", func(t *testing.T) {
+		port := 50149
+		adminPort := 50150
+		taken, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%v", adminPort))
+		test.AssertNil(t, err, "admin port taken")
+		defer taken.Close()
+
+		service, err := hash.NewServiceWithConfig(port, withAdminPort(hash.DefaultConfig(), adminPort))
+		test.AssertNil(t, err, "service created")
+		err = service.Start()
+		test.AssertNotNil(t, err, "startup fails")
+		_, err = http.Get(fmt.Sprintf("http://localhost:%v/hash/1", port))
+		test.AssertNotNil(t, err, "service port not served")
+		// stopping a service that failed to start has nothing left to do
+		service.Stop()
 	})
 }
 
+// withAdminPort returns config serving the admin endpoints on adminPort. Without API keys they are only served on an
+// admin port bound to a loopback address
+func withAdminPort(config hash.Config, adminPort int) hash.Config {
+	config.AdminPort = adminPort
+	config.AdminAddress = "127.0.0.1"
+	return config
+}
+
+// releaseHashes advances the clock past the hash delay once the given number of hashes are waiting on it, so the
+// service can stop without waiting for them
+func releaseHashes(clock *test.FakeClock, pending int) {
+	clock.BlockUntil(pending)
+	clock.Advance(hashing.DefaultDelay)
+}
+
 func assertPostResponse(t *testing.T, resp *http.Response, expectedID int) {
 	test.AssertEqual(t, resp.StatusCode, 201, "201 indicating password hash created")
 	bodyContents, err := ioutil.ReadAll(resp.Body)
 	respObj := hashing.SubmitResponse{}
 	err = json.Unmarshal(bodyContents, &respObj)
 	test.AssertNil(t, err, "unmarshal should not error")
-	expected := hashing.SubmitResponse{ID: int64(expectedID)}
+	expected := hashing.SubmitResponse{ID: hashing.ID(strconv.Itoa(expectedID))}
 	test.AssertEqual(t, respObj, expected,"should receive proper post response")
 }
 
@@ -134,12 +828,21 @@ func assertGetResponse(t *testing.T, resp *http.Response, id int, hash string) {
 	err = json.Unmarshal(bodyContents, &respObj)
 	test.AssertNil(t, err, "unmarshal should not error")
 	expected := hashing.GetResponse{
-		ID:   int64(id),
+		ID:   hashing.ID(strconv.Itoa(id)),
 		Hash: hash,
 	}
 	test.AssertEqual(t, respObj, expected, "should receive proper get response")
 }
 
+// errorMessage returns the message of a JSON error response, checking it carries the ID of the rejected request
+func errorMessage(t *testing.T, body string) string {
+	errResp := routing.ErrorResponse{}
+	err := json.Unmarshal([]byte(body), &errResp)
+	test.AssertNil(t, err, "error body should be valid json")
+	test.AssertEqual(t, errResp.RequestID != "", true, "error tagged with the request id")
+	return errResp.Error
+}
+
 func postPassword(pw string, port int) (*http.Response, error) {
 	return http.Post(fmt.Sprintf("http://localhost:%v/hash", port), "application/x-www-form-urlencoded", strings.NewReader(fmt.Sprintf(`password=%s`, pw)))
 }
\ No newline at end of file
@@ -0,0 +1,69 @@
+// Package auth authenticates API keys and describes what the holder of each key may do
+package auth
+
+import (
+	"context"
+	"fmt"
+)
+
+// Scope is a permission granted to an API key
+type Scope string
+
+const (
+	// ScopeHashWrite allows submitting passwords to be hashed
+	ScopeHashWrite Scope = "hash:write"
+	// ScopeHashRead allows retrieving hashes
+	ScopeHashRead Scope = "hash:read"
+	// ScopeHashInteractive allows submitting passwords with interactive priority, ahead of other work
+	ScopeHashInteractive Scope = "hash:interactive"
+	// ScopeAdmin allows everything, including stats and shutting the service down
+	ScopeAdmin Scope = "admin"
+)
+
+// knownScopes are the scopes that can be granted in a key file
+var knownScopes = map[Scope]bool{
+	ScopeHashWrite:       true,
+	ScopeHashRead:        true,
+	ScopeHashInteractive: true,
+	ScopeAdmin:           true,
+}
+
+// ParseScope returns the Scope with the given name
+func ParseScope(name string) (Scope, error) {
+	if !knownScopes[Scope(name)] {
+		return "", fmt.Errorf("unknown scope '%v'", name)
+	}
+	return Scope(name), nil
+}
+
+// Principal is the authenticated holder of an API key
+type Principal struct {
+	// Name identifies the key, and owns the hashes it submits, so it is unique within a KeyStore
+	Name   string
+	Scopes []Scope
+	// Tenant is the namespace of hashes the key is limited to. Keys without a tenant use the default namespace
+	Tenant string
+}
+
+// HasScope returns true if the principal was granted the given scope. The admin scope implies every other scope
+func (p Principal) HasScope(scope Scope) bool {
+	for _, granted := range p.Scopes {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the given principal
+func NewContext(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, principal)
+}
+
+// FromContext returns the principal carried by ctx, and false if the request was not authenticated
+func FromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(contextKey{}).(Principal)
+	return principal, ok
+}
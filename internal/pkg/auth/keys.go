@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/hashing"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+	"io"
+	"os"
+	"strings"
+)
+
+// KeyStore holds the hashes of every valid API key along with the principal each one authenticates. The keys
+// themselves are never stored
+type KeyStore struct {
+	principals map[string]Principal // map of key hash -> principal
+	names      map[string]bool      // names of every principal, as hashes are owned by name
+}
+
+// NewKeyStore returns an empty KeyStore
+func NewKeyStore() *KeyStore {
+	return &KeyStore{principals: make(map[string]Principal), names: make(map[string]bool)}
+}
+
+// LoadKeyFile reads a KeyStore from the file at path. See ReadKeys for the file format
+func LoadKeyFile(path string) (*KeyStore, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadKeys(file)
+}
+
+// ReadKeys reads a KeyStore with one key per line in the form
+//
+//	<name> <key hash> <scope>[,<scope>...] [<tenant>]
+//
+// where the key hash is the key as hashed by hashing.GetHash, and the optional tenant limits the key to that tenant's
+// hashes. Names must be unique. Blank lines and lines starting with # are ignored
+func ReadKeys(r io.Reader) (*KeyStore, error) {
+	keys := NewKeyStore()
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 && len(fields) != 4 {
+			return nil, fmt.Errorf("line %d: expected '<name> <key hash> <scopes> [<tenant>]'", lineNumber)
+		}
+		principal := Principal{Name: fields[0]}
+		if len(fields) == 4 {
+			if !hashing.ValidTenantName(fields[3]) {
+				return nil, fmt.Errorf("line %d: invalid tenant name '%v'", lineNumber, fields[3])
+			}
+			principal.Tenant = fields[3]
+		}
+		for _, name := range strings.Split(fields[2], ",") {
+			scope, err := ParseScope(name)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+			principal.Scopes = append(principal.Scopes, scope)
+		}
+		if err := keys.addHash(fields[1], principal); err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Add registers a key for the given principal, keeping only its hash. The principal's name must not already belong
+// to another key, as hashes are owned by name
+func (k *KeyStore) Add(key logging.Secret, principal Principal) error {
+	return k.addHash(hashing.GetHash(key.Reveal()), principal)
+}
+
+func (k *KeyStore) addHash(hash string, principal Principal) error {
+	if _, exists := k.principals[hash]; exists {
+		return fmt.Errorf("key for '%v' is already in use", principal.Name)
+	}
+	if k.names[principal.Name] {
+		return fmt.Errorf("name '%v' already belongs to another key", principal.Name)
+	}
+	k.principals[hash] = principal
+	k.names[principal.Name] = true
+	return nil
+}
+
+// Authenticate returns the principal the given key belongs to, and false if it is not a valid key
+func (k *KeyStore) Authenticate(key logging.Secret) (Principal, bool) {
+	if key == "" {
+		return Principal{}, false
+	}
+	principal, ok := k.principals[hashing.GetHash(key.Reveal())]
+	return principal, ok
+}
@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/auth"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/hashing"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/test"
+	"strings"
+	"testing"
+)
+
+func TestKeyStore(t *testing.T) {
+	t.Run("keys read from hashes", func(t *testing.T) {
+		file := "# name hash scopes\n\n" +
+			"writer " + hashing.GetHash("write-key") + " hash:write,hash:read\n" +
+			"ops " + hashing.GetHash("admin-key") + " admin\n"
+		keys, err := auth.ReadKeys(strings.NewReader(file))
+		test.AssertNil(t, err, "valid file read")
+
+		principal, ok := keys.Authenticate("write-key")
+		test.AssertEqual(t, ok, true, "writer key accepted")
+		test.AssertEqual(t, principal.Name, "writer", "principal named")
+		test.AssertEqual(t, principal.HasScope(auth.ScopeHashRead), true, "read granted")
+		test.AssertEqual(t, principal.HasScope(auth.ScopeAdmin), false, "admin not granted")
+
+		principal, ok = keys.Authenticate("admin-key")
+		test.AssertEqual(t, ok, true, "admin key accepted")
+		test.AssertEqual(t, principal.HasScope(auth.ScopeHashWrite), true, "admin implies every scope")
+
+		_, ok = keys.Authenticate(logging.Secret(hashing.GetHash("write-key")))
+		test.AssertEqual(t, ok, false, "the stored hash is not itself a key")
+		_, ok = keys.Authenticate("")
+		test.AssertEqual(t, ok, false, "empty key rejected")
+	})
+
+	t.Run("keys limited to a tenant", func(t *testing.T) {
+		keys, err := auth.ReadKeys(strings.NewReader("acme " + hashing.GetHash("acme-key") + " hash:write acme\n"))
+		test.AssertNil(t, err, "valid file read")
+		principal, ok := keys.Authenticate("acme-key")
+		test.AssertEqual(t, ok, true, "tenant key accepted")
+		test.AssertEqual(t, principal.Tenant, "acme", "tenant read")
+
+		_, err = auth.ReadKeys(strings.NewReader("acme abc hash:write Acme/Corp\n"))
+		test.AssertNotNil(t, err, "invalid tenant name rejected")
+	})
+
+	t.Run("bad files rejected", func(t *testing.T) {
+		_, err := auth.ReadKeys(strings.NewReader("writer hash:write\n"))
+		test.AssertNotNil(t, err, "missing field rejected")
+
+		_, err = auth.ReadKeys(strings.NewReader("writer abc hash:delete\n"))
+		test.AssertNotNil(t, err, "unknown scope rejected")
+
+		_, err = auth.ReadKeys(strings.NewReader("one abc admin\ntwo abc admin\n"))
+		test.AssertNotNil(t, err, "shared key rejected")
+
+		_, err = auth.ReadKeys(strings.NewReader("one abc admin\none def hash:read\n"))
+		test.AssertNotNil(t, err, "shared name rejected")
+	})
+
+	t.Run("keys added directly", func(t *testing.T) {
+		keys := auth.NewKeyStore()
+		err := keys.Add("key", auth.Principal{Name: "reader", Scopes: []auth.Scope{auth.ScopeHashRead}})
+		test.AssertNil(t, err, "key added")
+		_, ok := keys.Authenticate("key")
+		test.AssertEqual(t, ok, true, "added key accepted")
+	})
+}
@@ -0,0 +1,28 @@
+package clock
+
+import "time"
+
+// Clock is a source of time. Anything that reads the time, measures how long something took or waits takes a Clock,
+// so tests can control time with a fake instead of sleeping
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	After(d time.Duration) <-chan time.Time
+}
+
+type system struct{}
+
+func (system) Now() time.Time {
+	return time.Now()
+}
+
+func (system) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+func (system) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// System is a Clock backed by the system's wall clock
+var System Clock = system{}
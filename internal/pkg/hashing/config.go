@@ -0,0 +1,88 @@
+package hashing
+
+import (
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/clock"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/tracing"
+	"time"
+)
+
+const (
+	// DefaultExpiredRetention is how long expired records are remembered unless configured otherwise
+	DefaultExpiredRetention = 24 * time.Hour
+	// DefaultSweepInterval is how often expired hashes are removed unless configured otherwise
+	DefaultSweepInterval = time.Minute
+)
+
+// Config holds the settings of an InMemoryHashStore
+type Config struct {
+	// Algorithm is the name of the algorithm passwords are hashed with. See ValidAlgorithm
+	Algorithm string
+	// IDFormat is the name of the format of the IDs the store issues, such as SequentialIDs or ULIDIDs. Sequential IDs
+	// are used when empty
+	IDFormat string
+	// MaxHashes bounds the number of hashes held by the store, counting those still being processed. Submissions
+	// beyond it are rejected with ErrQuotaExceeded. The store is unbounded when zero
+	MaxHashes int64
+
+	// Delay decides how long each submitted password waits before it is hashed. ForcePassword never waits
+	Delay DelayPolicy
+	// MaxSchedule is how far in the future a submission may ask not to be hashed before
+	MaxSchedule time.Duration
+	// Clock is the source of time for delays, expiry and timings. clock.System is used when nil
+	Clock clock.Clock
+
+	// Workers is the number of passwords hashed at once. Jobs past their delay wait in their priority's lane for a
+	// worker beyond it. DefaultWorkers are used when zero
+	Workers int
+	// LaneWeights is the share of workers each priority lane gets while several lanes have jobs waiting. Lanes without
+	// a weight use their default weight
+	LaneWeights LaneWeights
+
+	// DefaultTTL is how long after submission hashes are kept unless the submission gives its own TTL. Hashes are
+	// kept forever when zero
+	DefaultTTL time.Duration
+	// ExpiredRetention is how long an expired record is remembered, so retrieving it reports it as expired rather
+	// than unknown
+	ExpiredRetention time.Duration
+	// SweepInterval is how often expired hashes are removed
+	SweepInterval time.Duration
+
+	// Shards is the number of independently locked shards records are split across by ID. A single shard puts every
+	// record behind one lock. DefaultShards are used when zero
+	Shards int
+	// MaxEntries bounds the number of records held in memory, evicting the least recently used beyond it. Memory is
+	// unbounded by entries when zero
+	MaxEntries int
+	// MaxBytes bounds the approximate size of the records held in memory, evicting the least recently used beyond it.
+	// Memory is unbounded by size when zero. Both budgets are split between the shards, so they must be at least one
+	// entry or byte per shard. Each shard evicts its own least recently used records, so eviction order is only
+	// approximately least recently used across the store
+	MaxBytes int64
+	// SpillDir is the directory records evicted from memory are written to, so they can still be retrieved. Evicted
+	// records are dropped when empty. Records left there by an earlier store are removed
+	SpillDir string
+
+	// Logger receives an entry as each job is queued and finished. Nothing is logged when nil
+	Logger *logging.Logger
+	// Tracer records spans for each job's time queued, hashing and waiting on the store lock. Tracing is disabled
+	// when nil
+	Tracer *tracing.Tracer
+}
+
+// DefaultConfig returns the Config used by NewInMemoryHashStore
+func DefaultConfig() Config {
+	return Config{
+		Algorithm:        SHA512,
+		IDFormat:         SequentialIDs,
+		Delay:            DefaultDelayPolicy(),
+		MaxSchedule:      DefaultMaxSchedule,
+		Clock:            clock.System,
+		Workers:          DefaultWorkers,
+		LaneWeights:      DefaultLaneWeights(),
+		Shards:           DefaultShards,
+		ExpiredRetention: DefaultExpiredRetention,
+		SweepInterval:    DefaultSweepInterval,
+		Logger:           logging.Discard(),
+	}
+}
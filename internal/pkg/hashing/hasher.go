@@ -1,14 +1,41 @@
 package hashing
 
 import (
+	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/base64"
 	"fmt"
 )
 
+// SHA512 is the name of the algorithm used by GetHash
+const SHA512 = "sha512"
+
+// SHA256 is the name of the algorithm used by GetSHA256Hash
+const SHA256 = "sha256"
+
+// hashers maps each supported algorithm name to the function computing it
+var hashers = map[string]func(string) string{
+	SHA512: GetHash,
+	SHA256: GetSHA256Hash,
+}
+
 // GetHash will generate the SHA512 hash and return a base64 encoded string of the hash
 func GetHash(str string) string {
 	hashBytes := sha512.Sum512([]byte(str))
 	asString := fmt.Sprintf("%x", hashBytes)
 	return base64.StdEncoding.EncodeToString([]byte(asString))
-}
\ No newline at end of file
+}
+
+// GetSHA256Hash will generate the SHA256 hash and return a base64 encoded string of the hash, encoded the same way as
+// GetHash
+func GetSHA256Hash(str string) string {
+	hashBytes := sha256.Sum256([]byte(str))
+	asString := fmt.Sprintf("%x", hashBytes)
+	return base64.StdEncoding.EncodeToString([]byte(asString))
+}
+
+// ValidAlgorithm returns true if the named hash algorithm is supported
+func ValidAlgorithm(name string) bool {
+	_, ok := hashers[name]
+	return ok
+}
@@ -0,0 +1,201 @@
+package hashing
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/clock"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Names of the ID formats a store can issue
+const (
+	// SequentialIDs are increasing integers starting at 1
+	SequentialIDs = "sequential"
+	// RandomIDs are 128 random bits written as 32 lowercase hex characters
+	RandomIDs = "random"
+	// UUIDv7IDs are time ordered RFC 9562 version 7 UUIDs
+	UUIDv7IDs = "uuidv7"
+	// ULIDIDs are time ordered ULIDs written in Crockford's base32
+	ULIDIDs = "ulid"
+)
+
+// ID identifies a submitted password. Sequential IDs are written to JSON as numbers, exactly as they were before
+// other formats existed, while every other format is written as a string
+type ID string
+
+// Int64 returns the ID as an integer, and false if it is not a sequential ID
+func (id ID) Int64() (int64, bool) {
+	value, err := strconv.ParseInt(string(id), 10, 64)
+	if err != nil || strconv.FormatInt(value, 10) != string(id) {
+		return 0, false
+	}
+	return value, true
+}
+
+// MarshalJSON writes sequential IDs as numbers and anything else as a string
+func (id ID) MarshalJSON() ([]byte, error) {
+	if _, ok := id.Int64(); ok {
+		return []byte(id), nil
+	}
+	return json.Marshal(string(id))
+}
+
+// UnmarshalJSON reads an ID written as either a number or a string
+func (id *ID) UnmarshalJSON(data []byte) error {
+	var value json.Number
+	if err := json.Unmarshal(data, &value); err == nil {
+		*id = ID(value)
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return fmt.Errorf("id must be a number or string: %v", err)
+	}
+	*id = ID(str)
+	return nil
+}
+
+// IDStrategy issues the IDs of a store. Only sequential IDs can be enumerated, so the other formats keep the volume of
+// submissions private and stop IDs from being guessed
+type IDStrategy interface {
+	// Name returns the name of the ID format, such as SequentialIDs
+	Name() string
+	// Next returns a new, unique ID
+	Next() ID
+	// Valid returns true if the given string is in the format of the IDs issued
+	Valid(id string) bool
+}
+
+// NewIDStrategy returns a new strategy issuing IDs in the named format. The time ordered formats take the time they
+// begin with from idClock, or the system clock when nil
+func NewIDStrategy(name string, idClock clock.Clock) (IDStrategy, error) {
+	if idClock == nil {
+		idClock = clock.System
+	}
+	switch name {
+	case SequentialIDs, "":
+		return &sequentialIDs{}, nil
+	case RandomIDs:
+		return randomIDs{}, nil
+	case UUIDv7IDs:
+		return uuidV7IDs{clock: idClock}, nil
+	case ULIDIDs:
+		return ulidIDs{clock: idClock}, nil
+	}
+	return nil, fmt.Errorf("unknown id format '%v', expected one of %v, %v, %v or %v", name,
+		SequentialIDs, RandomIDs, UUIDv7IDs, ULIDIDs)
+}
+
+type sequentialIDs struct {
+	last int64
+}
+
+func (s *sequentialIDs) Name() string {
+	return SequentialIDs
+}
+
+func (s *sequentialIDs) Next() ID {
+	return ID(strconv.FormatInt(atomic.AddInt64(&s.last, 1), 10))
+}
+
+func (s *sequentialIDs) Valid(id string) bool {
+	value, ok := ID(id).Int64()
+	return ok && value > 0
+}
+
+var randomIDRegex = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+type randomIDs struct{}
+
+func (randomIDs) Name() string {
+	return RandomIDs
+}
+
+func (randomIDs) Next() ID {
+	return ID(hex.EncodeToString(randomBytes(16)))
+}
+
+func (randomIDs) Valid(id string) bool {
+	return randomIDRegex.MatchString(id)
+}
+
+var uuidV7Regex = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+type uuidV7IDs struct {
+	clock clock.Clock
+}
+
+func (uuidV7IDs) Name() string {
+	return UUIDv7IDs
+}
+
+func (u uuidV7IDs) Next() ID {
+	uuid := randomBytes(16)
+	putMillis(uuid, u.clock.Now())
+	uuid[6] = 0x70 | uuid[6]&0x0f // version 7
+	uuid[8] = 0x80 | uuid[8]&0x3f // RFC 9562 variant
+	digits := hex.EncodeToString(uuid)
+	return ID(digits[0:8] + "-" + digits[8:12] + "-" + digits[12:16] + "-" + digits[16:20] + "-" + digits[20:32])
+}
+
+func (uuidV7IDs) Valid(id string) bool {
+	return uuidV7Regex.MatchString(id)
+}
+
+// crockford is the alphabet of Crockford's base32, which leaves out I, L, O and U to avoid misreading
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// the first character of a ULID only holds the top 3 bits of its 130 bit encoding
+var ulidRegex = regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+
+type ulidIDs struct {
+	clock clock.Clock
+}
+
+func (ulidIDs) Name() string {
+	return ULIDIDs
+}
+
+func (u ulidIDs) Next() ID {
+	ulid := randomBytes(16)
+	putMillis(ulid, u.clock.Now())
+
+	// encode the 128 bits as 26 characters of 5 bits each, with the first character holding the 3 bits left over
+	hi := binary.BigEndian.Uint64(ulid[0:8])
+	lo := binary.BigEndian.Uint64(ulid[8:16])
+	encoded := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		encoded[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return ID(encoded)
+}
+
+func (ulidIDs) Valid(id string) bool {
+	return ulidRegex.MatchString(id)
+}
+
+// putMillis writes the Unix time in milliseconds to the first 48 bits of b, as both UUIDv7 and ULID begin with it
+func putMillis(b []byte, now time.Time) {
+	millis := uint64(now.UnixNano() / int64(time.Millisecond))
+	for i := 0; i < 6; i++ {
+		b[i] = byte(millis >> uint(40-8*i))
+	}
+}
+
+// randomBytes returns n bytes from the system's secure random source. The source failing leaves no safe way to issue
+// unguessable IDs, so it panics
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("unable to read random bytes: %v", err))
+	}
+	return b
+}
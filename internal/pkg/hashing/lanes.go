@@ -0,0 +1,199 @@
+package hashing
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Priority is the lane a submitted password waits in for a worker to hash it
+type Priority string
+
+const (
+	// PriorityInteractive is for passwords someone is waiting on, such as sign-ups
+	PriorityInteractive Priority = "interactive"
+	// PriorityNormal is the priority of submissions that don't give one
+	PriorityNormal Priority = "normal"
+	// PriorityBulk is for large batches such as migrations, which can wait behind interactive work
+	PriorityBulk Priority = "bulk"
+)
+
+// Priorities lists every priority, from the most to the least urgent
+var Priorities = []Priority{PriorityInteractive, PriorityNormal, PriorityBulk}
+
+// DefaultWorkers is the number of passwords a store hashes at once unless configured otherwise
+var DefaultWorkers = runtime.NumCPU()
+
+// ValidPriority returns true if priority names a lane
+func ValidPriority(priority Priority) bool {
+	return laneIndex(priority) >= 0
+}
+
+// laneIndex returns the position of priority in Priorities, or -1 if it isn't one
+func laneIndex(priority Priority) int {
+	for i, known := range Priorities {
+		if priority == known {
+			return i
+		}
+	}
+	return -1
+}
+
+// LaneWeights is the share of workers each lane gets while more than one lane has jobs waiting. A lane with twice the
+// weight of another is handed twice as many workers as they free up
+type LaneWeights map[Priority]int
+
+// DefaultLaneWeights returns the LaneWeights used when none are configured
+func DefaultLaneWeights() LaneWeights {
+	return LaneWeights{PriorityInteractive: 8, PriorityNormal: 4, PriorityBulk: 1}
+}
+
+// ParseLaneWeights reads LaneWeights written as comma separated lane=weight pairs such as "interactive=8,bulk=1".
+// Lanes that aren't listed keep their default weight
+func ParseLaneWeights(value string) (LaneWeights, error) {
+	weights := DefaultLaneWeights()
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		equals := strings.Index(pair, "=")
+		if equals < 0 {
+			return nil, fmt.Errorf("invalid lane weight '%v', expected lane=weight", pair)
+		}
+		weight, err := strconv.Atoi(pair[equals+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight in '%v': %v", pair, err)
+		}
+		weights[Priority(pair[:equals])] = weight
+	}
+	return weights, weights.validate()
+}
+
+func (w LaneWeights) validate() error {
+	for priority, weight := range w {
+		if !ValidPriority(priority) {
+			return fmt.Errorf("unknown lane '%v', expected one of %v, %v or %v", priority, PriorityInteractive, PriorityNormal, PriorityBulk)
+		}
+		if weight < 1 {
+			return fmt.Errorf("lane weights must be positive, got %d for %v", weight, priority)
+		}
+	}
+	return nil
+}
+
+// weight returns the weight of the lane, falling back to its default weight if it has none
+func (w LaneWeights) weight(priority Priority) int {
+	if weight, ok := w[priority]; ok && weight > 0 {
+		return weight
+	}
+	return DefaultLaneWeights()[priority]
+}
+
+// String returns the weights in the form read by ParseLaneWeights
+func (w LaneWeights) String() string {
+	pairs := make([]string, len(Priorities))
+	for i, priority := range Priorities {
+		pairs[i] = fmt.Sprintf("%v=%d", priority, w.weight(priority))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Lanes hands out a fixed number of slots to callers queued in priority lanes. Callers get a slot straight away while
+// any are free. Once every slot is taken, each freed slot goes to the lane picked by smooth weighted round robin, so
+// every lane with callers waiting gets slots in proportion to its weight and no lane is ever starved. Callers within
+// a lane are served in the order they arrived
+type Lanes struct {
+	lock    sync.Mutex
+	free    int
+	weights []int
+	// credit is how far each lane is owed a slot, and waiting holds a channel per queued caller, both by lane index
+	credit  []int
+	waiting [][]chan struct{}
+}
+
+// NewLanes returns Lanes handing out the given number of slots, which is at least one
+func NewLanes(slots int, weights LaneWeights) *Lanes {
+	if slots < 1 {
+		slots = 1
+	}
+	l := &Lanes{
+		free:    slots,
+		weights: make([]int, len(Priorities)),
+		credit:  make([]int, len(Priorities)),
+		waiting: make([][]chan struct{}, len(Priorities)),
+	}
+	for i, priority := range Priorities {
+		l.weights[i] = weights.weight(priority)
+	}
+	return l
+}
+
+// Acquire blocks until the caller is given a slot, queueing it in the lane for priority. Unknown priorities are
+// queued in the normal lane. The slot must be given back with Release
+func (l *Lanes) Acquire(priority Priority) {
+	lane := laneIndex(priority)
+	if lane < 0 {
+		lane = laneIndex(PriorityNormal)
+	}
+	l.lock.Lock()
+	if l.free > 0 {
+		l.free--
+		l.lock.Unlock()
+		return
+	}
+	granted := make(chan struct{})
+	l.waiting[lane] = append(l.waiting[lane], granted)
+	l.lock.Unlock()
+	<-granted
+}
+
+// Release gives back a slot, handing it straight to the next caller waiting if there is one
+func (l *Lanes) Release() {
+	l.lock.Lock()
+	lane := l.nextLocked()
+	if lane < 0 {
+		l.free++
+		l.lock.Unlock()
+		return
+	}
+	granted := l.waiting[lane][0]
+	l.waiting[lane] = l.waiting[lane][1:]
+	l.lock.Unlock()
+	close(granted)
+}
+
+// nextLocked picks the lane the next free slot goes to, or -1 if no one is waiting. Every lane with callers waiting
+// earns its weight in credit, and the lane owed the most is picked and pays back the credit earned by all of them.
+// Idle lanes lose their credit, so a lane can't save up slots while it has nothing queued. The lock must be held
+func (l *Lanes) nextLocked() int {
+	next, total := -1, 0
+	for lane, queued := range l.waiting {
+		if len(queued) == 0 {
+			l.credit[lane] = 0
+			continue
+		}
+		l.credit[lane] += l.weights[lane]
+		total += l.weights[lane]
+		if next < 0 || l.credit[lane] > l.credit[next] {
+			next = lane
+		}
+	}
+	if next >= 0 {
+		l.credit[next] -= total
+	}
+	return next
+}
+
+// Waiting returns the number of callers queued in the lane for priority
+func (l *Lanes) Waiting(priority Priority) int {
+	lane := laneIndex(priority)
+	if lane < 0 {
+		return 0
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return len(l.waiting[lane])
+}
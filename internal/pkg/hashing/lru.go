@@ -0,0 +1,125 @@
+package hashing
+
+import (
+	"container/list"
+	"sync/atomic"
+)
+
+// recordOverhead approximates the bytes a record costs beyond its strings, covering the map entry, list element and
+// record struct, so a byte budget holds roughly what it says
+const recordOverhead = 160
+
+// recordCache holds records in least recently used order, within an optional entry and byte budget. Reading a record
+// only needs a read lock, as it just notes when the record was used. The order is brought up to date when a record is
+// evicted, moving records used since they were last placed to the front instead of evicting them
+type recordCache struct {
+	tick       int64 // counts reads, giving every read a unique, increasing time
+	entries    map[ID]*list.Element
+	order      *list.List // of *cachedRecord, most recently placed at the front
+	bytes      int64
+	maxEntries int
+	maxBytes   int64
+}
+
+type cachedRecord struct {
+	used   int64 // tick the record was last read at
+	placed int64 // tick the record was last placed at the front of the order
+	id     ID
+	record HashRecord
+	size   int64
+}
+
+func newRecordCache(maxEntries int, maxBytes int64) *recordCache {
+	return &recordCache{
+		entries:    make(map[ID]*list.Element),
+		order:      list.New(),
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+	}
+}
+
+func recordSize(id ID, record HashRecord) int64 {
+	return int64(len(id)+len(record.Hash)+len(record.Owner)+len(record.Status)) + recordOverhead
+}
+
+// get returns the record for id, noting that it was used. It only needs a read lock
+func (c *recordCache) get(id ID) (HashRecord, bool) {
+	element, ok := c.entries[id]
+	if !ok {
+		return HashRecord{}, false
+	}
+	cached := element.Value.(*cachedRecord)
+	atomic.StoreInt64(&cached.used, atomic.AddInt64(&c.tick, 1))
+	return cached.record, true
+}
+
+// peek returns the record for id without noting that it was used. It only needs a read lock
+func (c *recordCache) peek(id ID) (HashRecord, bool) {
+	element, ok := c.entries[id]
+	if !ok {
+		return HashRecord{}, false
+	}
+	return element.Value.(*cachedRecord).record, true
+}
+
+// put adds or replaces the record for id. Replacing a record keeps its place in the order, while a new record is the
+// most recently used
+func (c *recordCache) put(id ID, record HashRecord) {
+	size := recordSize(id, record)
+	if element, ok := c.entries[id]; ok {
+		cached := element.Value.(*cachedRecord)
+		c.bytes += size - cached.size
+		cached.record = record
+		cached.size = size
+		return
+	}
+	now := atomic.AddInt64(&c.tick, 1)
+	c.entries[id] = c.order.PushFront(&cachedRecord{used: now, placed: now, id: id, record: record, size: size})
+	c.bytes += size
+}
+
+// remove deletes the record for id, returning it and false if there was none
+func (c *recordCache) remove(id ID) (HashRecord, bool) {
+	element, ok := c.entries[id]
+	if !ok {
+		return HashRecord{}, false
+	}
+	cached := c.order.Remove(element).(*cachedRecord)
+	delete(c.entries, id)
+	c.bytes -= cached.size
+	return cached.record, true
+}
+
+// evictable returns the least recently used record if the cache is over budget. The last record is never evicted, so
+// a record larger than the whole byte budget can still be stored
+func (c *recordCache) evictable() (ID, HashRecord, bool) {
+	over := (c.maxEntries > 0 && len(c.entries) > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes)
+	if !over || len(c.entries) < 2 {
+		return "", HashRecord{}, false
+	}
+	for {
+		element := c.order.Back()
+		cached := element.Value.(*cachedRecord)
+		used := atomic.LoadInt64(&cached.used)
+		if used == cached.placed {
+			return cached.id, cached.record, true
+		}
+		// read since it was placed, so it gets another turn at the front
+		cached.placed = used
+		c.order.MoveToFront(element)
+	}
+}
+
+// each calls fn with every record, from least to most recently placed. fn may remove the record it is given
+func (c *recordCache) each(fn func(id ID, record HashRecord)) {
+	for element := c.order.Back(); element != nil; {
+		previous := element.Prev()
+		cached := element.Value.(*cachedRecord)
+		fn(cached.id, cached.record)
+		element = previous
+	}
+}
+
+func (c *recordCache) len() int {
+	return len(c.entries)
+}
@@ -0,0 +1,17 @@
+package hashing
+
+import "context"
+
+type ownerContextKey struct{}
+
+// NewOwnerContext returns a copy of ctx naming the owner of any password submitted with it. Only the owner, or an
+// admin, should be shown the resulting hash
+func NewOwnerContext(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, ownerContextKey{}, owner)
+}
+
+// OwnerFromContext returns the owner named by ctx, or an empty string if there is none
+func OwnerFromContext(ctx context.Context) string {
+	owner, _ := ctx.Value(ownerContextKey{}).(string)
+	return owner
+}
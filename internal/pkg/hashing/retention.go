@@ -0,0 +1,162 @@
+package hashing
+
+import (
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+	"sync/atomic"
+	"time"
+)
+
+// expiresAt returns a pointer to expires for JSON responses, or nil if the hash never expires
+func expiresAt(expires time.Time) *time.Time {
+	if expires.IsZero() {
+		return nil
+	}
+	return &expires
+}
+
+// dueToExpire returns true if record is available but its TTL has passed as of now
+func dueToExpire(record HashRecord, now time.Time) bool {
+	return record.Status == StatusAvailable && !record.Expires.IsZero() && !now.Before(record.Expires)
+}
+
+// expireLocked turns the record for id into an expired record if its TTL has passed as of now. The hash is dropped
+// straight away and stops counting against the store's quota. The shard's write lock must be held
+func (h *InMemoryHashStore) expireLocked(shard *storeShard, id ID, now time.Time) {
+	record, ok := shard.records.peek(id)
+	if !ok || !dueToExpire(record, now) {
+		return
+	}
+	record.Hash = ""
+	record.Status = StatusExpired
+	shard.records.put(id, record)
+	shard.expired++
+	atomic.AddInt64(&h.held, -1)
+}
+
+// DeleteHash removes the hash for the provided ID, returning false if there was no hash to remove. Deleted IDs are
+// forgotten entirely rather than remembered as expired. A password still waiting to be hashed is cancelled, so its
+// hash never appears
+func (h *InMemoryHashStore) DeleteHash(id ID) bool {
+	shard := h.shardFor(id)
+	h.lock(shard, DeleteLockWaitStat)
+	defer shard.lock.Unlock()
+	record, ok := shard.records.remove(id)
+	if !ok {
+		record, ok = h.readSpilledLocked(shard, id)
+	}
+	if !ok {
+		if !shard.claimPendingLocked(id) {
+			return false
+		}
+		atomic.AddInt64(&h.held, -1)
+		return true
+	}
+	h.forgetLocked(shard, record)
+	return true
+}
+
+// PendingOwner returns the owner of the password submitted for id if it is still waiting to be hashed, and false if
+// there is no such password
+func (h *InMemoryHashStore) PendingOwner(id ID) (string, bool) {
+	shard := h.shardFor(id)
+	shard.lock.RLock()
+	defer shard.lock.RUnlock()
+	owner, ok := shard.pending[id]
+	return owner, ok
+}
+
+// Sweep expires every hash whose TTL has passed as of now, and forgets expired records that have been kept longer than
+// the store's expired retention, whether they are held in memory or spilled to disk. It is called periodically by the
+// store, but can be called directly as well
+func (h *InMemoryHashStore) Sweep(now time.Time) {
+	expired, forgotten := 0, 0
+	for _, shard := range h.shards {
+		shard.lock.Lock()
+		shard.records.each(func(id ID, record HashRecord) {
+			if dueToExpire(record, now) {
+				h.expireLocked(shard, id, now)
+				expired++
+			} else if record.Status == StatusExpired && !now.Before(record.Expires.Add(h.expiredRetention)) {
+				shard.records.remove(id)
+				shard.expired--
+				forgotten++
+			}
+		})
+		for id, spilled := range shard.expiring {
+			if spilled.status == StatusAvailable && !now.Before(spilled.expires) {
+				if h.expireSpilledLocked(shard, id) {
+					expired++
+				}
+			} else if spilled.status == StatusExpired && !now.Before(spilled.expires.Add(h.expiredRetention)) {
+				if h.forgetSpilledLocked(shard, id) {
+					forgotten++
+				}
+			}
+		}
+		shard.lock.Unlock()
+	}
+	if expired > 0 || forgotten > 0 {
+		h.logger.Debug("swept hashes", logging.Int("expired", expired), logging.Int("forgotten", forgotten))
+	}
+}
+
+// expireSpilledLocked rewrites the spilled record for id as expired, dropping its hash. The shard's write lock must be
+// held
+func (h *InMemoryHashStore) expireSpilledLocked(shard *storeShard, id ID) bool {
+	record, ok, err := h.spill.read(id)
+	if err == nil && !ok {
+		delete(shard.expiring, id)
+		return false
+	}
+	if err == nil {
+		record.Hash = ""
+		record.Status = StatusExpired
+		err = h.spill.write(id, record)
+	}
+	if err != nil {
+		h.logger.Error("failed to expire spilled hash", logging.String("id", string(id)), logging.Err(err))
+		return false
+	}
+	shard.expiring[id] = spilledExpiry{expires: record.Expires, status: StatusExpired}
+	shard.expired++
+	atomic.AddInt64(&h.held, -1)
+	return true
+}
+
+// forgetSpilledLocked removes the expired spilled record for id from disk. The shard's write lock must be held
+func (h *InMemoryHashStore) forgetSpilledLocked(shard *storeShard, id ID) bool {
+	if err := h.spill.remove(id); err != nil {
+		h.logger.Error("failed to remove expired spilled hash", logging.String("id", string(id)), logging.Err(err))
+		return false
+	}
+	delete(shard.expiring, id)
+	shard.spilled--
+	shard.expired--
+	return true
+}
+
+// startSweeper starts the goroutine sweeping the store the first time a hash with a TTL is submitted, so stores that
+// keep hashes forever never run one
+func (h *InMemoryHashStore) startSweeper() {
+	h.sweepOnce.Do(func() {
+		go func() {
+			for {
+				select {
+				case <-h.clock.After(h.sweepInterval):
+					h.Sweep(h.clock.Now())
+				case <-h.closed:
+					return
+				}
+			}
+		}()
+	})
+}
+
+// Close stops the store's expiry sweeper and drops jobs still waiting for their NotBefore, so a following Flush only
+// waits for jobs due within the store's delay. Hashes can still be submitted and retrieved, but expired hashes are only
+// noticed when they are retrieved, and scheduled submissions are dropped
+func (h *InMemoryHashStore) Close() {
+	h.closeOnce.Do(func() {
+		close(h.closed)
+	})
+}
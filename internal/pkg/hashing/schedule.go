@@ -0,0 +1,112 @@
+package hashing
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Kinds of DelayPolicy
+const (
+	// FixedDelay waits the same time before hashing every password
+	FixedDelay = "fixed"
+	// JitteredDelay waits a random time within a range before hashing each password, so a burst of submissions
+	// doesn't finish all at once
+	JitteredDelay = "jittered"
+	// NoDelay hashes every password as soon as it is submitted
+	NoDelay = "none"
+)
+
+const (
+	// DefaultDelay is how long a fixed policy waits before hashing unless configured otherwise
+	DefaultDelay = 5 * time.Second
+	// DefaultMaxSchedule is how far in the future a submission may ask to be hashed unless configured otherwise
+	DefaultMaxSchedule = 24 * time.Hour
+)
+
+// ErrScheduleTooFar is returned when a submission asks not to be hashed until further in the future than the store allows
+var ErrScheduleTooFar = errors.New("submission scheduled too far in the future")
+
+// DelayPolicy decides how long a submitted password waits before it is hashed. The zero DelayPolicy is a fixed
+// policy of DefaultDelay, which is what the store has always waited
+type DelayPolicy struct {
+	// Kind is FixedDelay, JitteredDelay or NoDelay
+	Kind string
+	// Delay is the wait of a fixed policy, and the shortest wait of a jittered one
+	Delay time.Duration
+	// Jitter is the most a jittered policy adds to Delay
+	Jitter time.Duration
+}
+
+// DefaultDelayPolicy returns the DelayPolicy used when none is configured
+func DefaultDelayPolicy() DelayPolicy {
+	return DelayPolicy{Kind: FixedDelay, Delay: DefaultDelay}
+}
+
+// ParseDelayPolicy reads a DelayPolicy written as "none" for no delay, a duration such as "5s" for a fixed delay, or
+// a duration and jitter such as "3s+4s" for a delay between 3 and 7 seconds
+func ParseDelayPolicy(value string) (DelayPolicy, error) {
+	if value == NoDelay {
+		return DelayPolicy{Kind: NoDelay}, nil
+	}
+	policy := DelayPolicy{Kind: FixedDelay}
+	delay := value
+	if plus := strings.Index(value, "+"); plus >= 0 {
+		jitter, err := time.ParseDuration(value[plus+1:])
+		if err != nil {
+			return DelayPolicy{}, fmt.Errorf("invalid delay jitter in '%v': %v", value, err)
+		}
+		policy.Kind = JitteredDelay
+		policy.Jitter = jitter
+		delay = value[:plus]
+	}
+	var err error
+	policy.Delay, err = time.ParseDuration(delay)
+	if err != nil {
+		return DelayPolicy{}, fmt.Errorf("invalid delay in '%v': %v", value, err)
+	}
+	return policy, policy.validate()
+}
+
+func (p DelayPolicy) validate() error {
+	switch p.Kind {
+	case "", FixedDelay, JitteredDelay, NoDelay:
+	default:
+		return fmt.Errorf("unknown delay policy '%v', expected one of %v, %v or %v", p.Kind, FixedDelay, JitteredDelay, NoDelay)
+	}
+	if p.Delay < 0 || p.Jitter < 0 {
+		return fmt.Errorf("delay and jitter must not be negative, got %v and %v", p.Delay, p.Jitter)
+	}
+	return nil
+}
+
+// String returns the policy in the form read by ParseDelayPolicy
+func (p DelayPolicy) String() string {
+	switch p.Kind {
+	case NoDelay:
+		return NoDelay
+	case JitteredDelay:
+		return p.Delay.String() + "+" + p.Jitter.String()
+	case "":
+		return DefaultDelay.String()
+	}
+	return p.Delay.String()
+}
+
+// next returns how long the next password should wait before being hashed
+func (p DelayPolicy) next() time.Duration {
+	switch p.Kind {
+	case NoDelay:
+		return 0
+	case JitteredDelay:
+		if p.Jitter <= 0 {
+			return p.Delay
+		}
+		return p.Delay + time.Duration(rand.Int63n(int64(p.Jitter)+1))
+	case "":
+		return DefaultDelay
+	}
+	return p.Delay
+}
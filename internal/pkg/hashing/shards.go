@@ -0,0 +1,89 @@
+package hashing
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// DefaultShards is the number of shards a store's records are split across unless configured otherwise
+const DefaultShards = 16
+
+// storeShard holds the records for a share of a store's IDs behind its own lock, so work on IDs in different shards
+// never contends. Retrievals only take the read lock unless they have to change the shard, so they never block each
+// other
+type storeShard struct {
+	lock    sync.RWMutex
+	records *recordCache
+	// expired counts the shard's expired records in either tier and spilled its records in the spill tier, both
+	// guarded by lock
+	expired int64
+	spilled int64
+	// expiring indexes the spilled records that have a TTL, so the sweeper can expire and forget them without reading
+	// the spill directory. It is guarded by lock
+	expiring map[ID]spilledExpiry
+	// pending holds the owner of each submitted job that hasn't stored its hash yet. A job deleted while pending is
+	// removed, which cancels it. It is guarded by lock
+	pending map[ID]string
+}
+
+// spilledExpiry is what the sweeper needs to know about a spilled record
+type spilledExpiry struct {
+	expires time.Time
+	status  RecordStatus
+}
+
+// newShards returns count shards splitting the memory budget between them, so together they never hold more than the
+// budget. Each shard evicts its own least recently used records, which makes eviction only approximately least
+// recently used across the whole store. The budget must be at least one entry or byte per shard
+func newShards(count int, maxEntries int, maxBytes int64) []*storeShard {
+	shards := make([]*storeShard, count)
+	for i := range shards {
+		shardEntries := maxEntries / count
+		if i < maxEntries%count {
+			shardEntries++
+		}
+		shardBytes := maxBytes / int64(count)
+		if int64(i) < maxBytes%int64(count) {
+			shardBytes++
+		}
+		shards[i] = &storeShard{records: newRecordCache(shardEntries, shardBytes), expiring: make(map[ID]spilledExpiry),
+			pending: make(map[ID]string)}
+	}
+	return shards
+}
+
+// claimPendingLocked removes id from the shard's pending jobs, returning false if it had already been removed, which
+// happens when the job is deleted before it finishes. Whoever removes it releases the room it held in the store. The
+// shard's write lock must be held
+func (s *storeShard) claimPendingLocked(id ID) bool {
+	if _, ok := s.pending[id]; !ok {
+		return false
+	}
+	delete(s.pending, id)
+	return true
+}
+
+// shardFor returns the shard holding the record for id
+func (h *InMemoryHashStore) shardFor(id ID) *storeShard {
+	if len(h.shards) == 1 {
+		return h.shards[0]
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(id))
+	return h.shards[hash.Sum32()%uint32(len(h.shards))]
+}
+
+// lock acquires the shard's write lock, recording how long it took under the given stat name
+func (h *InMemoryHashStore) lock(shard *storeShard, statName string) {
+	start := h.clock.Now()
+	shard.lock.Lock()
+	h.stats.AddCycleTime(statName, h.clock.Since(start))
+}
+
+// rlock acquires the shard's read lock, recording how long it took under the given stat name
+func (h *InMemoryHashStore) rlock(shard *storeShard, statName string) {
+	start := h.clock.Now()
+	shard.lock.RLock()
+	h.stats.AddCycleTime(statName, h.clock.Since(start))
+}
@@ -0,0 +1,76 @@
+package hashing
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// preloaded is the number of records stored before each benchmark starts, which operations are spread across
+const preloaded = 1024
+
+// lockedRecords is the baseline the shards are measured against, keeping every record behind a single mutex
+type lockedRecords struct {
+	lock    sync.Mutex
+	records *recordCache
+}
+
+// BenchmarkShards compares storing and retrieving records behind a single mutex with the store's read/write locked
+// shards, at ratios of readers to writers ranging from write heavy to almost entirely reads. Only the locking and
+// record cache are measured, so the cost of hashing, starting jobs and tracking stats doesn't hide the difference.
+// This lives alongside the store rather than in tests as it needs the store's internals
+func BenchmarkShards(b *testing.B) {
+	for _, readPercent := range []int{10, 50, 90, 99} {
+		b.Run(fmt.Sprintf("mutex/reads=%d%%", readPercent), func(b *testing.B) {
+			baseline := &lockedRecords{records: newRecordCache(0, 0)}
+			benchmarkRecords(b, readPercent, func(id ID) {
+				baseline.lock.Lock()
+				baseline.records.get(id)
+				baseline.lock.Unlock()
+			}, func(id ID, record HashRecord) {
+				baseline.lock.Lock()
+				baseline.records.put(id, record)
+				baseline.lock.Unlock()
+			})
+		})
+		for _, shards := range []int{1, DefaultShards} {
+			b.Run(fmt.Sprintf("shards=%d/reads=%d%%", shards, readPercent), func(b *testing.B) {
+				store := &InMemoryHashStore{shards: newShards(shards, 0, 0)}
+				benchmarkRecords(b, readPercent, func(id ID) {
+					shard := store.shardFor(id)
+					shard.lock.RLock()
+					shard.records.get(id)
+					shard.lock.RUnlock()
+				}, func(id ID, record HashRecord) {
+					shard := store.shardFor(id)
+					shard.lock.Lock()
+					shard.records.put(id, record)
+					shard.lock.Unlock()
+				})
+			})
+		}
+	}
+}
+
+func benchmarkRecords(b *testing.B, readPercent int, get func(ID), put func(ID, HashRecord)) {
+	record := HashRecord{Hash: GetSHA256Hash("angryMonkey"), Status: StatusAvailable}
+	for i := 1; i <= preloaded; i++ {
+		put(ID(strconv.Itoa(i)), record)
+	}
+
+	var counter int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			n := atomic.AddInt64(&counter, 1)
+			id := ID(strconv.FormatInt(n%preloaded+1, 10))
+			if int(n%100) < readPercent {
+				get(id)
+			} else {
+				put(id, record)
+			}
+		}
+	})
+}
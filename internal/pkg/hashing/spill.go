@@ -0,0 +1,89 @@
+package hashing
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// spillExtension is the extension of the files records are spilled to, and the only files a spill tier ever removes
+const spillExtension = ".hash"
+
+// spillTier keeps records evicted from memory in a directory, one small file per record. IDs are only ever letters,
+// digits and dashes, so they are used as the file names as they are
+type spillTier struct {
+	dir string
+}
+
+// spilledRecord is the form a record is written to disk in
+type spilledRecord struct {
+	Hash    string       `json:"hash"`
+	Owner   string       `json:"owner,omitempty"`
+	Status  RecordStatus `json:"status"`
+	Expires int64        `json:"expires,omitempty"` // unix nanoseconds, or 0 if the record never expires
+}
+
+// newSpillTier creates dir if needed and removes any records spilled to it by an earlier store. A new store issues
+// IDs from the start again, so the old records would otherwise be returned for the new IDs
+func newSpillTier(dir string) (*spillTier, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	stale, err := filepath.Glob(filepath.Join(dir, "*"+spillExtension))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range stale {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return &spillTier{dir: dir}, nil
+}
+
+func (s *spillTier) path(id ID) string {
+	return filepath.Join(s.dir, string(id)+spillExtension)
+}
+
+// write stores the record for id on disk, replacing any record already there
+func (s *spillTier) write(id ID, record HashRecord) error {
+	spilled := spilledRecord{Hash: record.Hash, Owner: record.Owner, Status: record.Status}
+	if !record.Expires.IsZero() {
+		spilled.Expires = record.Expires.UnixNano()
+	}
+	bytes, err := json.Marshal(spilled)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.path(id), bytes, 0600)
+}
+
+// read returns the record for id, and false if none was spilled
+func (s *spillTier) read(id ID) (HashRecord, bool, error) {
+	bytes, err := ioutil.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return HashRecord{}, false, nil
+	} else if err != nil {
+		return HashRecord{}, false, err
+	}
+	spilled := spilledRecord{}
+	if err := json.Unmarshal(bytes, &spilled); err != nil {
+		return HashRecord{}, false, err
+	}
+	record := HashRecord{Hash: spilled.Hash, Owner: spilled.Owner, Status: spilled.Status}
+	if spilled.Expires != 0 {
+		record.Expires = time.Unix(0, spilled.Expires)
+	}
+	return record, true, nil
+}
+
+// remove deletes the record for id from disk
+func (s *spillTier) remove(id ID) error {
+	err := os.Remove(s.path(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
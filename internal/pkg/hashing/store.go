@@ -1,6 +1,14 @@
 package hashing
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/clock"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/requestid"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/stats"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/tracing"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -9,80 +17,601 @@ import (
 // HashStorer is a basic interface for interacting with hash storage
 type HashStorer interface {
 	SubmitPassword(pass string) SubmitResponse
-	GetHash(id int64) GetResponse
+	SubmitPasswordContext(ctx context.Context, pass string) (SubmitResponse, error)
+	SubmitPasswordWithOptions(ctx context.Context, pass string, options SubmitOptions) (SubmitResponse, error)
+	GetHash(id ID) GetResponse
+	GetRecord(id ID) (HashRecord, bool)
+	DeleteHash(id ID) bool
+	PendingOwner(id ID) (string, bool)
+	IDs() IDStrategy
 }
 
+// RecordStatus is the state of a finished hash
+type RecordStatus string
+
+const (
+	// StatusAvailable records hold a hash that can be retrieved
+	StatusAvailable RecordStatus = "available"
+	// StatusExpired records have outlived their TTL. The hash is gone, and only the fact the record existed is kept
+	// for a while so it can be told apart from an unknown ID
+	StatusExpired RecordStatus = "expired"
+)
+
+// HashRecord is a finished hash along with the owner of the password it was computed from
+type HashRecord struct {
+	Hash string
+	// Owner is the owner named by the context the password was submitted with, if any
+	Owner  string
+	Status RecordStatus
+	// Expires is when the record expires, or the zero time if it never does
+	Expires time.Time
+}
+
+// SubmitOptions are settings for a single submission
+type SubmitOptions struct {
+	// TTL is how long after submission the hash is kept. The store's default TTL is used when zero
+	TTL time.Duration
+	// NotBefore is the earliest the password may be hashed, on top of the store's delay. It is ignored when zero
+	NotBefore time.Time
+	// Priority is the lane the password waits in for a worker once its delay is over. PriorityNormal is used when
+	// empty
+	Priority Priority
+}
+
+// ErrQuotaExceeded is returned when a password is submitted to a store already holding its maximum number of hashes
+var ErrQuotaExceeded = errors.New("hash quota exceeded")
+
+// ErrUnknownPriority is returned when a password is submitted with a priority that doesn't name a lane
+var ErrUnknownPriority = errors.New("unknown priority")
+
 // SubmitResponse is simple response from submitting a password for hashing
 type SubmitResponse struct {
-	ID int64 `json:"id"`
+	ID ID `json:"id"`
+	// ExpiresAt is when the hash will expire, and is left out for hashes kept forever
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
 }
 
 // GetResponse is a simple response from getting a hash
 type GetResponse struct {
-	ID int64   `json:"id"`
+	ID   ID     `json:"id"`
 	Hash string `json:"hash"`
+	// ExpiresAt is when the hash will expire, and is left out for hashes kept forever
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Names of the timings tracked by a store
+const (
+	// QueueWaitStat is the time between a password being submitted and hashing starting
+	QueueWaitStat = "queueWait"
+	// HashStatPrefix prefixes the time taken to compute each hash, followed by the algorithm name
+	HashStatPrefix = "hash "
+	// StoreLockWaitStat is the time spent waiting for the store lock when storing a finished hash
+	StoreLockWaitStat = "lockWait store"
+	// GetLockWaitStat is the time spent waiting for the store lock when retrieving a hash
+	GetLockWaitStat = "lockWait get"
+	// DeleteLockWaitStat is the time spent waiting for the store lock when deleting a hash
+	DeleteLockWaitStat = "lockWait delete"
+	// CacheHitStat is the time taken to retrieve a hash held in memory
+	CacheHitStat = "cache hit"
+	// SpillHitStat is the time taken to retrieve a hash spilled to disk, which moves it back into memory
+	SpillHitStat = "cache spill hit"
+	// CacheMissStat is the time taken to find there is no hash for an ID
+	CacheMissStat = "cache miss"
+	// EvictionStat is the time taken to evict a hash from memory, including spilling it to disk
+	EvictionStat = "cache evict"
+)
+
+// StoreMetrics is a point in time view of the work being done by a store
+type StoreMetrics struct {
+	QueueDepth   int64                   // jobs submitted but still waiting to be hashed
+	LaneDepth    map[Priority]int64      // jobs past their delay waiting for a worker in each priority lane
+	InFlight     int64                   // jobs currently being hashed
+	Size         int64                   // hashes available for retrieval
+	Expired      int64                   // expired records still remembered
+	Spilled      int64                   // records evicted from memory to disk
+	Hits         uint64                  // retrievals served from memory
+	SpillHits    uint64                  // retrievals served from disk
+	Misses       uint64                  // retrievals of unknown IDs
+	Evictions    uint64                  // records evicted from memory, whether spilled or dropped
+	QueueWait    stats.HistogramSnapshot // time each job waited before being hashed
+	HashDuration stats.HistogramSnapshot // time taken to compute each hash
+	LockWait     stats.HistogramSnapshot // time spent waiting for the store lock
 }
 
 // InMemoryHashStore stores hashes an their ids in memory
 type InMemoryHashStore struct {
-	passwordID int64
-	availableHashes map[int64]string
-	mapLock sync.Mutex
+	ids IDStrategy
+	// held counts the hashes stored or still being processed, which is what MaxHashes bounds
+	held int64
+	maxHashes int64
+	algorithm string
+	hasher func(string) string
+	queued int64
+	inFlight int64
+	// lanes limits the number of passwords hashed at once, deciding which lane is served next when jobs are waiting
+	lanes *Lanes
+	// shards hold finished hashes in memory, and spill holds those evicted from it when spilling is enabled
+	shards []*storeShard
+	spill *spillTier
+	delay DelayPolicy
+	maxSchedule time.Duration
+	clock clock.Clock
+	defaultTTL time.Duration
+	expiredRetention time.Duration
+	sweepInterval time.Duration
+	sweepOnce sync.Once
+	closeOnce sync.Once
+	closed chan struct{}
 	wg sync.WaitGroup
+	stats *stats.AverageTracker
+	logger *logging.Logger
+	tracer *tracing.Tracer
+}
+
+// hashJob is a single password waiting to be hashed
+type hashJob struct {
+	id ID
+	// requestID identifies the request that submitted the password, so the job can be correlated back to it
+	requestID string
+	owner string
+	priority Priority
+	password string
+	submitted time.Time
+	// scheduled is true if the job waits for its NotBefore rather than the store's delay, so it may not start for hours
+	scheduled bool
+	expires time.Time
+	// parent is the span that submitted the job, which has usually finished by the time the job runs
+	parent tracing.SpanContext
 }
 
 // NewInMemoryHashStore returns a new InMemoryHashStore instance
 func NewInMemoryHashStore() *InMemoryHashStore {
+	store, _ := NewInMemoryHashStoreWithConfig(DefaultConfig())
+	return store
+}
+
+// NewInMemoryHashStoreWithConfig returns a new InMemoryHashStore instance using the provided settings. SHA512 is used
+// when no algorithm is given, and an unknown algorithm is an error
+func NewInMemoryHashStoreWithConfig(config Config) (*InMemoryHashStore, error) {
+	logger := config.Logger
+	if logger == nil {
+		logger = logging.Discard()
+	}
+	algorithm := config.Algorithm
+	if algorithm == "" {
+		algorithm = SHA512
+	}
+	hasher, ok := hashers[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unknown hash algorithm '%v'", algorithm)
+	}
+	storeClock := config.Clock
+	if storeClock == nil {
+		storeClock = clock.System
+	}
+	ids, err := NewIDStrategy(config.IDFormat, storeClock)
+	if err != nil {
+		return nil, err
+	}
+	if config.MaxHashes < 0 {
+		return nil, fmt.Errorf("max hashes must not be negative, got %d", config.MaxHashes)
+	}
+	if err := config.Delay.validate(); err != nil {
+		return nil, err
+	}
+	maxSchedule := config.MaxSchedule
+	if maxSchedule <= 0 {
+		maxSchedule = DefaultMaxSchedule
+	}
+	if config.DefaultTTL < 0 {
+		return nil, fmt.Errorf("default ttl must not be negative, got %v", config.DefaultTTL)
+	}
+	expiredRetention := config.ExpiredRetention
+	if expiredRetention <= 0 {
+		expiredRetention = DefaultExpiredRetention
+	}
+	sweepInterval := config.SweepInterval
+	if sweepInterval <= 0 {
+		sweepInterval = DefaultSweepInterval
+	}
+	shards := config.Shards
+	if shards == 0 {
+		shards = DefaultShards
+	} else if shards < 0 {
+		return nil, fmt.Errorf("shards must not be negative, got %d", shards)
+	}
+	workers := config.Workers
+	if workers == 0 {
+		workers = DefaultWorkers
+	} else if workers < 0 {
+		return nil, fmt.Errorf("workers must not be negative, got %d", workers)
+	}
+	if err := config.LaneWeights.validate(); err != nil {
+		return nil, err
+	}
+	if config.MaxEntries < 0 || config.MaxBytes < 0 {
+		return nil, fmt.Errorf("memory budget must not be negative, got %d entries and %d bytes", config.MaxEntries, config.MaxBytes)
+	}
+	if (config.MaxEntries > 0 && config.MaxEntries < shards) || (config.MaxBytes > 0 && config.MaxBytes < int64(shards)) {
+		return nil, fmt.Errorf("memory budget must be at least one entry and byte per shard, got %d entries and %d bytes for %d shards",
+			config.MaxEntries, config.MaxBytes, shards)
+	}
+	var spill *spillTier
+	if config.SpillDir != "" {
+		spill, err = newSpillTier(config.SpillDir)
+		if err != nil {
+			return nil, fmt.Errorf("unable to use spill directory: %v", err)
+		}
+	}
 	return &InMemoryHashStore{
-		passwordID: 0,
-		availableHashes: make(map[int64]string),
-		mapLock: sync.Mutex{},
+		ids: ids,
+		maxHashes: config.MaxHashes,
+		algorithm: algorithm,
+		hasher: hasher,
+		lanes: NewLanes(workers, config.LaneWeights),
+		shards: newShards(shards, config.MaxEntries, config.MaxBytes),
+		spill: spill,
+		delay: config.Delay,
+		maxSchedule: maxSchedule,
+		clock: storeClock,
+		defaultTTL: config.DefaultTTL,
+		expiredRetention: expiredRetention,
+		sweepInterval: sweepInterval,
+		closed: make(chan struct{}),
 		wg: sync.WaitGroup{},
-	}
+		stats: stats.NewAverageTrackerWithClock(storeClock),
+		logger: logger,
+		tracer: config.Tracer,
+	}, nil
 }
 
-func (h *InMemoryHashStore) getNextPasswordID() int64 {
-	return atomic.AddInt64(&h.passwordID, 1)
+// Stats returns the tracker holding the store's internal timings, such as queue wait and hash computation time
+func (h *InMemoryHashStore) Stats() *stats.AverageTracker {
+	return h.stats
+}
+
+func (h *InMemoryHashStore) getNextPasswordID() ID {
+	return h.ids.Next()
+}
+
+// IDs returns the strategy issuing the store's IDs
+func (h *InMemoryHashStore) IDs() IDStrategy {
+	return h.ids
+}
+
+// Algorithm returns the name of the algorithm the store hashes passwords with
+func (h *InMemoryHashStore) Algorithm() string {
+	return h.algorithm
+}
+
+// MaxHashes returns the number of hashes the store may hold, or zero if it is unbounded
+func (h *InMemoryHashStore) MaxHashes() int64 {
+	return h.maxHashes
+}
+
+// reserve claims room for one more hash, returning false if the store is already full
+func (h *InMemoryHashStore) reserve() bool {
+	if atomic.AddInt64(&h.held, 1) > h.maxHashes && h.maxHashes > 0 {
+		atomic.AddInt64(&h.held, -1)
+		return false
+	}
+	return true
 }
 
 // SubmitPassword accepts new passwords to be hashed, returning the ID so that the hash can be
-// retrieved after processing has finished
+// retrieved after processing has finished. An empty ID is returned if the store is full
 func (h *InMemoryHashStore) SubmitPassword(pass string) SubmitResponse {
-	return SubmitResponse{
-		ID: h.waitAndStoreHash(pass, 5 * time.Second),
+	resp, _ := h.SubmitPasswordContext(context.Background(), pass)
+	return resp
+}
+
+// SubmitPasswordContext is SubmitPassword for a password submitted as part of a request. The request ID carried by
+// ctx is attached to the job, so its progress can be correlated back to the request that created it.
+// ErrQuotaExceeded is returned if the store is full
+func (h *InMemoryHashStore) SubmitPasswordContext(ctx context.Context, pass string) (SubmitResponse, error) {
+	return h.SubmitPasswordWithOptions(ctx, pass, SubmitOptions{})
+}
+
+// SubmitPasswordWithOptions is SubmitPasswordContext with settings for this submission alone, such as its TTL or the
+// earliest it may be hashed. ErrScheduleTooFar is returned if it may not be hashed until beyond the store's limit
+func (h *InMemoryHashStore) SubmitPasswordWithOptions(ctx context.Context, pass string, options SubmitOptions) (SubmitResponse, error) {
+	ctx, span := h.tracer.Start(ctx, "InMemoryHashStore.SubmitPassword")
+	defer span.End()
+	job, err := h.waitAndStoreHash(ctx, pass, h.delay, options)
+	if err != nil {
+		span.SetError(err.Error())
+		return SubmitResponse{}, err
 	}
+	return SubmitResponse{ID: job.id, ExpiresAt: expiresAt(job.expires)}, nil
 }
 
 // ForcePassword accepts new passwords without any processing time, inserting them into the store
-// immediately
-func (h *InMemoryHashStore) ForcePassword(pass string) int64 {
-	return h.waitAndStoreHash(pass, 0)
+// immediately. An empty ID is returned if the store is full
+func (h *InMemoryHashStore) ForcePassword(pass string) ID {
+	job, _ := h.waitAndStoreHash(context.Background(), pass, DelayPolicy{Kind: NoDelay}, SubmitOptions{})
+	return job.id
 }
 
-func (h *InMemoryHashStore) waitAndStoreHash(pass string, pause time.Duration) int64 {
-	id := h.getNextPasswordID()
+func (h *InMemoryHashStore) waitAndStoreHash(ctx context.Context, pass string, delay DelayPolicy, options SubmitOptions) (hashJob, error) {
+	now := h.clock.Now()
+	if options.NotBefore.Sub(now) > h.maxSchedule {
+		return hashJob{}, ErrScheduleTooFar
+	}
+	priority := options.Priority
+	if priority == "" {
+		priority = PriorityNormal
+	}
+	if !ValidPriority(priority) {
+		return hashJob{}, ErrUnknownPriority
+	}
+	if !h.reserve() {
+		return hashJob{}, ErrQuotaExceeded
+	}
+	job := hashJob{
+		id: h.getNextPasswordID(),
+		requestID: requestid.FromContext(ctx),
+		owner: OwnerFromContext(ctx),
+		priority: priority,
+		password: pass,
+		submitted: now,
+		parent: tracing.SpanContextFromContext(ctx),
+	}
+	pause := delay.next()
+	if untilNotBefore := options.NotBefore.Sub(now); !options.NotBefore.IsZero() && untilNotBefore > pause {
+		pause = untilNotBefore
+		job.scheduled = true
+	}
+	ttl := options.TTL
+	if ttl <= 0 {
+		ttl = h.defaultTTL
+	}
+	if ttl > 0 {
+		job.expires = job.submitted.Add(ttl)
+		h.startSweeper()
+	}
+	shard := h.shardFor(job.id)
+	shard.lock.Lock()
+	shard.pending[job.id] = job.owner
+	shard.lock.Unlock()
 	h.wg.Add(1)
+	atomic.AddInt64(&h.queued, 1)
+	logger := h.logger.With(logging.String("id", string(job.id)), logging.String("requestId", job.requestID),
+		logging.String("priority", string(job.priority)))
+	logger.Debug("hash job queued")
 
 	go func() {
-		time.Sleep(pause)
-		h.mapLock.Lock()
-		defer func() {
-			h.mapLock.Unlock()
-			h.wg.Done()
-		}()
-		h.availableHashes[id] = GetHash(pass)
+		defer h.wg.Done()
+		jobCtx, jobSpan := h.tracer.StartAt(tracing.ContextWithParent(context.Background(), job.parent), "hash job",
+			job.submitted, tracing.String("hash.id", string(job.id)), tracing.String("hash.priority", string(job.priority)))
+		defer jobSpan.End()
+
+		_, queueSpan := h.tracer.StartAt(jobCtx, "queue wait", job.submitted)
+		if pause > 0 && !h.waitToStart(job, pause) {
+			queueSpan.End()
+			jobSpan.SetError("dropped on close")
+			atomic.AddInt64(&h.queued, -1)
+			shard.lock.Lock()
+			if shard.claimPendingLocked(job.id) {
+				atomic.AddInt64(&h.held, -1)
+			}
+			shard.lock.Unlock()
+			logger.Warn("scheduled hash job dropped as the store closed")
+			return
+		}
+		shard.lock.RLock()
+		_, pending := shard.pending[job.id]
+		shard.lock.RUnlock()
+		if !pending {
+			// deleted while it waited, so there is no need to take a worker hashing it
+			queueSpan.End()
+			atomic.AddInt64(&h.queued, -1)
+			logger.Debug("hash job cancelled")
+			return
+		}
+		h.lanes.Acquire(job.priority)
+		atomic.AddInt64(&h.queued, -1)
+		atomic.AddInt64(&h.inFlight, 1)
+		defer atomic.AddInt64(&h.inFlight, -1)
+
+		start := h.clock.Now()
+		queueSpan.EndAt(start)
+		h.stats.AddCycleTime(QueueWaitStat, start.Sub(job.submitted))
+		_, hashSpan := h.tracer.StartAt(jobCtx, "hash "+h.algorithm, start)
+		hash := h.hasher(job.password)
+		took := h.clock.Since(start)
+		h.lanes.Release()
+		hashSpan.End()
+		h.stats.AddCycleTime(HashStatPrefix+h.algorithm, took)
+
+		_, lockSpan := h.tracer.Start(jobCtx, "store lock wait")
+		h.lock(shard, StoreLockWaitStat)
+		lockSpan.End()
+		if !shard.claimPendingLocked(job.id) {
+			shard.lock.Unlock()
+			logger.Debug("hash job cancelled")
+			return
+		}
+		shard.records.put(job.id, HashRecord{Hash: hash, Owner: job.owner, Status: StatusAvailable, Expires: job.expires})
+		h.expireLocked(shard, job.id, h.clock.Now())
+		h.evictLocked(shard)
+		shard.lock.Unlock()
+		logger.Debug("hash job finished", logging.Duration("took", took))
 	}()
 
-	return id
+	return job, nil
+}
+
+// waitToStart waits out the job's pause, returning false if the job should be dropped instead. Once the store is
+// closed, scheduled jobs are dropped rather than holding up Flush until their NotBefore, which may be hours away, while
+// jobs only waiting on the store's delay still finish
+func (h *InMemoryHashStore) waitToStart(job hashJob, pause time.Duration) bool {
+	due := h.clock.After(pause)
+	select {
+	case <-due:
+		return true
+	case <-h.closed:
+		if job.scheduled {
+			return false
+		}
+		<-due
+		return true
+	}
 }
 
 // GetHash returns the given has for the provided ID, if one exists
-func (h *InMemoryHashStore) GetHash(id int64) GetResponse {
-	h.mapLock.Lock()
-	defer h.mapLock.Unlock()
+func (h *InMemoryHashStore) GetHash(id ID) GetResponse {
+	record, _ := h.GetRecord(id)
 	return GetResponse{
 		ID: id,
-		Hash: h.availableHashes[id],
+		Hash: record.Hash,
+		ExpiresAt: expiresAt(record.Expires),
+	}
+}
+
+// GetRecord returns the finished hash for the provided ID along with its owner, and false if there is none. Records
+// past their TTL are returned with StatusExpired and no hash until the sweeper forgets them. A record spilled to disk
+// is read back into memory, so it is as fast to retrieve again as any other recently used record
+func (h *InMemoryHashStore) GetRecord(id ID) (HashRecord, bool) {
+	shard := h.shardFor(id)
+	h.rlock(shard, GetLockWaitStat)
+	start := h.clock.Now()
+	record, ok := shard.records.get(id)
+	if (ok && !dueToExpire(record, start)) || (!ok && h.spill == nil) {
+		shard.lock.RUnlock()
+		statName := CacheHitStat
+		if !ok {
+			statName = CacheMissStat
+		}
+		h.stats.AddCycleTime(statName, h.clock.Since(start))
+		return record, ok
+	}
+	shard.lock.RUnlock()
+
+	// expiring the record or reading it back from disk changes the shard, which needs the write lock
+	h.lock(shard, GetLockWaitStat)
+	defer shard.lock.Unlock()
+	start = h.clock.Now()
+	statName := CacheHitStat
+	record, ok = shard.records.get(id)
+	if !ok {
+		statName = SpillHitStat
+		record, ok = h.unspillLocked(shard, id)
+	}
+	if ok {
+		h.expireLocked(shard, id, start)
+		record, _ = shard.records.peek(id)
+		h.evictLocked(shard)
+	} else {
+		statName = CacheMissStat
+	}
+	h.stats.AddCycleTime(statName, h.clock.Since(start))
+	return record, ok
+}
+
+// unspillLocked moves the record for id from disk back into memory, returning false if it wasn't spilled. The shard's
+// write lock must be held
+func (h *InMemoryHashStore) unspillLocked(shard *storeShard, id ID) (HashRecord, bool) {
+	record, ok := h.readSpilledLocked(shard, id)
+	if !ok {
+		return HashRecord{}, false
+	}
+	shard.records.put(id, record)
+	return record, true
+}
+
+// readSpilledLocked reads and removes the record for id from disk, returning false if it wasn't spilled. Only IDs in
+// the store's format are looked for, so an ID can never name a file outside the spill directory. The shard's write
+// lock must be held
+func (h *InMemoryHashStore) readSpilledLocked(shard *storeShard, id ID) (HashRecord, bool) {
+	if h.spill == nil || !h.ids.Valid(string(id)) {
+		return HashRecord{}, false
+	}
+	record, ok, err := h.spill.read(id)
+	if err != nil {
+		h.logger.Error("failed to read spilled hash", logging.String("id", string(id)), logging.Err(err))
+		return HashRecord{}, false
+	}
+	if !ok {
+		return HashRecord{}, false
+	}
+	if err := h.spill.remove(id); err != nil {
+		h.logger.Error("failed to remove spilled hash", logging.String("id", string(id)), logging.Err(err))
+		return HashRecord{}, false
+	}
+	shard.spilled--
+	delete(shard.expiring, id)
+	return record, true
+}
+
+// evictLocked evicts the least recently used records until the memory budget is met, spilling them to disk when
+// spilling is enabled. Records that can't be spilled are dropped. The shard's write lock must be held
+func (h *InMemoryHashStore) evictLocked(shard *storeShard) {
+	for {
+		id, record, ok := shard.records.evictable()
+		if !ok {
+			return
+		}
+		start := h.clock.Now()
+		shard.records.remove(id)
+		spilled := false
+		if h.spill != nil {
+			if err := h.spill.write(id, record); err != nil {
+				h.logger.Error("failed to spill evicted hash", logging.String("id", string(id)), logging.Err(err))
+			} else {
+				spilled = true
+				shard.spilled++
+				if !record.Expires.IsZero() {
+					shard.expiring[id] = spilledExpiry{expires: record.Expires, status: record.Status}
+				}
+			}
+		}
+		if !spilled {
+			h.forgetLocked(shard, record)
+		}
+		h.stats.AddCycleTime(EvictionStat, h.clock.Since(start))
+	}
+}
+
+// forgetLocked releases what a record removed from both tiers was counted against. The shard's write lock must be held
+func (h *InMemoryHashStore) forgetLocked(shard *storeShard, record HashRecord) {
+	if record.Status == StatusExpired {
+		shard.expired--
+	} else {
+		atomic.AddInt64(&h.held, -1)
+	}
+}
+
+// Metrics returns a snapshot of the store's queue depth overall and by lane, in-flight jobs, size and hash computation timings
+func (h *InMemoryHashStore) Metrics() StoreMetrics {
+	var expired, spilled, size int64
+	for _, shard := range h.shards {
+		shard.lock.RLock()
+		expired += shard.expired
+		spilled += shard.spilled
+		size += int64(shard.records.len()) + shard.spilled - shard.expired
+		shard.lock.RUnlock()
+	}
+
+	laneDepth := make(map[Priority]int64, len(Priorities))
+	for _, priority := range Priorities {
+		laneDepth[priority] = int64(h.lanes.Waiting(priority))
+	}
+
+	snapshots := h.stats.GetSnapshots()
+	return StoreMetrics{
+		QueueDepth:   atomic.LoadInt64(&h.queued),
+		LaneDepth:    laneDepth,
+		InFlight:     atomic.LoadInt64(&h.inFlight),
+		Size:         size,
+		Expired:      expired,
+		Spilled:      spilled,
+		Hits:         snapshots[CacheHitStat].Count,
+		SpillHits:    snapshots[SpillHitStat].Count,
+		Misses:       snapshots[CacheMissStat].Count,
+		Evictions:    snapshots[EvictionStat].Count,
+		QueueWait:    snapshots[QueueWaitStat],
+		HashDuration: snapshots[HashStatPrefix+h.algorithm],
+		LockWait:     snapshots[StoreLockWaitStat].Merge(snapshots[GetLockWaitStat]).Merge(snapshots[DeleteLockWaitStat]),
 	}
 }
 
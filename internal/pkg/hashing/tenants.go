@@ -0,0 +1,176 @@
+package hashing
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultTenant is the namespace used by submissions that don't name a tenant
+const DefaultTenant = "default"
+
+var tenantNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// Tenant describes a namespace of hashes kept apart from every other namespace, with its own ID sequence, hashing
+// policy and quota
+type Tenant struct {
+	Name string
+	// Algorithm is the name of the algorithm the tenant's passwords are hashed with. SHA512 is used when empty
+	Algorithm string
+	// MaxHashes bounds the number of hashes the tenant may hold. The tenant is unbounded when zero
+	MaxHashes int64
+}
+
+// ValidTenantName returns true if name can be used as a tenant name. Names are lowercase letters, digits, - and _,
+// so they can appear in URL paths and stats names as they are
+func ValidTenantName(name string) bool {
+	return tenantNameRegex.MatchString(name)
+}
+
+// Tenants holds a separate InMemoryHashStore for each tenant. The set of tenants is fixed once created
+type Tenants struct {
+	stores map[string]*InMemoryHashStore
+}
+
+// NewTenants returns a store for the default tenant and each of the given tenants. Every store shares the logger and
+// tracer of config, while the algorithm and quota of config apply to the default tenant unless it is listed itself.
+// Each tenant has the memory budget of config to itself, and spills to a directory named after it within SpillDir
+func NewTenants(config Config, tenants []Tenant) (*Tenants, error) {
+	t := &Tenants{stores: make(map[string]*InMemoryHashStore)}
+	listed := false
+	for _, tenant := range tenants {
+		if tenant.Name == DefaultTenant {
+			listed = true
+		}
+		if err := t.add(config, tenant); err != nil {
+			return nil, err
+		}
+	}
+	if !listed {
+		err := t.add(config, Tenant{Name: DefaultTenant, Algorithm: config.Algorithm, MaxHashes: config.MaxHashes})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (t *Tenants) add(config Config, tenant Tenant) error {
+	if !ValidTenantName(tenant.Name) {
+		return fmt.Errorf("invalid tenant name '%v'", tenant.Name)
+	}
+	if _, exists := t.stores[tenant.Name]; exists {
+		return fmt.Errorf("tenant '%v' is listed more than once", tenant.Name)
+	}
+
+	config.Algorithm = tenant.Algorithm
+	config.MaxHashes = tenant.MaxHashes
+	if config.SpillDir != "" {
+		config.SpillDir = filepath.Join(config.SpillDir, tenant.Name)
+	}
+	if config.Logger != nil {
+		config.Logger = config.Logger.With(logging.String("tenant", tenant.Name))
+	}
+	store, err := NewInMemoryHashStoreWithConfig(config)
+	if err != nil {
+		return fmt.Errorf("tenant '%v': %v", tenant.Name, err)
+	}
+	t.stores[tenant.Name] = store
+	return nil
+}
+
+// Store returns the store holding the named tenant's hashes, and false if there is no such tenant
+func (t *Tenants) Store(name string) (*InMemoryHashStore, bool) {
+	store, ok := t.stores[name]
+	return store, ok
+}
+
+// Default returns the store holding the default tenant's hashes
+func (t *Tenants) Default() *InMemoryHashStore {
+	return t.stores[DefaultTenant]
+}
+
+// Names returns the name of every tenant in alphabetical order
+func (t *Tenants) Names() []string {
+	names := make([]string, 0, len(t.stores))
+	for name := range t.stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Flush will block and wait for any processing of in-flight hashing to finish for every tenant
+func (t *Tenants) Flush() {
+	for _, store := range t.stores {
+		store.Flush()
+	}
+}
+
+// Close stops the expiry sweeper of every tenant and drops their scheduled jobs
+func (t *Tenants) Close() {
+	for _, store := range t.stores {
+		store.Close()
+	}
+}
+
+// LoadTenantFile reads the tenants listed in the file at path. See ReadTenants for the file format
+func LoadTenantFile(path string) ([]Tenant, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadTenants(file)
+}
+
+// ReadTenants reads one tenant per line in the form
+//
+//	<name> <algorithm> <max hashes>
+//
+// where a max of 0 leaves the tenant unbounded. Blank lines and lines starting with # are ignored
+func ReadTenants(r io.Reader) ([]Tenant, error) {
+	tenants := make([]Tenant, 0)
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: expected '<name> <algorithm> <max hashes>'", lineNumber)
+		}
+		if !ValidTenantName(fields[0]) {
+			return nil, fmt.Errorf("line %d: invalid tenant name '%v'", lineNumber, fields[0])
+		}
+		if seen[fields[0]] {
+			return nil, fmt.Errorf("line %d: tenant '%v' is listed more than once", lineNumber, fields[0])
+		}
+		if !ValidAlgorithm(fields[1]) {
+			return nil, fmt.Errorf("line %d: unknown hash algorithm '%v'", lineNumber, fields[1])
+		}
+		maxHashes, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil || maxHashes < 0 {
+			return nil, fmt.Errorf("line %d: invalid max hashes '%v'", lineNumber, fields[2])
+		}
+
+		seen[fields[0]] = true
+		tenants = append(tenants, Tenant{Name: fields[0], Algorithm: fields[1], MaxHashes: maxHashes})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return tenants, nil
+}
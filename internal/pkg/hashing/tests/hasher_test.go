@@ -11,8 +11,17 @@ const input = "password"
 // raw hash: "b109f3bbbc244eb82441917ed06d618b9008dd09b3befd1b5e07394c706a8bb980b1d7785e5976ec049b46df5f1326af5a2ea6d103fd07c95385ffab0cacbc86"
 const knownSHA512HashBase64 = "YjEwOWYzYmJiYzI0NGViODI0NDE5MTdlZDA2ZDYxOGI5MDA4ZGQwOWIzYmVmZDFiNWUwNzM5NGM3MDZhOGJiOTgwYjFkNzc4NWU1OTc2ZWMwNDliNDZkZjVmMTMyNmFmNWEyZWE2ZDEwM2ZkMDdjOTUzODVmZmFiMGNhY2JjODY="
 
+// raw hash: "5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8"
+const knownSHA256HashBase64 = "NWU4ODQ4OThkYTI4MDQ3MTUxZDBlNTZmOGRjNjI5Mjc3MzYwM2QwZDZhYWJiZGQ2MmExMWVmNzIxZDE1NDJkOA=="
+
 func TestHasher(t *testing.T) {
 	t.Run("generate hash", func(t *testing.T) {
 		test.AssertEqual(t, hashing.GetHash(input), knownSHA512HashBase64, "correctly generates SHA512 hash")
 	})
+
+	t.Run("generate sha256 hash", func(t *testing.T) {
+		test.AssertEqual(t, hashing.GetSHA256Hash(input), knownSHA256HashBase64, "correctly generates SHA256 hash")
+		test.AssertEqual(t, hashing.ValidAlgorithm(hashing.SHA256), true, "sha256 supported")
+		test.AssertEqual(t, hashing.ValidAlgorithm("md5"), false, "md5 not supported")
+	})
 }
\ No newline at end of file
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"encoding/json"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/hashing"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/test"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestIDs(t *testing.T) {
+	formats := map[string]*regexp.Regexp{
+		hashing.SequentialIDs: regexp.MustCompile(`^[1-9][0-9]*$`),
+		hashing.RandomIDs:     regexp.MustCompile(`^[0-9a-f]{32}$`),
+		hashing.UUIDv7IDs:     regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+		hashing.ULIDIDs:       regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`),
+	}
+
+	t.Run("each format issues unique valid ids", func(t *testing.T) {
+		for name, format := range formats {
+			ids, err := hashing.NewIDStrategy(name, nil)
+			test.AssertNil(t, err, name+" strategy created")
+			test.AssertEqual(t, ids.Name(), name, "strategy named")
+
+			seen := make(map[hashing.ID]bool)
+			for i := 0; i < 100; i++ {
+				id := ids.Next()
+				test.AssertEqual(t, format.MatchString(string(id)), true, name+" id well formed: "+string(id))
+				test.AssertEqual(t, ids.Valid(string(id)), true, name+" id valid")
+				test.AssertEqual(t, seen[id], false, name+" id unique")
+				seen[id] = true
+			}
+		}
+	})
+
+	t.Run("ids of other formats rejected", func(t *testing.T) {
+		for name := range formats {
+			ids, _ := hashing.NewIDStrategy(name, nil)
+			for other := range formats {
+				if other == name {
+					continue
+				}
+				otherIDs, _ := hashing.NewIDStrategy(other, nil)
+				id := string(otherIDs.Next())
+				test.AssertEqual(t, ids.Valid(id), false, name+" rejects "+other+" id "+id)
+			}
+			test.AssertEqual(t, ids.Valid(""), false, name+" rejects empty id")
+		}
+
+		_, err := hashing.NewIDStrategy("snowflake", nil)
+		test.AssertNotNil(t, err, "unknown format rejected")
+	})
+
+	t.Run("time ordered ids begin with the clock's time", func(t *testing.T) {
+		clock := test.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		uuids, _ := hashing.NewIDStrategy(hashing.UUIDv7IDs, clock)
+		test.AssertEqual(t, string(uuids.Next())[:13], "016f5e66-e800", "uuidv7 holds the clock's milliseconds")
+		ulids, _ := hashing.NewIDStrategy(hashing.ULIDIDs, clock)
+		test.AssertEqual(t, string(ulids.Next())[:10], "01DXF6DT00", "ulid holds the clock's milliseconds")
+
+		clock.Advance(time.Millisecond)
+		test.AssertEqual(t, string(uuids.Next())[:13], "016f5e66-e801", "uuidv7 follows the clock")
+	})
+
+	t.Run("sequential ids stay json numbers", func(t *testing.T) {
+		bytes, err := json.Marshal(hashing.SubmitResponse{ID: "42"})
+		test.AssertNil(t, err, "marshalled")
+		test.AssertEqual(t, string(bytes), `{"id":42}`, "integer id written as a number")
+
+		bytes, err = json.Marshal(hashing.SubmitResponse{ID: "01J9ZV5X3K8Q2M4N6P7R8S9T0V"})
+		test.AssertNil(t, err, "marshalled")
+		test.AssertEqual(t, string(bytes), `{"id":"01J9ZV5X3K8Q2M4N6P7R8S9T0V"}`, "opaque id written as a string")
+
+		resp := hashing.SubmitResponse{}
+		test.AssertNil(t, json.Unmarshal([]byte(`{"id":7}`), &resp), "number read")
+		test.AssertEqual(t, resp.ID, hashing.ID("7"), "number read as id")
+		test.AssertNil(t, json.Unmarshal([]byte(`{"id":"abc"}`), &resp), "string read")
+		test.AssertEqual(t, resp.ID, hashing.ID("abc"), "string read as id")
+	})
+}
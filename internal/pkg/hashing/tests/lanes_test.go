@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"context"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/hashing"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/test"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLanes(t *testing.T) {
+	t.Run("free slots handed out straight away", func(t *testing.T) {
+		lanes := hashing.NewLanes(2, hashing.DefaultLaneWeights())
+		lanes.Acquire(hashing.PriorityBulk)
+		lanes.Acquire(hashing.PriorityBulk)
+		test.AssertEqual(t, lanes.Waiting(hashing.PriorityBulk), 0, "nothing queued while slots are free")
+	})
+
+	t.Run("freed slots shared by weight", func(t *testing.T) {
+		lanes := hashing.NewLanes(1, hashing.LaneWeights{hashing.PriorityInteractive: 2, hashing.PriorityBulk: 1})
+		lanes.Acquire(hashing.PriorityNormal)
+
+		granted := make(chan hashing.Priority)
+		queue := func(priority hashing.Priority, count int) {
+			for i := 0; i < count; i++ {
+				waiting := lanes.Waiting(priority)
+				go func() {
+					lanes.Acquire(priority)
+					granted <- priority
+				}()
+				for lanes.Waiting(priority) == waiting {
+					time.Sleep(time.Millisecond)
+				}
+			}
+		}
+		queue(hashing.PriorityBulk, 2)
+		queue(hashing.PriorityInteractive, 4)
+
+		order := make([]string, 0, 6)
+		for i := 0; i < 6; i++ {
+			lanes.Release()
+			order = append(order, string(<-granted))
+		}
+		test.AssertEqual(t, strings.Join(order, ","), "interactive,bulk,interactive,interactive,bulk,interactive",
+			"interactive served twice as often without starving bulk")
+	})
+
+	t.Run("submissions wait out their delay before their lane", func(t *testing.T) {
+		clock := test.NewFakeClock(epoch)
+		store, err := hashing.NewInMemoryHashStoreWithConfig(hashing.Config{Clock: clock, Workers: 1})
+		test.AssertNil(t, err, "store should be created")
+
+		submit := func(priority hashing.Priority) error {
+			_, err := store.SubmitPasswordWithOptions(context.Background(), input, hashing.SubmitOptions{Priority: priority})
+			return err
+		}
+		test.AssertNil(t, submit(hashing.PriorityInteractive), "interactive accepted")
+		test.AssertNil(t, submit(hashing.PriorityBulk), "bulk accepted")
+		test.AssertNil(t, submit(""), "normal used by default")
+		test.AssertEqual(t, submit("urgent"), hashing.ErrUnknownPriority, "unknown priority rejected")
+
+		metrics := store.Metrics()
+		test.AssertEqual(t, metrics.QueueDepth, int64(3), "three jobs queued")
+		test.AssertEqual(t, metrics.LaneDepth[hashing.PriorityInteractive], int64(0), "delayed jobs aren't waiting for a worker")
+		test.AssertEqual(t, metrics.LaneDepth[hashing.PriorityBulk], int64(0), "delayed jobs aren't in a lane yet")
+
+		clock.BlockUntil(3)
+		clock.Advance(hashing.DefaultDelay)
+		store.Flush()
+		metrics = store.Metrics()
+		test.AssertEqual(t, metrics.LaneDepth[hashing.PriorityBulk], int64(0), "every lane drained")
+		test.AssertEqual(t, metrics.Size, int64(3), "every job hashed by the single worker")
+	})
+}
+
+func TestLaneWeights(t *testing.T) {
+	t.Run("weights parsed", func(t *testing.T) {
+		weights, err := hashing.ParseLaneWeights("interactive=10, bulk=2")
+		test.AssertNil(t, err, "weights should parse")
+		test.AssertEqual(t, weights.String(), "interactive=10,normal=4,bulk=2", "unlisted lanes keep their default")
+		test.AssertEqual(t, hashing.DefaultLaneWeights().String(), "interactive=8,normal=4,bulk=1", "default weights")
+	})
+
+	t.Run("invalid weights rejected", func(t *testing.T) {
+		for _, value := range []string{"bulk", "bulk=x", "bulk=0", "urgent=3"} {
+			_, err := hashing.ParseLaneWeights(value)
+			test.AssertNotNil(t, err, "rejected: "+value)
+		}
+		_, err := hashing.NewInMemoryHashStoreWithConfig(hashing.Config{Workers: -1})
+		test.AssertNotNil(t, err, "negative workers rejected")
+	})
+}
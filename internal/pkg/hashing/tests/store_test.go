@@ -1,38 +1,496 @@
 package tests
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/hashing"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/requestid"
 	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/test"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/tracing"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
+// noDelay hashes passwords as soon as they are submitted, for tests that don't depend on the delay
+var noDelay = hashing.DelayPolicy{Kind: hashing.NoDelay}
+
+// epoch is the time fake clocks start at
+var epoch = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
 func TestHashStore(t *testing.T) {
 	t.Run("hash ID increment", func(t *testing.T) {
 		store := hashing.NewInMemoryHashStore()
-		test.AssertEqual(t, store.SubmitPassword("first"), hashing.SubmitResponse{ID: 1}, "first hash has id 1")
-		test.AssertEqual(t, store.SubmitPassword("second"), hashing.SubmitResponse{ID: 2}, "second hash has id 2")
-		test.AssertEqual(t, store.SubmitPassword("third"), hashing.SubmitResponse{ID: 3}, "third hash has id 3")
+		test.AssertEqual(t, store.SubmitPassword("first"), hashing.SubmitResponse{ID: "1"}, "first hash has id 1")
+		test.AssertEqual(t, store.SubmitPassword("second"), hashing.SubmitResponse{ID: "2"}, "second hash has id 2")
+		test.AssertEqual(t, store.SubmitPassword("third"), hashing.SubmitResponse{ID: "3"}, "third hash has id 3")
 	})
 
 	t.Run("store returns empty for missing ID", func(t *testing.T) {
 		store := hashing.NewInMemoryHashStore()
-		test.AssertEqual(t, store.GetHash(2), hashing.GetResponse{
-			ID:   2,
+		test.AssertEqual(t, store.GetHash("2"), hashing.GetResponse{
+			ID:   "2",
 			Hash: "",
 		}, "empty hash for bad ID")
 	})
 
 	t.Run("store returns hash for ID", func(t *testing.T) {
 		store := hashing.NewInMemoryHashStore()
-		test.AssertEqual(t, store.ForcePassword(input), int64(1), "first hash has id 1")
+		test.AssertEqual(t, store.ForcePassword(input), hashing.ID("1"), "first hash has id 1")
 
-		// as the inner implementation still uses a goroutine, wait just a moment to let the hash be submitted
-		time.Sleep(100 * time.Millisecond)
+		store.Flush()
 
-		test.AssertEqual(t, store.GetHash(1), hashing.GetResponse{
-			ID:   1,
+		test.AssertEqual(t, store.GetHash("1"), hashing.GetResponse{
+			ID:   "1",
 			Hash: knownSHA512HashBase64,
 		}, "matching hash")
 	})
-}
\ No newline at end of file
+
+	t.Run("store reports metrics", func(t *testing.T) {
+		store, _ := hashing.NewInMemoryHashStoreWithConfig(hashing.Config{Clock: test.NewFakeClock(epoch)})
+		store.ForcePassword(input)
+		store.Flush()
+		// the fake clock never moves, so this password waits for good
+		store.SubmitPassword("queued")
+
+		storeMetrics := store.Metrics()
+		test.AssertEqual(t, storeMetrics.QueueDepth, int64(1), "one password still waiting")
+		test.AssertEqual(t, storeMetrics.InFlight, int64(0), "nothing being hashed")
+		test.AssertEqual(t, storeMetrics.Size, int64(1), "one hash stored")
+		test.AssertEqual(t, storeMetrics.HashDuration.Count, uint64(1), "one hash timed")
+	})
+
+	t.Run("store tracks internal timings", func(t *testing.T) {
+		store := hashing.NewInMemoryHashStore()
+		store.ForcePassword(input)
+
+		store.Flush()
+		store.GetHash("1")
+
+		averages := store.Stats().GetAverages()
+		test.AssertEqual(t, len(averages), 5, "five timings tracked")
+		test.AssertEqual(t, averages[0].Name, hashing.CacheHitStat, "retrieval from memory")
+		test.AssertEqual(t, averages[1].Name, hashing.HashStatPrefix+hashing.SHA512, "hash time by algorithm")
+		test.AssertEqual(t, averages[2].Name, hashing.GetLockWaitStat, "lock wait on retrieval")
+		test.AssertEqual(t, averages[3].Name, hashing.StoreLockWaitStat, "lock wait on storing")
+		test.AssertEqual(t, averages[4].Name, hashing.QueueWaitStat, "queue wait")
+		for _, avg := range averages {
+			test.AssertEqual(t, avg.Total, 1, avg.Name+" recorded once")
+		}
+
+		storeMetrics := store.Metrics()
+		test.AssertEqual(t, storeMetrics.QueueWait.Count, uint64(1), "queue wait in metrics")
+		test.AssertEqual(t, storeMetrics.LockWait.Count, uint64(2), "both lock waits in metrics")
+		test.AssertEqual(t, storeMetrics.Hits, uint64(1), "hit in metrics")
+	})
+
+	t.Run("jobs carry request id", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		store, err := hashing.NewInMemoryHashStoreWithConfig(hashing.Config{
+			Logger: logging.New(out, logging.DebugLevel, logging.LogfmtFormat),
+		})
+		test.AssertNil(t, err, "store created")
+		resp, err := store.SubmitPasswordContext(requestid.NewContext(context.Background(), "abc"), input)
+		test.AssertNil(t, err, "password submitted")
+
+		test.AssertEqual(t, resp.ID, hashing.ID("1"), "job submitted")
+		test.AssertEqual(t, strings.Contains(out.String(), `msg="hash job queued" id=1 requestId=abc`), true,
+			"queued job logged with its request id: "+out.String())
+		test.AssertEqual(t, strings.Contains(out.String(), input), false, "password never logged")
+	})
+
+	t.Run("jobs traced", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		tracer := tracing.NewTracer("test", tracing.NewWriterExporter(out), logging.Discard())
+		store, err := hashing.NewInMemoryHashStoreWithConfig(hashing.Config{Tracer: tracer, Delay: noDelay})
+		test.AssertNil(t, err, "store created")
+		ctx, request := tracer.Start(context.Background(), "request")
+		store.SubmitPasswordContext(ctx, input)
+		request.End()
+		store.Flush()
+		test.AssertNil(t, tracer.Shutdown(), "spans exported")
+
+		// spans may have been exported across several batches, one per line
+		names := make(map[string]string)
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			export := tracing.OTLPRequest{}
+			err := json.Unmarshal([]byte(line), &export)
+			test.AssertNil(t, err, "export is valid json")
+			for _, span := range export.ResourceSpans[0].ScopeSpans[0].Spans {
+				test.AssertEqual(t, span.TraceID, request.Context().TraceID.String(), "job spans share the request's trace")
+				names[span.Name] = span.SpanID
+			}
+		}
+		for _, name := range []string{"InMemoryHashStore.SubmitPassword", "hash job", "queue wait", "hash sha512", "store lock wait"} {
+			_, ok := names[name]
+			test.AssertEqual(t, ok, true, name+" span recorded")
+		}
+	})
+
+	t.Run("store records owner", func(t *testing.T) {
+		store, _ := hashing.NewInMemoryHashStoreWithConfig(hashing.Config{Delay: noDelay})
+		_, ok := store.GetRecord("1")
+		test.AssertEqual(t, ok, false, "no record before submission")
+
+		store.SubmitPasswordContext(hashing.NewOwnerContext(context.Background(), "alice"), input)
+		store.Flush()
+		record, ok := store.GetRecord("1")
+		test.AssertEqual(t, ok, true, "record stored")
+		test.AssertEqual(t, record, hashing.HashRecord{Hash: knownSHA512HashBase64, Owner: "alice", Status: hashing.StatusAvailable}, "owner recorded")
+	})
+
+	t.Run("store waits for delay", func(t *testing.T) {
+		clock := test.NewFakeClock(epoch)
+		store, err := hashing.NewInMemoryHashStoreWithConfig(hashing.Config{Clock: clock})
+		test.AssertNil(t, err, "store created")
+		store.SubmitPassword(input)
+		clock.BlockUntil(1)
+
+		clock.Advance(hashing.DefaultDelay - time.Millisecond)
+		test.AssertEqual(t, store.Metrics().QueueDepth, int64(1), "still waiting just before the default delay")
+		clock.Advance(time.Millisecond)
+		store.Flush()
+		test.AssertEqual(t, store.GetHash("1").Hash, knownSHA512HashBase64, "hashed once the delay passed")
+		test.AssertEqual(t, store.Metrics().QueueWait.Total, hashing.DefaultDelay, "queue wait measured by the clock")
+	})
+
+	t.Run("store waits for jittered delay", func(t *testing.T) {
+		clock := test.NewFakeClock(epoch)
+		store, err := hashing.NewInMemoryHashStoreWithConfig(hashing.Config{
+			Clock: clock,
+			Delay: hashing.DelayPolicy{Kind: hashing.JitteredDelay, Delay: time.Second, Jitter: time.Second},
+		})
+		test.AssertNil(t, err, "store created")
+		store.SubmitPassword(input)
+		clock.BlockUntil(1)
+
+		clock.Advance(time.Second - time.Millisecond)
+		test.AssertEqual(t, store.Metrics().QueueDepth, int64(1), "still waiting before the shortest delay")
+		clock.Advance(time.Second + time.Millisecond)
+		store.Flush()
+		test.AssertEqual(t, store.GetHash("1").Hash, knownSHA512HashBase64, "hashed by the longest delay")
+	})
+
+	t.Run("store schedules submissions", func(t *testing.T) {
+		clock := test.NewFakeClock(epoch)
+		store, err := hashing.NewInMemoryHashStoreWithConfig(hashing.Config{Clock: clock, Delay: noDelay})
+		test.AssertNil(t, err, "store created")
+		_, err = store.SubmitPasswordWithOptions(context.Background(), input,
+			hashing.SubmitOptions{NotBefore: clock.Now().Add(time.Hour)})
+		test.AssertNil(t, err, "scheduled submission accepted")
+		clock.BlockUntil(1)
+
+		clock.Advance(59 * time.Minute)
+		test.AssertEqual(t, store.GetHash("1").Hash, "", "not hashed before it was scheduled")
+		clock.Advance(time.Minute)
+		store.Flush()
+		test.AssertEqual(t, store.GetHash("1").Hash, knownSHA512HashBase64, "hashed once scheduled")
+
+		_, err = store.SubmitPasswordWithOptions(context.Background(), input,
+			hashing.SubmitOptions{NotBefore: clock.Now().Add(hashing.DefaultMaxSchedule + time.Second)})
+		test.AssertEqual(t, err, hashing.ErrScheduleTooFar, "schedule beyond the limit rejected")
+		_, err = store.SubmitPasswordWithOptions(context.Background(), input,
+			hashing.SubmitOptions{NotBefore: clock.Now().Add(-time.Hour)})
+		test.AssertNil(t, err, "schedule in the past accepted")
+		store.Flush()
+		test.AssertEqual(t, store.GetHash("2").Hash, knownSHA512HashBase64, "past schedule hashed straight away")
+	})
+
+	t.Run("closing store drops scheduled submissions", func(t *testing.T) {
+		clock := test.NewFakeClock(epoch)
+		store, err := hashing.NewInMemoryHashStoreWithConfig(hashing.Config{Clock: clock, MaxHashes: 2})
+		test.AssertNil(t, err, "store created")
+		_, err = store.SubmitPasswordWithOptions(context.Background(), input,
+			hashing.SubmitOptions{NotBefore: clock.Now().Add(hashing.DefaultMaxSchedule)})
+		test.AssertNil(t, err, "scheduled submission accepted")
+		store.SubmitPassword(input)
+		clock.BlockUntil(2)
+
+		store.Close()
+		flushed := make(chan struct{})
+		go func() {
+			store.Flush()
+			close(flushed)
+		}()
+		clock.Advance(hashing.DefaultDelay)
+		select {
+		case <-flushed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("flush waited for the scheduled submission")
+		}
+		test.AssertEqual(t, store.GetHash("1").Hash, "", "scheduled submission dropped")
+		test.AssertEqual(t, store.GetHash("2").Hash, knownSHA512HashBase64, "delayed submission still hashed")
+		test.AssertEqual(t, store.Metrics().QueueDepth, int64(0), "nothing left queued")
+		test.AssertEqual(t, store.ForcePassword(input), hashing.ID("3"), "dropped submission no longer counts against the quota")
+	})
+
+	t.Run("store enforces quota and algorithm", func(t *testing.T) {
+		store, err := hashing.NewInMemoryHashStoreWithConfig(hashing.Config{Algorithm: hashing.SHA256, MaxHashes: 1})
+		test.AssertNil(t, err, "store created")
+		test.AssertEqual(t, store.ForcePassword(input), hashing.ID("1"), "first hash accepted")
+		_, err = store.SubmitPasswordContext(context.Background(), input)
+		test.AssertEqual(t, err, hashing.ErrQuotaExceeded, "second hash over quota")
+
+		store.Flush()
+		test.AssertEqual(t, store.GetHash("1").Hash, hashing.GetSHA256Hash(input), "hashed with sha256")
+
+		_, err = hashing.NewInMemoryHashStoreWithConfig(hashing.Config{Algorithm: "md5"})
+		test.AssertNotNil(t, err, "unknown algorithm rejected")
+	})
+
+	t.Run("store evicts least recently used hashes", func(t *testing.T) {
+		store, err := hashing.NewInMemoryHashStoreWithConfig(hashing.Config{MaxEntries: 2, Shards: 1})
+		test.AssertNil(t, err, "store created")
+		store.ForcePassword(input)
+		store.ForcePassword(input)
+		store.Flush()
+		store.GetHash("1")
+		store.ForcePassword(input)
+		store.Flush()
+
+		test.AssertEqual(t, store.GetHash("1").Hash, knownSHA512HashBase64, "recently used hash kept")
+		test.AssertEqual(t, store.GetHash("2").Hash, "", "least recently used hash evicted")
+		test.AssertEqual(t, store.GetHash("3").Hash, knownSHA512HashBase64, "new hash kept")
+		storeMetrics := store.Metrics()
+		test.AssertEqual(t, storeMetrics.Size, int64(2), "size within budget")
+		test.AssertEqual(t, storeMetrics.Evictions, uint64(1), "eviction counted")
+		test.AssertEqual(t, storeMetrics.Misses, uint64(1), "miss counted")
+		test.AssertEqual(t, storeMetrics.Hits, uint64(3), "hits counted")
+
+		_, err = hashing.NewInMemoryHashStoreWithConfig(hashing.Config{MaxBytes: -1})
+		test.AssertNotNil(t, err, "negative budget rejected")
+	})
+
+	t.Run("store spills evicted hashes to disk", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "spill")
+		test.AssertNil(t, err, "temp dir created")
+		defer os.RemoveAll(dir)
+		ioutil.WriteFile(filepath.Join(dir, "1.hash"), []byte(`{"hash":"stale","status":"available"}`), 0600)
+		ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("kept"), 0600)
+
+		store, err := hashing.NewInMemoryHashStoreWithConfig(hashing.Config{MaxBytes: 1, SpillDir: dir, Shards: 1, Delay: noDelay})
+		test.AssertNil(t, err, "store created")
+		_, err = os.Stat(filepath.Join(dir, "notes.txt"))
+		test.AssertNil(t, err, "unrelated files left alone")
+		store.SubmitPasswordContext(hashing.NewOwnerContext(context.Background(), "alice"), input)
+		store.Flush()
+		store.ForcePassword(input)
+		store.Flush()
+		test.AssertEqual(t, store.Metrics().Spilled, int64(1), "one hash spilled")
+
+		record, ok := store.GetRecord("1")
+		test.AssertEqual(t, ok, true, "spilled hash read back from disk")
+		test.AssertEqual(t, record, hashing.HashRecord{Hash: knownSHA512HashBase64, Owner: "alice", Status: hashing.StatusAvailable}, "spilled record intact")
+		test.AssertEqual(t, store.GetHash("2").Hash, knownSHA512HashBase64, "hash spilled by the read retrieved")
+		storeMetrics := store.Metrics()
+		test.AssertEqual(t, storeMetrics.Size, int64(2), "spilled hashes still counted")
+		test.AssertEqual(t, storeMetrics.SpillHits, uint64(2), "disk hits counted")
+		test.AssertEqual(t, storeMetrics.Evictions, uint64(3), "evictions counted")
+
+		test.AssertEqual(t, store.DeleteHash("1"), true, "spilled hash deleted")
+		test.AssertEqual(t, store.GetHash("1").Hash, "", "deleted hash gone from disk")
+		test.AssertEqual(t, store.Metrics().Size, int64(1), "deleted hash not counted")
+	})
+
+	t.Run("store expires spilled hashes", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "spill")
+		test.AssertNil(t, err, "temp dir created")
+		defer os.RemoveAll(dir)
+		clock := test.NewFakeClock(epoch)
+		store, err := hashing.NewInMemoryHashStoreWithConfig(hashing.Config{MaxEntries: 1, MaxHashes: 2, SpillDir: dir,
+			Shards: 1, Delay: noDelay, Clock: clock})
+		test.AssertNil(t, err, "store created")
+		defer store.Close()
+
+		_, err = store.SubmitPasswordWithOptions(context.Background(), input, hashing.SubmitOptions{TTL: time.Minute})
+		test.AssertNil(t, err, "hash with ttl accepted")
+		store.Flush()
+		store.ForcePassword(input)
+		store.Flush()
+		test.AssertEqual(t, store.Metrics().Spilled, int64(1), "hash with ttl spilled")
+
+		clock.Advance(time.Minute)
+		store.Sweep(clock.Now())
+		storeMetrics := store.Metrics()
+		test.AssertEqual(t, storeMetrics.Expired, int64(1), "spilled hash expired")
+		test.AssertEqual(t, storeMetrics.Size, int64(1), "expired hash not counted")
+		test.AssertEqual(t, store.ForcePassword(input), hashing.ID("3"), "expired hash no longer counts against the quota")
+		store.Flush()
+
+		clock.Advance(hashing.DefaultExpiredRetention)
+		store.Sweep(clock.Now())
+		_, err = os.Stat(filepath.Join(dir, "1.hash"))
+		test.AssertEqual(t, os.IsNotExist(err), true, "forgotten hash removed from disk")
+		storeMetrics = store.Metrics()
+		test.AssertEqual(t, storeMetrics.Expired, int64(0), "forgotten hash no longer expired")
+		test.AssertEqual(t, storeMetrics.Size, int64(2), "other hashes kept")
+		_, ok := store.GetRecord("1")
+		test.AssertEqual(t, ok, false, "forgotten hash unknown")
+	})
+
+	t.Run("store shards safe for concurrent use", func(t *testing.T) {
+		store, err := hashing.NewInMemoryHashStoreWithConfig(hashing.Config{MaxEntries: 64})
+		test.AssertNil(t, err, "store created")
+		wg := sync.WaitGroup{}
+		for worker := 0; worker < 8; worker++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 1; i <= 50; i++ {
+					store.ForcePassword(input)
+					store.GetRecord(hashing.ID(strconv.Itoa(i)))
+				}
+			}()
+		}
+		wg.Wait()
+		store.Flush()
+
+		storeMetrics := store.Metrics()
+		test.AssertEqual(t, storeMetrics.Size <= 64, true, "budget kept across shards")
+		test.AssertEqual(t, storeMetrics.Size+int64(storeMetrics.Evictions), int64(400), "every hash stored or evicted")
+		_, err = hashing.NewInMemoryHashStoreWithConfig(hashing.Config{Shards: -1})
+		test.AssertNotNil(t, err, "negative shards rejected")
+	})
+
+	t.Run("store budget kept when split unevenly", func(t *testing.T) {
+		store, err := hashing.NewInMemoryHashStoreWithConfig(hashing.Config{MaxEntries: 20, Shards: 16, Delay: noDelay})
+		test.AssertNil(t, err, "store created")
+		for i := 0; i < 100; i++ {
+			store.ForcePassword(input)
+		}
+		store.Flush()
+		test.AssertEqual(t, store.Metrics().Size <= 20, true, "shards never hold more than the budget between them")
+
+		_, err = hashing.NewInMemoryHashStoreWithConfig(hashing.Config{MaxEntries: 10, Shards: 16})
+		test.AssertNotNil(t, err, "fewer entries than shards rejected")
+		_, err = hashing.NewInMemoryHashStoreWithConfig(hashing.Config{MaxBytes: 10, Shards: 16})
+		test.AssertNotNil(t, err, "fewer bytes than shards rejected")
+	})
+
+	t.Run("store expires and deletes hashes", func(t *testing.T) {
+		clock := test.NewFakeClock(epoch)
+		store, err := hashing.NewInMemoryHashStoreWithConfig(hashing.Config{DefaultTTL: time.Hour, MaxHashes: 2,
+			Delay: noDelay, Clock: clock})
+		test.AssertNil(t, err, "store created")
+		defer store.Close()
+		resp, err := store.SubmitPasswordWithOptions(context.Background(), input, hashing.SubmitOptions{TTL: 2 * time.Hour})
+		test.AssertNil(t, err, "hash with its own ttl accepted")
+		test.AssertNotNil(t, resp.ExpiresAt, "expiry returned")
+		forced := store.ForcePassword(input)
+		store.Flush()
+		test.AssertEqual(t, store.GetHash(forced).ExpiresAt.Sub(*resp.ExpiresAt) < -59*time.Minute, true, "default ttl used")
+
+		clock.Advance(90 * time.Minute)
+		store.Sweep(clock.Now())
+		record, ok := store.GetRecord(forced)
+		test.AssertEqual(t, ok, true, "expired record remembered")
+		test.AssertEqual(t, record.Status, hashing.StatusExpired, "record expired")
+		test.AssertEqual(t, record.Hash, "", "expired hash dropped")
+		record, _ = store.GetRecord(resp.ID)
+		test.AssertEqual(t, record.Status, hashing.StatusAvailable, "longer ttl still available")
+		metrics := store.Metrics()
+		test.AssertEqual(t, metrics.Size, int64(1), "expired hash not counted as available")
+		test.AssertEqual(t, metrics.Expired, int64(1), "expired hash counted")
+		test.AssertEqual(t, store.ForcePassword(input) != "", true, "expired hash frees its quota")
+
+		clock.Advance(hashing.DefaultExpiredRetention + 30*time.Minute)
+		store.Sweep(clock.Now())
+		_, ok = store.GetRecord(forced)
+		test.AssertEqual(t, ok, false, "expired record forgotten after retention")
+
+		test.AssertEqual(t, store.DeleteHash(resp.ID), true, "expired hash deleted")
+		test.AssertEqual(t, store.DeleteHash(resp.ID), false, "deleted hash gone")
+		test.AssertEqual(t, store.DeleteHash("99"), false, "unknown hash not deleted")
+	})
+
+	t.Run("deleting a pending hash cancels it", func(t *testing.T) {
+		clock := test.NewFakeClock(epoch)
+		store, err := hashing.NewInMemoryHashStoreWithConfig(hashing.Config{MaxHashes: 1, Clock: clock})
+		test.AssertNil(t, err, "store created")
+		resp, err := store.SubmitPasswordContext(hashing.NewOwnerContext(context.Background(), "alice"), input)
+		test.AssertNil(t, err, "password accepted")
+
+		owner, ok := store.PendingOwner(resp.ID)
+		test.AssertEqual(t, ok, true, "submission pending")
+		test.AssertEqual(t, owner, "alice", "owner of pending submission known")
+		test.AssertEqual(t, store.DeleteHash(resp.ID), true, "pending hash deleted")
+		_, ok = store.PendingOwner(resp.ID)
+		test.AssertEqual(t, ok, false, "submission no longer pending")
+		_, err = store.SubmitPasswordContext(context.Background(), input)
+		test.AssertNil(t, err, "cancelled submission frees its quota")
+
+		clock.BlockUntil(2)
+		clock.Advance(hashing.DefaultDelay)
+		store.Flush()
+		_, ok = store.GetRecord(resp.ID)
+		test.AssertEqual(t, ok, false, "cancelled hash never stored")
+		test.AssertEqual(t, store.Metrics().Size, int64(1), "only the other hash stored")
+	})
+}
+
+func TestTenants(t *testing.T) {
+	t.Run("tenants kept apart", func(t *testing.T) {
+		tenants, err := hashing.NewTenants(hashing.DefaultConfig(), []hashing.Tenant{{Name: "acme", Algorithm: hashing.SHA256}})
+		test.AssertNil(t, err, "tenants created")
+		test.AssertEqual(t, strings.Join(tenants.Names(), ","), "acme,"+hashing.DefaultTenant, "default tenant added")
+
+		acme, ok := tenants.Store("acme")
+		test.AssertEqual(t, ok, true, "acme found")
+		test.AssertEqual(t, acme.ForcePassword(input), hashing.ID("1"), "acme starts at id 1")
+		test.AssertEqual(t, tenants.Default().ForcePassword(input), hashing.ID("1"), "default tenant has its own sequence")
+		tenants.Flush()
+
+		test.AssertEqual(t, acme.GetHash("1").Hash, hashing.GetSHA256Hash(input), "acme uses its own algorithm")
+		test.AssertEqual(t, tenants.Default().GetHash("1").Hash, knownSHA512HashBase64, "default tenant uses sha512")
+		_, ok = tenants.Store("globex")
+		test.AssertEqual(t, ok, false, "unknown tenant not found")
+	})
+
+	t.Run("tenant file read", func(t *testing.T) {
+		list, err := hashing.ReadTenants(strings.NewReader("# name algorithm max\n\nacme sha256 100\nglobex sha512 0\n"))
+		test.AssertNil(t, err, "valid file read")
+		test.AssertEqual(t, len(list), 2, "both tenants read")
+		test.AssertEqual(t, list[0], hashing.Tenant{Name: "acme", Algorithm: hashing.SHA256, MaxHashes: 100}, "acme read")
+		test.AssertEqual(t, list[1], hashing.Tenant{Name: "globex", Algorithm: hashing.SHA512}, "globex read")
+
+		_, err = hashing.ReadTenants(strings.NewReader("acme md5 0\n"))
+		test.AssertNotNil(t, err, "unknown algorithm rejected")
+		_, err = hashing.ReadTenants(strings.NewReader("acme sha256 0\nacme sha512 0\n"))
+		test.AssertNotNil(t, err, "duplicate tenant rejected")
+		_, err = hashing.ReadTenants(strings.NewReader("Acme sha256 0\n"))
+		test.AssertNotNil(t, err, "invalid name rejected")
+	})
+}
+
+func TestDelayPolicy(t *testing.T) {
+	t.Run("policies parsed", func(t *testing.T) {
+		for value, expected := range map[string]hashing.DelayPolicy{
+			"none":     {Kind: hashing.NoDelay},
+			"5s":       {Kind: hashing.FixedDelay, Delay: 5 * time.Second},
+			"0s":       {Kind: hashing.FixedDelay},
+			"3s+4s":    {Kind: hashing.JitteredDelay, Delay: 3 * time.Second, Jitter: 4 * time.Second},
+			"0s+500ms": {Kind: hashing.JitteredDelay, Jitter: 500 * time.Millisecond},
+		} {
+			policy, err := hashing.ParseDelayPolicy(value)
+			test.AssertNil(t, err, value+" parsed")
+			test.AssertEqual(t, policy, expected, value+" read correctly")
+			test.AssertEqual(t, policy.String(), value, value+" written back")
+		}
+	})
+
+	t.Run("invalid policies rejected", func(t *testing.T) {
+		for _, value := range []string{"", "soon", "-1s", "1s+", "1s+-1s"} {
+			_, err := hashing.ParseDelayPolicy(value)
+			test.AssertNotNil(t, err, "'"+value+"' rejected")
+		}
+		_, err := hashing.NewInMemoryHashStoreWithConfig(hashing.Config{Delay: hashing.DelayPolicy{Kind: "eventually"}})
+		test.AssertNotNil(t, err, "unknown kind rejected")
+	})
+}
@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func encodeJSON(fields []Field) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, field := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(field.Key())
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(field.Value())
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprint(field.Value()))
+		}
+		buf.Write(value)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+func encodeLogfmt(fields []Field) []byte {
+	buf := &bytes.Buffer{}
+	for i, field := range fields {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(logfmtKey(field.Key()))
+		buf.WriteByte('=')
+		buf.WriteString(logfmtValue(field.Value()))
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// logfmtKey strips characters that would break a logfmt key
+func logfmtKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+// logfmtValue quotes the value if it contains anything other than plain characters
+func logfmtValue(value interface{}) string {
+	if value == nil {
+		return "null"
+	}
+	str := fmt.Sprint(value)
+	if str == "" {
+		return `""`
+	}
+	if strings.IndexFunc(str, func(r rune) bool { return r <= ' ' || r == '=' || r == '"' || r == '\\' }) >= 0 {
+		return strconv.Quote(str)
+	}
+	return str
+}
@@ -0,0 +1,120 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// redacted replaces the value of any field that could hold a secret
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are field keys whose values are always redacted, no matter what type of value they hold
+var sensitiveKeys = []string{"password", "passwd", "secret", "token", "authorization", "apikey", "api_key"}
+
+// Field is a single key/value pair attached to a log entry. Fields can only be built through the constructors in
+// this package, which only accept simple values; there is deliberately no way to log an arbitrary struct, request
+// or form
+type Field struct {
+	key   string
+	value interface{}
+}
+
+// Secret is a string that must never appear in logs, such as a password. It always formats as [REDACTED], whether
+// it is logged as a field, printed with fmt or marshalled to JSON
+type Secret string
+
+// String hides the secret
+func (Secret) String() string {
+	return redacted
+}
+
+// GoString hides the secret from %#v
+func (Secret) GoString() string {
+	return redacted
+}
+
+// MarshalJSON hides the secret from encoding/json
+func (Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + redacted + `"`), nil
+}
+
+// Reveal returns the underlying secret value. It is the only way to get the value back out
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// String returns a field holding a string
+func String(key string, value string) Field {
+	return Field{key: key, value: value}
+}
+
+// Int returns a field holding an int
+func Int(key string, value int) Field {
+	return Field{key: key, value: value}
+}
+
+// Int64 returns a field holding an int64
+func Int64(key string, value int64) Field {
+	return Field{key: key, value: value}
+}
+
+// Float returns a field holding a float64
+func Float(key string, value float64) Field {
+	return Field{key: key, value: value}
+}
+
+// Bool returns a field holding a bool
+func Bool(key string, value bool) Field {
+	return Field{key: key, value: value}
+}
+
+// Duration returns a field holding a duration, logged in its string form such as "1.5ms"
+func Duration(key string, value time.Duration) Field {
+	return Field{key: key, value: value.String()}
+}
+
+// Time returns a field holding a time, logged in RFC 3339 format
+func Time(key string, value time.Time) Field {
+	return Field{key: key, value: value.UTC().Format(time.RFC3339Nano)}
+}
+
+// Err returns a field holding an error's message under the "error" key
+func Err(err error) Field {
+	if err == nil {
+		return Field{key: "error", value: nil}
+	}
+	return Field{key: "error", value: err.Error()}
+}
+
+// Redacted returns a field that records that a secret was present without revealing it
+func Redacted(key string, _ Secret) Field {
+	return Field{key: key, value: redacted}
+}
+
+// Key returns the field's key
+func (f Field) Key() string {
+	return f.key
+}
+
+// Value returns the field's value as it will be logged
+func (f Field) Value() interface{} {
+	if isSensitive(f.key) {
+		return redacted
+	}
+	return f.value
+}
+
+func isSensitive(key string) bool {
+	lower := strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(lower, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f Field) String() string {
+	return fmt.Sprintf("%s=%v", f.key, f.Value())
+}
@@ -0,0 +1,163 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log entry
+type Level int
+
+const (
+	// DebugLevel is for detail only useful while diagnosing a problem
+	DebugLevel Level = iota
+	// InfoLevel is for routine events, such as the server starting
+	InfoLevel
+	// WarnLevel is for unexpected events the service recovered from
+	WarnLevel
+	// ErrorLevel is for failures
+	ErrorLevel
+)
+
+var levelNames = map[Level]string{
+	DebugLevel: "debug",
+	InfoLevel:  "info",
+	WarnLevel:  "warn",
+	ErrorLevel: "error",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel returns the Level with the given name, such as "info"
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level '%v', must be one of debug, info, warn or error", name)
+}
+
+// Format is the output format of a Logger
+type Format string
+
+const (
+	// JSONFormat writes one JSON object per line
+	JSONFormat Format = "json"
+	// LogfmtFormat writes one line of space separated key=value pairs per entry
+	LogfmtFormat Format = "logfmt"
+)
+
+// ParseFormat returns the Format with the given name
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case JSONFormat, LogfmtFormat:
+		return Format(name), nil
+	}
+	return "", fmt.Errorf("unknown log format '%v', must be '%v' or '%v'", name, JSONFormat, LogfmtFormat)
+}
+
+// Logger writes leveled, structured log entries. Loggers derived with With share their parent's output, so they can
+// be handed out freely and used concurrently
+type Logger struct {
+	out    *syncWriter
+	level  Level
+	format Format
+	fields []Field
+	now    func() time.Time
+}
+
+// syncWriter serializes writes so entries from concurrent loggers never interleave
+type syncWriter struct {
+	w    io.Writer
+	lock sync.Mutex
+}
+
+func (s *syncWriter) Write(bytes []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.w.Write(bytes)
+}
+
+// New returns a Logger writing entries at or above the given level to out in the given format
+func New(out io.Writer, level Level, format Format) *Logger {
+	return &Logger{
+		out:    &syncWriter{w: out},
+		level:  level,
+		format: format,
+		now:    time.Now,
+	}
+}
+
+// Default returns a Logger writing info and above to stdout in logfmt
+func Default() *Logger {
+	return New(os.Stdout, InfoLevel, LogfmtFormat)
+}
+
+// Discard returns a Logger that writes nothing
+func Discard() *Logger {
+	return New(ioutil.Discard, ErrorLevel+1, LogfmtFormat)
+}
+
+// With returns a Logger that adds the given fields to every entry, in addition to any fields this Logger already adds
+func (l *Logger) With(fields ...Field) *Logger {
+	child := *l
+	child.fields = make([]Field, 0, len(l.fields)+len(fields))
+	child.fields = append(child.fields, l.fields...)
+	child.fields = append(child.fields, fields...)
+	return &child
+}
+
+// Enabled returns true if entries at the given level will be written
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+// Debug writes an entry at DebugLevel
+func (l *Logger) Debug(msg string, fields ...Field) {
+	l.log(DebugLevel, msg, fields)
+}
+
+// Info writes an entry at InfoLevel
+func (l *Logger) Info(msg string, fields ...Field) {
+	l.log(InfoLevel, msg, fields)
+}
+
+// Warn writes an entry at WarnLevel
+func (l *Logger) Warn(msg string, fields ...Field) {
+	l.log(WarnLevel, msg, fields)
+}
+
+// Error writes an entry at ErrorLevel
+func (l *Logger) Error(msg string, fields ...Field) {
+	l.log(ErrorLevel, msg, fields)
+}
+
+func (l *Logger) log(level Level, msg string, fields []Field) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	all := make([]Field, 0, 3+len(l.fields)+len(fields))
+	all = append(all, Time("time", l.now()), String("level", level.String()), String("msg", msg))
+	all = append(all, l.fields...)
+	all = append(all, fields...)
+
+	var line []byte
+	if l.format == JSONFormat {
+		line = encodeJSON(all)
+	} else {
+		line = encodeLogfmt(all)
+	}
+	l.out.Write(line)
+}
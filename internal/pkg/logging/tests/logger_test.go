@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/test"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	t.Run("json entries", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		logger := logging.New(out, logging.InfoLevel, logging.JSONFormat)
+		logger.Info("hash stored", logging.Int64("id", 42), logging.Duration("took", 1500*time.Microsecond))
+
+		entry := make(map[string]interface{})
+		err := json.Unmarshal(out.Bytes(), &entry)
+		test.AssertNil(t, err, "entry is valid json")
+		test.AssertEqual(t, entry["level"], "info", "level included")
+		test.AssertEqual(t, entry["msg"], "hash stored", "message included")
+		test.AssertEqual(t, entry["id"], float64(42), "int field included")
+		test.AssertEqual(t, entry["took"], "1.5ms", "duration field included")
+		test.AssertNotNil(t, entry["time"], "time included")
+	})
+
+	t.Run("logfmt entries", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		logger := logging.New(out, logging.InfoLevel, logging.LogfmtFormat)
+		logger.Error("failed", logging.Err(errors.New("disk full")), logging.String("path", "/tmp/stats"))
+
+		line := out.String()
+		test.AssertEqual(t, strings.HasPrefix(line, "time="), true, "time comes first")
+		test.AssertEqual(t, strings.HasSuffix(line, "\n"), true, "one entry per line")
+		test.AssertEqual(t, strings.Contains(line, ` level=error msg=failed error="disk full" path=/tmp/stats`), true,
+			fmt.Sprintf("fields in order and quoted when needed: %v", line))
+	})
+
+	t.Run("entries below level dropped", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		logger := logging.New(out, logging.WarnLevel, logging.LogfmtFormat)
+		logger.Debug("debug")
+		logger.Info("info")
+		test.AssertEqual(t, out.Len(), 0, "nothing written below warn")
+
+		logger.Warn("warn")
+		test.AssertEqual(t, strings.Contains(out.String(), "level=warn"), true, "warn written")
+		test.AssertEqual(t, logger.Enabled(logging.DebugLevel), false, "debug not enabled")
+	})
+
+	t.Run("with adds fields to every entry", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		logger := logging.New(out, logging.InfoLevel, logging.LogfmtFormat)
+		child := logger.With(logging.String("component", "router"))
+		child.Info("first")
+		logger.Info("second")
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		test.AssertEqual(t, len(lines), 2, "both loggers share the output")
+		test.AssertEqual(t, strings.Contains(lines[0], "component=router"), true, "child adds its field")
+		test.AssertEqual(t, strings.Contains(lines[1], "component"), false, "parent is unchanged")
+	})
+
+	t.Run("parse level and format", func(t *testing.T) {
+		level, err := logging.ParseLevel("WARN")
+		test.AssertNil(t, err, "level names are case insensitive")
+		test.AssertEqual(t, level, logging.WarnLevel, "warn parsed")
+
+		_, err = logging.ParseLevel("loud")
+		test.AssertNotNil(t, err, "unknown level rejected")
+
+		_, err = logging.ParseFormat("xml")
+		test.AssertNotNil(t, err, "unknown format rejected")
+	})
+}
+
+func TestSecrets(t *testing.T) {
+	password := logging.Secret("hunter2")
+
+	t.Run("secret never formats", func(t *testing.T) {
+		test.AssertEqual(t, fmt.Sprint(password), "[REDACTED]", "%v hides the secret")
+		test.AssertEqual(t, fmt.Sprintf("%#v", password), "[REDACTED]", "%#v hides the secret")
+		jsonBytes, _ := json.Marshal(struct{ Password logging.Secret }{password})
+		test.AssertEqual(t, strings.Contains(string(jsonBytes), "hunter2"), false, "json hides the secret")
+		test.AssertEqual(t, password.Reveal(), "hunter2", "reveal returns the value")
+	})
+
+	t.Run("secrets and sensitive keys redacted in logs", func(t *testing.T) {
+		for _, format := range []logging.Format{logging.JSONFormat, logging.LogfmtFormat} {
+			out := &bytes.Buffer{}
+			logger := logging.New(out, logging.DebugLevel, format)
+			logger.Info("submitted",
+				logging.Redacted("secret", password),
+				logging.String("password", "hunter2"),
+				logging.String("Authorization", "Bearer hunter2"))
+
+			test.AssertEqual(t, strings.Contains(out.String(), "hunter2"), false,
+				fmt.Sprintf("%v output never contains the password: %v", format, out.String()))
+			test.AssertEqual(t, strings.Count(out.String(), "[REDACTED]"), 3, "each field redacted")
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package tests
+
+import (
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/test"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	test.AssertNil(t, err, "temp dir created")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.log")
+
+	file, err := logging.OpenRotatingFile(path, 10, 2)
+	test.AssertNil(t, err, "file opened")
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err = file.Write([]byte(line))
+		test.AssertNil(t, err, "write succeeds")
+	}
+	test.AssertNil(t, file.Close(), "file closed")
+
+	read := func(name string) string {
+		contents, err := ioutil.ReadFile(filepath.Join(dir, name))
+		test.AssertNil(t, err, name+" exists")
+		return string(contents)
+	}
+	test.AssertEqual(t, read("access.log"), "fourth\n", "current file holds latest write")
+	test.AssertEqual(t, read("access.log.1"), "third\n", "most recent backup")
+	test.AssertEqual(t, read("access.log.2"), "second\n", "oldest backup kept")
+	_, err = os.Stat(filepath.Join(dir, "access.log.3"))
+	test.AssertEqual(t, os.IsNotExist(err), true, "backups beyond the limit dropped")
+
+	_, err = file.Write([]byte("closed"))
+	test.AssertNotNil(t, err, "writes fail once closed")
+}
@@ -0,0 +1,161 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/stats"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContentType is the content type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Type is the type of a metric family
+type Type string
+
+const (
+	// Counter is a value that only ever goes up
+	Counter Type = "counter"
+	// Gauge is a value that can go up or down
+	Gauge Type = "gauge"
+	// Histogram is a set of cumulative buckets along with a sum and count of all observations
+	Histogram Type = "histogram"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, used when reporting duration histograms
+var DefaultBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Family is a named group of samples sharing a type and help text
+type Family struct {
+	Name    string
+	Help    string
+	Type    Type
+	Samples []Sample
+}
+
+// Label is a single name/value pair identifying a sample
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a single value within a family. Suffix is appended to the family name, as needed for the _bucket, _sum
+// and _count samples of a histogram
+type Sample struct {
+	Suffix string
+	Labels []Label
+	Value  float64
+}
+
+// HistogramSamples converts a duration histogram into the cumulative bucket, sum and count samples of a Prometheus
+// histogram using the given bucket upper bounds, in seconds. Bucket counts are estimated from the bucket resolution
+// of the snapshot
+func HistogramSamples(labels []Label, snap stats.HistogramSnapshot, bounds []float64) []Sample {
+	samples := make([]Sample, 0, len(bounds)+3)
+	for _, bound := range bounds {
+		upTo := time.Duration(bound * float64(time.Second))
+		samples = append(samples, Sample{
+			Suffix: "_bucket",
+			Labels: withLabel(labels, "le", formatValue(bound)),
+			Value:  float64(snap.CountAtOrBelow(upTo)),
+		})
+	}
+	samples = append(samples,
+		Sample{Suffix: "_bucket", Labels: withLabel(labels, "le", "+Inf"), Value: float64(snap.Count)},
+		Sample{Suffix: "_sum", Labels: labels, Value: snap.Total.Seconds()},
+		Sample{Suffix: "_count", Labels: labels, Value: float64(snap.Count)},
+	)
+	return samples
+}
+
+func withLabel(labels []Label, name string, value string) []Label {
+	combined := make([]Label, len(labels), len(labels)+1)
+	copy(combined, labels)
+	return append(combined, Label{Name: name, Value: value})
+}
+
+// WriteText writes the given families in the Prometheus text exposition format. Families sharing a name are
+// combined, and families are written in name order
+func WriteText(w io.Writer, families []Family) error {
+	buf := bufio.NewWriter(w)
+	for _, family := range mergeFamilies(families) {
+		fmt.Fprintf(buf, "# HELP %s %s\n", family.Name, escapeHelp(family.Help))
+		fmt.Fprintf(buf, "# TYPE %s %s\n", family.Name, family.Type)
+		for _, sample := range family.Samples {
+			buf.WriteString(family.Name)
+			buf.WriteString(sample.Suffix)
+			writeLabels(buf, sample.Labels)
+			buf.WriteByte(' ')
+			buf.WriteString(formatValue(sample.Value))
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Flush()
+}
+
+func mergeFamilies(families []Family) []Family {
+	byName := make(map[string]*Family)
+	names := make([]string, 0, len(families))
+	for _, family := range families {
+		existing, ok := byName[family.Name]
+		if !ok {
+			copied := family
+			byName[family.Name] = &copied
+			names = append(names, family.Name)
+			continue
+		}
+		existing.Samples = append(existing.Samples, family.Samples...)
+	}
+
+	sort.Strings(names)
+	merged := make([]Family, len(names))
+	for i, name := range names {
+		merged[i] = *byName[name]
+	}
+	return merged
+}
+
+func writeLabels(buf *bufio.Writer, labels []Label) {
+	if len(labels) == 0 {
+		return
+	}
+	buf.WriteByte('{')
+	for i, label := range labels {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(label.Name)
+		buf.WriteString(`="`)
+		buf.WriteString(escapeLabelValue(label.Value))
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('}')
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Collector is anything able to report its current metrics
+type Collector interface {
+	Collect() []Family
+}
+
+// CollectorFunc adapts a plain function into a Collector
+type CollectorFunc func() []Family
+
+// Collect calls the underlying function
+func (f CollectorFunc) Collect() []Family {
+	return f()
+}
+
+// Registry gathers metrics from any number of collectors
+type Registry struct {
+	collectors []Collector
+	lock       sync.Mutex
+}
+
+// NewRegistry returns a new Registry with no collectors
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a collector to the registry
+func (r *Registry) Register(collector Collector) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.collectors = append(r.collectors, collector)
+}
+
+// Gather collects the current metrics from every registered collector
+func (r *Registry) Gather() []Family {
+	r.lock.Lock()
+	collectors := make([]Collector, len(r.collectors))
+	copy(collectors, r.collectors)
+	r.lock.Unlock()
+
+	families := make([]Family, 0)
+	for _, collector := range collectors {
+		families = append(families, collector.Collect()...)
+	}
+	return families
+}
+
+// WriteText writes every registered collector's metrics in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	return WriteText(w, r.Gather())
+}
+
+// Handler returns an http.HandlerFunc serving the registry in the Prometheus text exposition format. Failures to
+// write the response are reported to the given logger
+func (r *Registry) Handler(logger *logging.Logger) http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			writer.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		writer.Header().Set("Content-Type", ContentType)
+		writer.WriteHeader(http.StatusOK)
+		if err := r.WriteText(writer); err != nil {
+			logger.Warn("failed to write metrics", logging.Err(err))
+		}
+	}
+}
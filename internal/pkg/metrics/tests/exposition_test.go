@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"bytes"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/metrics"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/stats"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/test"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestExposition(t *testing.T) {
+	t.Run("counter with labels", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		err := metrics.WriteText(buf, []metrics.Family{{
+			Name: "requests_total",
+			Help: "Total requests.",
+			Type: metrics.Counter,
+			Samples: []metrics.Sample{
+				{Labels: []metrics.Label{{Name: "route", Value: "/hash"}}, Value: 3},
+			},
+		}})
+		test.AssertNil(t, err, "write should not error")
+		test.AssertEqual(t, buf.String(), "# HELP requests_total Total requests.\n"+
+			"# TYPE requests_total counter\n"+
+			"requests_total{route=\"/hash\"} 3\n", "counter exposition")
+	})
+
+	t.Run("escaping", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		err := metrics.WriteText(buf, []metrics.Family{{
+			Name: "odd",
+			Help: "back\\slash\nnewline",
+			Type: metrics.Gauge,
+			Samples: []metrics.Sample{
+				{Labels: []metrics.Label{{Name: "path", Value: "a\"b\\c\nd"}}, Value: math.Inf(1)},
+			},
+		}})
+		test.AssertNil(t, err, "write should not error")
+		test.AssertEqual(t, buf.String(), "# HELP odd back\\\\slash\\nnewline\n"+
+			"# TYPE odd gauge\n"+
+			"odd{path=\"a\\\"b\\\\c\\nd\"} +Inf\n", "help and label values escaped")
+	})
+
+	t.Run("families merged and sorted", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		err := metrics.WriteText(buf, []metrics.Family{
+			{Name: "b", Help: "b", Type: metrics.Gauge, Samples: []metrics.Sample{{Value: 1}}},
+			{Name: "a", Help: "a", Type: metrics.Gauge, Samples: []metrics.Sample{{Labels: []metrics.Label{{Name: "x", Value: "1"}}, Value: 1}}},
+			{Name: "a", Help: "a", Type: metrics.Gauge, Samples: []metrics.Sample{{Labels: []metrics.Label{{Name: "x", Value: "2"}}, Value: 2}}},
+		})
+		test.AssertNil(t, err, "write should not error")
+		test.AssertEqual(t, buf.String(), "# HELP a a\n# TYPE a gauge\na{x=\"1\"} 1\na{x=\"2\"} 2\n"+
+			"# HELP b b\n# TYPE b gauge\nb 1\n", "one header per family in name order")
+	})
+
+	t.Run("histogram samples", func(t *testing.T) {
+		hist := stats.NewHistogram()
+		hist.Record(50 * time.Microsecond)
+		hist.Record(2 * time.Millisecond)
+		hist.Record(2 * time.Second)
+
+		samples := metrics.HistogramSamples(nil, hist.Snapshot(), []float64{0.001, 0.01, 1})
+		test.AssertEqual(t, len(samples), 6, "three bounds, +Inf, sum and count")
+		test.AssertEqual(t, samples[0].Value, 1.0, "one observation under 1ms")
+		test.AssertEqual(t, samples[1].Value, 2.0, "two observations under 10ms")
+		test.AssertEqual(t, samples[2].Value, 2.0, "two observations under 1s")
+		test.AssertEqual(t, samples[3].Labels[0].Value, "+Inf", "+Inf bucket")
+		test.AssertEqual(t, samples[3].Value, 3.0, "everything under +Inf")
+		test.AssertEqual(t, samples[4].Suffix, "_sum", "sum sample")
+		test.AssertEqual(t, samples[4].Value, 2.00205, "sum in seconds")
+		test.AssertEqual(t, samples[5].Value, 3.0, "count sample")
+	})
+
+	t.Run("registry gathers collectors", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+		registry.Register(metrics.CollectorFunc(func() []metrics.Family {
+			return []metrics.Family{{Name: "up", Help: "Up.", Type: metrics.Gauge, Samples: []metrics.Sample{{Value: 1}}}}
+		}))
+
+		buf := &bytes.Buffer{}
+		err := registry.WriteText(buf)
+		test.AssertNil(t, err, "write should not error")
+		test.AssertEqual(t, buf.String(), "# HELP up Up.\n# TYPE up gauge\nup 1\n", "collector output written")
+	})
+}
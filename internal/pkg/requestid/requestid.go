@@ -0,0 +1,57 @@
+// Package requestid assigns and carries the ID used to correlate everything done on behalf of a single request
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+)
+
+// Header is the HTTP header a request ID is read from and echoed back on
+const Header = "X-Request-ID"
+
+// maxLength bounds the length of an incoming request ID that will be honored
+const maxLength = 128
+
+type contextKey struct{}
+
+// New returns a new random request ID
+func New() string {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		// crypto/rand only fails if the OS has no source of randomness, in which case there is nothing better to do
+		panic(err)
+	}
+	return hex.EncodeToString(bytes)
+}
+
+// Valid returns true if the given ID is safe to honor: non-empty, reasonably short and made only of printable ASCII
+// without spaces, so it can't be used to forge log lines or headers
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' || id[i] == '"' {
+			return false
+		}
+	}
+	return true
+}
+
+// NewContext returns a copy of ctx carrying the given request ID
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID carried by ctx, or an empty string if there is none
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Field returns a log field holding the request ID carried by ctx
+func Field(ctx context.Context) logging.Field {
+	return logging.String("requestId", FromContext(ctx))
+}
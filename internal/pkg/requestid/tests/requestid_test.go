@@ -0,0 +1,34 @@
+package tests
+
+import (
+	"context"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/requestid"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/test"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	t.Run("new ids are unique and valid", func(t *testing.T) {
+		first := requestid.New()
+		second := requestid.New()
+		test.AssertEqual(t, len(first), 32, "128 bits of hex")
+		test.AssertEqual(t, first != second, true, "ids differ")
+		test.AssertEqual(t, requestid.Valid(first), true, "generated id valid")
+	})
+
+	t.Run("unsafe ids rejected", func(t *testing.T) {
+		test.AssertEqual(t, requestid.Valid(""), false, "empty rejected")
+		test.AssertEqual(t, requestid.Valid("has space"), false, "spaces rejected")
+		test.AssertEqual(t, requestid.Valid("line\nbreak"), false, "control characters rejected")
+		test.AssertEqual(t, requestid.Valid(strings.Repeat("a", 129)), false, "long ids rejected")
+		test.AssertEqual(t, requestid.Valid("client-id_1.2"), true, "printable id honored")
+	})
+
+	t.Run("carried on context", func(t *testing.T) {
+		test.AssertEqual(t, requestid.FromContext(context.Background()), "", "no id by default")
+		ctx := requestid.NewContext(context.Background(), "abc")
+		test.AssertEqual(t, requestid.FromContext(ctx), "abc", "id read back")
+		test.AssertEqual(t, requestid.Field(ctx).Value(), "abc", "id logged")
+	})
+}
@@ -0,0 +1,164 @@
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/clock"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/requestid"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AccessLogFormat is the line format written by an AccessLog
+type AccessLogFormat string
+
+const (
+	// CombinedFormat is the Apache Combined Log Format, followed by the matched pattern, the duration in
+	// microseconds and the request ID
+	CombinedFormat AccessLogFormat = "combined"
+	// JSONLinesFormat writes one AccessEntry JSON object per line
+	JSONLinesFormat AccessLogFormat = "json"
+
+	// combinedTimeLayout is the timestamp layout used by the Apache log formats
+	combinedTimeLayout = "02/Jan/2006:15:04:05 -0700"
+)
+
+// ParseAccessLogFormat returns the AccessLogFormat with the given name
+func ParseAccessLogFormat(name string) (AccessLogFormat, error) {
+	switch AccessLogFormat(name) {
+	case CombinedFormat, JSONLinesFormat:
+		return AccessLogFormat(name), nil
+	}
+	return "", fmt.Errorf("unknown access log format '%v', must be '%v' or '%v'", name, CombinedFormat, JSONLinesFormat)
+}
+
+// AccessEntry describes a single request served by the router
+type AccessEntry struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Method     string    `json:"method"`
+	// Path is the path sent by the client, still escaped so characters such as newlines and quotes can't forge log
+	// lines. The query string is left out as it may carry form values such as passwords
+	Path     string `json:"path"`
+	Pattern  string `json:"pattern"`
+	Protocol string `json:"protocol"`
+	Status   int    `json:"status"`
+	Bytes    int64  `json:"bytes"`
+	// DurationMicroSec is the time taken to serve the request, in microseconds
+	DurationMicroSec int64  `json:"durationMicroSec"`
+	RequestID        string `json:"requestId"`
+	Referer          string `json:"referer"`
+	UserAgent        string `json:"userAgent"`
+}
+
+// AccessLog writes a line for every request served by the router it is used with
+type AccessLog struct {
+	out    io.Writer
+	format AccessLogFormat
+	clock  clock.Clock
+	lock   sync.Mutex
+}
+
+// NewAccessLog returns an AccessLog writing lines in the given format to out
+func NewAccessLog(out io.Writer, format AccessLogFormat) *AccessLog {
+	return NewAccessLogWithClock(out, format, clock.System)
+}
+
+// NewAccessLogWithClock returns an AccessLog writing lines in the given format to out, timing requests with the
+// provided clock
+func NewAccessLogWithClock(out io.Writer, format AccessLogFormat, logClock clock.Clock) *AccessLog {
+	return &AccessLog{out: out, format: format, clock: logClock}
+}
+
+// Middleware returns middleware that logs every request once it has been served. It must run inside the RequestID
+// middleware for request IDs to be logged
+func (a *AccessLog) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		start := a.clock.Now()
+		recorder := newStatusRecorder(writer)
+		next.ServeHTTP(recorder, req)
+
+		a.Log(AccessEntry{
+			Time:             start,
+			RemoteAddr:       remoteHost(req.RemoteAddr),
+			Method:           req.Method,
+			Path:             escapedOriginalPath(req),
+			Pattern:          MatchedPattern(req),
+			Protocol:         req.Proto,
+			Status:           recorder.Status(),
+			Bytes:            recorder.BytesWritten(),
+			DurationMicroSec: a.clock.Since(start).Microseconds(),
+			RequestID:        requestid.FromContext(req.Context()),
+			Referer:          req.Referer(),
+			UserAgent:        req.UserAgent(),
+		})
+	})
+}
+
+// Log writes a single entry
+func (a *AccessLog) Log(entry AccessEntry) error {
+	var line []byte
+	if a.format == JSONLinesFormat {
+		var err error
+		line, err = json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+	} else {
+		line = []byte(combinedLine(entry))
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	_, err := a.out.Write(line)
+	return err
+}
+
+func combinedLine(entry AccessEntry) string {
+	return fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %s %s %s %s %d %s\n",
+		orDash(entry.RemoteAddr),
+		entry.Time.Format(combinedTimeLayout),
+		entry.Method, entry.Path, entry.Protocol,
+		entry.Status,
+		bytesField(entry.Bytes),
+		quote(entry.Referer),
+		quote(entry.UserAgent),
+		quote(entry.Pattern),
+		entry.DurationMicroSec,
+		orDash(entry.RequestID))
+}
+
+// bytesField follows the Apache convention of logging an empty body as a dash
+func bytesField(bytes int64) string {
+	if bytes == 0 {
+		return "-"
+	}
+	return strconv.FormatInt(bytes, 10)
+}
+
+func quote(value string) string {
+	if value == "" {
+		return `"-"`
+	}
+	return strconv.Quote(value)
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
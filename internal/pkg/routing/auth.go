@@ -0,0 +1,64 @@
+package routing
+
+import (
+	"fmt"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/auth"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/requestid"
+	"net/http"
+	"strings"
+)
+
+const (
+	// APIKeyHeader is the header an API key can be sent in, as an alternative to an Authorization bearer token
+	APIKeyHeader = "X-API-Key"
+
+	bearerPrefix = "Bearer "
+)
+
+// authenticate returns middleware requiring a valid API key with the route's scope for every route registered with
+// one. The authenticated principal is carried on the request context. Routes without a scope are open to anyone,
+// though a key sent to one must still be valid
+func (r *Router) authenticate(keys *auth.KeyStore) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+			scope := r.scope(MatchedPattern(req), req.Method)
+			key := apiKey(req)
+			if key == "" && scope == "" {
+				next.ServeHTTP(writer, req)
+				return
+			}
+
+			principal, ok := keys.Authenticate(key)
+			if !ok {
+				r.logger.Info("request rejected with missing or invalid api key", requestid.Field(req.Context()),
+					logging.Bool("keySent", key != ""), logging.Redacted("apiKey", key))
+				writer.Header().Set("WWW-Authenticate", `Bearer realm="hash"`)
+				WriteError(writer, req, http.StatusUnauthorized, ErrorResponse{Error: "missing or invalid API key"})
+				return
+			}
+			if scope != "" && !principal.HasScope(scope) {
+				r.logger.Info("request rejected for missing scope", requestid.Field(req.Context()),
+					logging.String("principal", principal.Name), logging.String("scope", string(scope)))
+				WriteError(writer, req, http.StatusForbidden, ErrorResponse{
+					Error: fmt.Sprintf("API key for '%v' lacks the '%v' scope", principal.Name, scope),
+				})
+				return
+			}
+
+			next.ServeHTTP(writer, req.WithContext(auth.NewContext(req.Context(), principal)))
+		})
+	}
+}
+
+// apiKey returns the key sent in the X-API-Key header or as an Authorization bearer token
+func apiKey(req *http.Request) logging.Secret {
+	if key := req.Header.Get(APIKeyHeader); key != "" {
+		return logging.Secret(key)
+	}
+	authorization := req.Header.Get("Authorization")
+	if strings.HasPrefix(authorization, bearerPrefix) {
+		return logging.Secret(strings.TrimSpace(authorization[len(bearerPrefix):]))
+	}
+	return ""
+}
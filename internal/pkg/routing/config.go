@@ -0,0 +1,59 @@
+package routing
+
+import (
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/auth"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/clock"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/stats"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/tracing"
+	"io"
+)
+
+const (
+	// DefaultMaxTrackedMisses is the number of distinct unmatched paths tracked unless configured otherwise
+	DefaultMaxTrackedMisses = 20
+)
+
+// Config holds the tunable limits of a Router
+type Config struct {
+	// Address is the host name or IP address the router listens on. Every interface is listened on when empty
+	Address string
+
+	// MaxStatsEntries bounds the number of distinct route and method combinations that stats are kept for. Anything
+	// beyond the limit is folded into a single overflow entry
+	MaxStatsEntries int
+	// MaxTrackedMisses bounds the number of distinct unmatched paths that are counted individually
+	MaxTrackedMisses int
+
+	// SnapshotDir is the directory stats snapshots are written to. Snapshots are disabled when empty
+	SnapshotDir string
+	// SnapshotFormat is the default format of stats snapshots
+	SnapshotFormat stats.ExportFormat
+
+	// AccessLog receives a line for every request served. Access logging is disabled when nil
+	AccessLog io.Writer
+	// AccessLogFormat is the format of access log lines
+	AccessLogFormat AccessLogFormat
+
+	// Keys are the API keys accepted by routes registered with a scope. Authentication is disabled when nil
+	Keys *auth.KeyStore
+
+	// Tracer records a span for every request served. Tracing is disabled when nil
+	Tracer *tracing.Tracer
+
+	// Logger receives the router's log entries. The default logger is used when nil
+	Logger *logging.Logger
+
+	// Clock times requests for stats and access logs. The system clock is used when nil
+	Clock clock.Clock
+}
+
+// DefaultConfig returns the Config used by NewRouter
+func DefaultConfig() Config {
+	return Config{
+		MaxStatsEntries:  stats.DefaultMaxItems,
+		MaxTrackedMisses: DefaultMaxTrackedMisses,
+		SnapshotFormat:   stats.JSONFormat,
+		AccessLogFormat:  CombinedFormat,
+	}
+}
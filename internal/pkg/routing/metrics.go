@@ -0,0 +1,140 @@
+package routing
+
+import (
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/auth"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/metrics"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/stats"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// requestKey identifies a single route, method and response status combination
+type requestKey struct {
+	route  string
+	method string
+	status int
+}
+
+// countRequest increments the number of requests seen for the given route, method and status
+func (r *Router) countRequest(route string, method string, status int) {
+	key := requestKey{route: r.countedRoute(route, method), method: method, status: status}
+	counter, ok := r.requestCounts.Load(key)
+	if !ok {
+		counter, _ = r.requestCounts.LoadOrStore(key, new(uint64))
+	}
+	atomic.AddUint64(counter.(*uint64), 1)
+}
+
+// countedRoute returns the route that requests for the given route and method are counted under. Anything other than
+// a registered pattern or the not found route is folded into stats.OverflowName, as is any new route once counts
+// are being kept for config.MaxStatsEntries route and method combinations, matching the bound on the stats table
+func (r *Router) countedRoute(route string, method string) string {
+	if _, registered := r.registeredPaths[route]; !registered && route != notFoundRoute {
+		return stats.OverflowName
+	}
+	name := statsName(route, method)
+	if _, ok := r.countedRoutes.Load(name); ok {
+		return route
+	}
+
+	// reserve a place for the new route before storing it so concurrent callers can never exceed the limit
+	for {
+		count := atomic.LoadInt64(&r.countedRouteCount)
+		if count >= int64(r.config.MaxStatsEntries) {
+			return stats.OverflowName
+		}
+		if atomic.CompareAndSwapInt64(&r.countedRouteCount, count, count+1) {
+			break
+		}
+	}
+	if _, loaded := r.countedRoutes.LoadOrStore(name, struct{}{}); loaded {
+		// another caller stored the same route first, give back the reservation
+		atomic.AddInt64(&r.countedRouteCount, -1)
+	}
+	return route
+}
+
+// Collect reports request counts by route, method and status along with request duration histograms by route and
+// method, allowing the router to be registered with a metrics.Registry
+func (r *Router) Collect() []metrics.Family {
+	requests := metrics.Family{
+		Name: "http_requests_total",
+		Help: "Total HTTP requests by route, method and response status.",
+		Type: metrics.Counter,
+	}
+	r.requestCounts.Range(func(key, value interface{}) bool {
+		k := key.(requestKey)
+		requests.Samples = append(requests.Samples, metrics.Sample{
+			Labels: []metrics.Label{
+				{Name: "route", Value: k.route},
+				{Name: "method", Value: k.method},
+				{Name: "status", Value: strconv.Itoa(k.status)},
+			},
+			Value: float64(atomic.LoadUint64(value.(*uint64))),
+		})
+		return true
+	})
+	sortSamples(requests.Samples)
+
+	durations := metrics.Family{
+		Name: "http_request_duration_seconds",
+		Help: "Time taken to serve HTTP requests by route and method.",
+		Type: metrics.Histogram,
+	}
+	snapshots := r.stats.GetSnapshots()
+	names := make([]string, 0, len(snapshots))
+	for name := range snapshots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		route, method := splitStatsName(name)
+		labels := []metrics.Label{{Name: "route", Value: route}, {Name: "method", Value: method}}
+		durations.Samples = append(durations.Samples, metrics.HistogramSamples(labels, snapshots[name], metrics.DefaultBuckets)...)
+	}
+
+	return []metrics.Family{requests, durations}
+}
+
+// RegisterMetricsEndpoint registers an endpoint serving the given registry in the Prometheus text exposition format
+func (r *Router) RegisterMetricsEndpoint(registry *metrics.Registry) {
+	r.RegisterRoutes(r.MetricsEndpoints(registry))
+}
+
+// MetricsEndpoints returns the route of an endpoint serving the given registry, so it can be registered with another
+// router such as one listening on an admin port
+func (r *Router) MetricsEndpoints(registry *metrics.Registry) []Route {
+	return []Route{
+		{Path: "/metrics", Methods: []string{http.MethodGet}, Handler: registry.Handler(r.logger), Scope: auth.ScopeAdmin},
+	}
+}
+
+// statsName returns the name stats are tracked under for the given route and method
+func statsName(route string, method string) string {
+	return route + " " + method
+}
+
+// splitStatsName reverses statsName
+func splitStatsName(name string) (string, string) {
+	i := strings.LastIndex(name, " ")
+	if i < 0 {
+		return name, ""
+	}
+	return name[:i], name[i+1:]
+}
+
+func sortSamples(samples []metrics.Sample) {
+	key := func(sample metrics.Sample) string {
+		parts := make([]string, len(sample.Labels))
+		for i, label := range sample.Labels {
+			parts[i] = label.Value
+		}
+		return strings.Join(parts, "\x00")
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return key(samples[i]) < key(samples[j])
+	})
+}
@@ -0,0 +1,81 @@
+package routing
+
+import (
+	"context"
+	"net/http"
+)
+
+// Middleware wraps the router's handling of every request, running before and after the matched handler
+type Middleware func(next http.Handler) http.Handler
+
+type contextKey int
+
+const routeMatchKey contextKey = iota
+
+// routeMatch records how the router resolved a request, before any middleware runs
+type routeMatch struct {
+	// path is the request path as sent by the client, before any path parameters were parsed out of it
+	path string
+	// escapedPath is path as it appeared in the request line, with any escapes such as %0A still in place
+	escapedPath string
+	// params holds the path parameters parsed out of path, by name
+	params map[string]string
+	// pattern is the registered pattern the path matched, empty if it matched none
+	pattern string
+	// route is the name stats for the request are recorded under
+	route string
+	// panicked is set if the handler panicked while serving the request
+	panicked bool
+}
+
+// Use adds middleware around every request served by this router. The first middleware added is the outermost.
+// Handlers are recovered inside the middleware so a panicking handler still produces a response for it to see, and
+// the whole chain is recovered again so a panic in the middleware itself doesn't drop the connection.
+// Middleware must be added before the router starts serving
+func (r *Router) Use(middleware ...Middleware) {
+	r.middleware = append(r.middleware, middleware...)
+
+	handler := r.recoverPanics(http.HandlerFunc(r.dispatch))
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		handler = r.middleware[i](handler)
+	}
+	r.handler = r.recoverPanics(handler)
+}
+
+// MatchedPattern returns the registered pattern the request was routed to, or an empty string if it matched no route
+func MatchedPattern(req *http.Request) string {
+	if match, ok := req.Context().Value(routeMatchKey).(*routeMatch); ok {
+		return match.pattern
+	}
+	return ""
+}
+
+// PathParam returns the value of the named parameter in the request's path, or an empty string if the path has no such
+// parameter. Unlike the request's form, which the parameters are also added to, it can't be set by query or body values
+func PathParam(req *http.Request, name string) string {
+	if match, ok := req.Context().Value(routeMatchKey).(*routeMatch); ok {
+		return match.params[name]
+	}
+	return ""
+}
+
+// OriginalPath returns the request path as sent by the client. The router replaces the request's path with the
+// matched pattern once path parameters are parsed out of it
+func OriginalPath(req *http.Request) string {
+	if match, ok := req.Context().Value(routeMatchKey).(*routeMatch); ok {
+		return match.path
+	}
+	return req.URL.Path
+}
+
+// escapedOriginalPath is OriginalPath with any escapes left in place, so it can't break up a log line
+func escapedOriginalPath(req *http.Request) string {
+	if match, ok := req.Context().Value(routeMatchKey).(*routeMatch); ok {
+		return match.escapedPath
+	}
+	return req.URL.EscapedPath()
+}
+
+func withRouteMatch(req *http.Request, match *routeMatch) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), routeMatchKey, match))
+}
@@ -3,17 +3,27 @@ package routing
 import (
 	"net/http"
 	"regexp"
+	"sort"
 	"strings"
 )
 
 var pathParamRegex = regexp.MustCompile(`\{(.+?)\}`)
 
+// Constraint restricts the values a path parameter matches. A request whose parameter doesn't satisfy the constraint
+// doesn't match the path at all
+type Constraint struct {
+	// Name describes the values allowed, such as "ulid", and is listed by the routes endpoint
+	Name  string
+	Match func(segment string) bool
+}
+
 // ParameterizedPath holds information regarding how to pull data from a parameterized URL path
 type ParameterizedPath struct {
 	Path string
 	Length int
 	Route map[int]string // map of path index -> path segment
 	Subs map[int]string // map of path index -> parameter name
+	Constraints map[int]Constraint // map of path index -> constraint on the parameter
 }
 
 func (p *ParameterizedPath) matches(path []string) bool {
@@ -26,9 +36,25 @@ func (p *ParameterizedPath) matches(path []string) bool {
 			return false
 		}
 	}
+	for i, constraint := range p.Constraints {
+		if !constraint.Match(path[i]) {
+			return false
+		}
+	}
 	return true
 }
 
+// Constrain restricts the values the named parameter matches, returning false if the path has no such parameter
+func (p *ParameterizedPath) Constrain(name string, constraint Constraint) bool {
+	for i, sub := range p.Subs {
+		if sub == name {
+			p.Constraints[i] = constraint
+			return true
+		}
+	}
+	return false
+}
+
 // ParseRequest first checks of the given request matches this parameterized path. If it
 // matches, it will parse the appropriate path parameters into the request form and returns
 // true. Otherwise, does nothing and returns false.
@@ -46,6 +72,48 @@ func (p *ParameterizedPath) ParseRequest(req *http.Request) bool {
 	return true
 }
 
+// params returns the value of each parameter in the given path, which must match this path
+func (p *ParameterizedPath) params(path []string) map[string]string {
+	values := make(map[string]string, len(p.Subs))
+	for i, name := range p.Subs {
+		values[name] = path[i]
+	}
+	return values
+}
+
+// ParamNames returns the names of all parameters in this path, in the order they appear
+func (p *ParameterizedPath) ParamNames() []string {
+	indices := make([]int, 0, len(p.Subs))
+	for i := range p.Subs {
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+
+	names := make([]string, len(indices))
+	for i, index := range indices {
+		names[i] = p.Subs[index]
+	}
+	return names
+}
+
+// fill returns this path with each parameter replaced by the segment found at the same index of the given path. If
+// the lengths do not line up, the pattern is returned unchanged
+func (p *ParameterizedPath) fill(path []string) string {
+	if p.Length != len(path) {
+		return p.Path
+	}
+
+	segments := make([]string, p.Length)
+	for i := range segments {
+		if _, ok := p.Subs[i]; ok {
+			segments[i] = path[i]
+		} else {
+			segments[i] = p.Route[i]
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
 // IsParameterizedPath returns true if the given string contains parameters, false otherwise
 func IsParameterizedPath(path string) bool {
 	return pathParamRegex.MatchString(path)
@@ -59,6 +127,7 @@ func ParseParameterizedPath(path string) *ParameterizedPath {
 		Path: path,
 		Subs: make(map[int]string),
 		Route: make(map[int]string),
+		Constraints: make(map[int]Constraint),
 		Length: len(segments),
 	}
 
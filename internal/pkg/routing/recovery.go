@@ -0,0 +1,50 @@
+package routing
+
+import (
+	"fmt"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/requestid"
+	"net/http"
+	"runtime/debug"
+)
+
+// recoverPanics wraps a handler, turning a panic into a 500 JSON error response instead of net/http dropping the
+// connection. The panic and its stack are logged with the request ID and counted against the request's route in
+// stats. If the response has already started it can't be replaced, so the handler is aborted with
+// http.ErrAbortHandler and net/http cuts the response short rather than leaving the client a truncated success
+func (r *Router) recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		recorder := newStatusRecorder(writer)
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				// the handler is deliberately aborting the response, which net/http handles quietly
+				panic(recovered)
+			}
+			if id := writer.Header().Get(requestid.Header); requestid.FromContext(req.Context()) == "" && id != "" {
+				// the panic came from middleware wrapping the request ID, so take the ID it already sent back
+				req = req.WithContext(requestid.NewContext(req.Context(), id))
+			}
+
+			if match, ok := req.Context().Value(routeMatchKey).(*routeMatch); ok {
+				match.panicked = true
+			}
+			r.logger.Error("panic while serving request",
+				requestid.Field(req.Context()),
+				logging.String("method", req.Method),
+				logging.String("path", OriginalPath(req)),
+				logging.String("panic", fmt.Sprint(recovered)),
+				logging.String("stack", string(debug.Stack())))
+
+			if recorder.status != 0 {
+				// the response has already started, so there is no way to replace it with an error
+				panic(http.ErrAbortHandler)
+			}
+			WriteError(recorder, req, http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		}()
+		next.ServeHTTP(recorder, req)
+	})
+}
@@ -0,0 +1,19 @@
+package routing
+
+import (
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/requestid"
+	"net/http"
+)
+
+// RequestID is middleware that gives every request an ID, honoring a valid X-Request-ID sent by the client and
+// assigning a new one otherwise. The ID is carried on the request context and echoed back in the response headers
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+		writer.Header().Set(requestid.Header, id)
+		next.ServeHTTP(writer, req.WithContext(requestid.NewContext(req.Context(), id)))
+	})
+}
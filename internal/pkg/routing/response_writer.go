@@ -0,0 +1,46 @@
+package routing
+
+import "net/http"
+
+// statusRecorder wraps an http.ResponseWriter to remember the status code and number of bytes sent to the client
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func newStatusRecorder(writer http.ResponseWriter) *statusRecorder {
+	return &statusRecorder{ResponseWriter: writer}
+}
+
+// WriteHeader records the status code before passing it along. Only the first call is recorded, as that is the
+// only one net/http honors
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Write passes the bytes along, recording an implicit 200 if no status was written first
+func (s *statusRecorder) Write(bytes []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(bytes)
+	s.bytes += int64(n)
+	return n, err
+}
+
+// Status returns the status code sent to the client. A handler that never writes anything results in a 200
+func (s *statusRecorder) Status() int {
+	if s.status == 0 {
+		return http.StatusOK
+	}
+	return s.status
+}
+
+// BytesWritten returns the number of body bytes sent to the client
+func (s *statusRecorder) BytesWritten() int64 {
+	return s.bytes
+}
@@ -4,59 +4,257 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/auth"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/clock"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/requestid"
 	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/stats"
+	"net"
 	"net/http"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 // Router holds route and server state
 type Router struct {
+	// countedRouteCount is first in the struct to guarantee 64-bit alignment for atomic operations
+	countedRouteCount int64 // number of route and method combinations in countedRoutes
 	mux *http.ServeMux
 	registeredPaths map[string]http.HandlerFunc
+	routeMethods map[string][]string
+	routeScopes map[string]auth.Scope
+	routeMethodScopes map[string]map[string]auth.Scope
+	routeConstraints map[string]map[string]Constraint
 	paramPaths []*ParameterizedPath
+	middleware []Middleware
+	handler http.Handler
 
 	stats *stats.AverageTracker
+	requestCounts sync.Map // map of requestKey -> *uint64
+	countedRoutes sync.Map // map of stats name -> struct{}, the route and method combinations requests are counted for
+	misses *stats.TopK
+	statsSections map[string]*stats.AverageTracker
+	statsGauges map[string]func() map[string]int64
+	config Config
+	logger *logging.Logger
+	clock clock.Clock
 
 	port int
 	srv *http.Server
+	// listener is the bound port, set by Listen or otherwise by Serve
+	listener net.Listener
 	errChan chan error
 }
 
+// Route describes a single path pattern along with the methods it accepts and the handler that serves it.
+// An empty Methods list allows any method through to the handler. When the router has API keys configured, calling
+// the route requires a key granted Scope, unless Scope is empty. MethodScopes overrides Scope for the methods it lists.
+// Constraints restrict the values of the named path parameters, so a request with any other value is not routed to
+// the handler
+type Route struct {
+	Path         string
+	Methods      []string
+	Handler      http.HandlerFunc
+	Scope        auth.Scope
+	MethodScopes map[string]auth.Scope
+	Constraints  map[string]Constraint
+}
+
+const (
+	// lifetimeWindow is the window reported when stats cover the entire life of the router
+	lifetimeWindow = "lifetime"
+
+	// notFoundRoute is the route that stats for every unmatched path are recorded under
+	notFoundRoute = "404"
+
+	// otherMethod is the method that stats for any non-standard HTTP method are recorded under
+	otherMethod = "OTHER"
+)
+
+// standardMethods are the HTTP methods tracked individually in stats
+var standardMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
 // RouterStatsResponse  is simple list of averages stats for router endpoints
 type RouterStatsResponse struct {
+	Window    string          `json:"window"`
 	StatsList []stats.Average `json:"statsList"`
+	// Misses are the most commonly requested paths that did not match any route
+	Misses []stats.Count `json:"misses"`
+	// Sections holds stats from other parts of the service, keyed by the name they were added under
+	Sections map[string][]stats.Average `json:"sections,omitempty"`
+	// Gauges holds the current value of named gauges from other parts of the service, keyed by the name they were
+	// added under
+	Gauges map[string]map[string]int64 `json:"gauges,omitempty"`
+}
+
+// RouteInfo describes a registered route and the stats gathered for it
+type RouteInfo struct {
+	Pattern string     `json:"pattern"`
+	Methods []string   `json:"methods"`
+	Scope   auth.Scope `json:"scope,omitempty"`
+	// MethodScopes lists the methods requiring a scope other than Scope
+	MethodScopes map[string]auth.Scope `json:"methodScopes,omitempty"`
+	Params       []string              `json:"params"`
+	// Constraints names the constraint on each constrained path parameter
+	Constraints map[string]string `json:"constraints,omitempty"`
+	Stats       []stats.Average   `json:"stats"`
+}
+
+// RoutesResponse is a list of every route registered with the router
+type RoutesResponse struct {
+	Routes []RouteInfo `json:"routes"`
+}
+
+// ErrorResponse is the JSON body returned when the router itself rejects a request
+type ErrorResponse struct {
+	Error      string `json:"error"`
+	Suggestion string `json:"suggestion,omitempty"`
+	// RequestID identifies the rejected request, so it can be found in the logs
+	RequestID string `json:"requestId,omitempty"`
 }
 
 // NewRouter returns a new instance of a router with no registered routes
 func NewRouter(port int) *Router {
+	return NewRouterWithConfig(port, DefaultConfig())
+}
+
+// NewRouterWithConfig returns a new instance of a router with no registered routes, using the provided limits
+func NewRouterWithConfig(port int, config Config) *Router {
+	logger := config.Logger
+	if logger == nil {
+		logger = logging.Default()
+	}
+	routerClock := config.Clock
+	if routerClock == nil {
+		routerClock = clock.System
+	}
 	router := &Router{
 		mux: http.NewServeMux(),
 		registeredPaths: make(map[string]http.HandlerFunc),
-		stats: stats.NewAverageTracker(),
+		routeMethods: make(map[string][]string),
+		routeScopes: make(map[string]auth.Scope),
+		routeMethodScopes: make(map[string]map[string]auth.Scope),
+		routeConstraints: make(map[string]map[string]Constraint),
+		stats: stats.NewAverageTrackerWithLimit(routerClock, config.MaxStatsEntries),
+		misses: stats.NewTopK(config.MaxTrackedMisses),
+		statsSections: make(map[string]*stats.AverageTracker),
+		statsGauges: make(map[string]func() map[string]int64),
+		config: config,
+		logger: logger,
+		clock: routerClock,
 		port: port,
 		errChan: make(chan error, 0),
 	}
 	srv := &http.Server{
-		Addr:              fmt.Sprintf(":%d", port),
+		Addr:              net.JoinHostPort(config.Address, strconv.Itoa(port)),
 		Handler: router,
 	}
 	router.srv = srv
+	router.Use(RequestID)
+	if config.Tracer != nil {
+		router.Use(Tracing(config.Tracer))
+	}
+	if config.AccessLog != nil {
+		router.Use(NewAccessLogWithClock(config.AccessLog, config.AccessLogFormat, routerClock).Middleware)
+	}
+	if config.Keys != nil {
+		router.Use(router.authenticate(config.Keys))
+	}
 	return router
 }
 
 // RegisterStatsEndpoint registers a self-reporting statistics endpoint to show timing metrics on all endpoints
 // registered with this router
 func (r *Router) RegisterStatsEndpoint() {
-	r.RegisterPaths(map[string]http.HandlerFunc{
-		"/stats": r.selfStatsHandler,
-	})
+	r.RegisterRoutes(r.StatsEndpoints())
+}
+
+// StatsEndpoints returns the routes of this router's statistics endpoints, so they can be registered with another
+// router such as one listening on an admin port
+func (r *Router) StatsEndpoints() []Route {
+	return []Route{
+		{Path: "/stats", Methods: []string{http.MethodGet, http.MethodDelete}, Handler: r.selfStatsHandler, Scope: auth.ScopeAdmin},
+		{Path: "/stats/snapshot", Methods: []string{http.MethodPost}, Handler: r.statsSnapshotHandler, Scope: auth.ScopeAdmin},
+	}
+}
+
+// Stats returns the tracker holding this router's request stats
+func (r *Router) Stats() *stats.AverageTracker {
+	return r.stats
+}
+
+// AddStatsSection includes the given tracker's stats in the stats endpoint response under the given section name
+func (r *Router) AddStatsSection(name string, tracker *stats.AverageTracker) {
+	r.statsSections[name] = tracker
+}
+
+// AddStatsGauges includes the gauges returned by the given function in the stats endpoint response under the given
+// name. The function is called for every stats request, so it reports the gauges' current values
+func (r *Router) AddStatsGauges(name string, gauges func() map[string]int64) {
+	r.statsGauges[name] = gauges
 }
 
-// Serve starts the router as an http server
+// RegisterRoutesEndpoint registers an introspection endpoint listing every route registered with this router
+func (r *Router) RegisterRoutesEndpoint() {
+	r.RegisterRoutes(r.RoutesEndpoints())
+}
+
+// RoutesEndpoints returns the route of this router's introspection endpoint, so it can be registered with another
+// router such as one listening on an admin port
+func (r *Router) RoutesEndpoints() []Route {
+	return []Route{
+		{Path: "/routes", Methods: []string{http.MethodGet}, Handler: r.routesHandler, Scope: auth.ScopeAdmin},
+	}
+}
+
+// Listen binds the router's port without serving it, so a port that can't be bound is reported before anything else
+// is started. Serve binds the port itself if Listen hasn't been called
+func (r *Router) Listen() error {
+	listener, err := net.Listen("tcp", r.srv.Addr)
+	if err != nil {
+		return err
+	}
+	r.listener = listener
+	return nil
+}
+
+// CloseListener releases a port bound by Listen, for when the router won't be served after all
+func (r *Router) CloseListener() {
+	if r.listener != nil {
+		r.listener.Close()
+	}
+}
+
+// Serve starts the router as an http server, logging any error that stops it as soon as it happens
 func (r *Router) Serve() {
-	fmt.Println("Server starting on port:", r.port)
-	r.errChan<-r.srv.ListenAndServe()
+	r.logger.Info("server starting", logging.Int("port", r.port))
+	err := r.serve()
+	if err != http.ErrServerClosed {
+		r.logger.Error("server stopped", logging.Err(err))
+	}
+	r.errChan<-err
+}
+
+func (r *Router) serve() error {
+	if r.listener == nil {
+		if err := r.Listen(); err != nil {
+			return err
+		}
+	}
+	return r.srv.Serve(r.listener)
 }
 
 // Shutdown calls shutdown on the HTTP server, blocking until shutdown has finished, returning any error that occurs.
@@ -71,63 +269,263 @@ func (r *Router) Shutdown() error {
 	return shutdownErr
 }
 
-// RegisterPaths registers the provided paths with this router
+// RegisterPaths registers the provided paths with this router, allowing any method through to each handler
 func (r *Router) RegisterPaths(routes map[string]http.HandlerFunc) {
 	for path, handler := range routes {
-		if IsParameterizedPath(path) {
-			r.paramPaths = append(r.paramPaths, ParseParameterizedPath(path))
+		r.RegisterRoutes([]Route{{Path: path, Handler: handler}})
+	}
+}
+
+// RegisterRoutes registers the provided routes with this router. It panics if a route constrains a parameter its
+// path doesn't have, as the mistake would otherwise leave the route unprotected
+func (r *Router) RegisterRoutes(routes []Route) {
+	for _, route := range routes {
+		if IsParameterizedPath(route.Path) {
+			paramPath := ParseParameterizedPath(route.Path)
+			for name, constraint := range route.Constraints {
+				if !paramPath.Constrain(name, constraint) {
+					panic(fmt.Sprintf("routing: %v has no '%v' parameter to constrain", route.Path, name))
+				}
+			}
+			r.paramPaths = append(r.paramPaths, paramPath)
+		} else if len(route.Constraints) > 0 {
+			panic(fmt.Sprintf("routing: %v has no parameters to constrain", route.Path))
 		}
-		r.registeredPaths[path] = handler
-		r.mux.HandleFunc(path, handler)
+		r.routeConstraints[route.Path] = route.Constraints
+		r.registeredPaths[route.Path] = route.Handler
+		r.routeMethods[route.Path] = route.Methods
+		r.routeScopes[route.Path] = route.Scope
+		r.routeMethodScopes[route.Path] = route.MethodScopes
+		r.mux.HandleFunc(route.Path, route.Handler)
+	}
+}
+
+// scope returns the scope required to call the route registered with pattern using method
+func (r *Router) scope(pattern string, method string) auth.Scope {
+	if scope, ok := r.routeMethodScopes[pattern][method]; ok {
+		return scope
 	}
+	return r.routeScopes[pattern]
 }
 
 // AvailablePaths returns all registered paths for this server
 func (r *Router) AvailablePaths() []string {
-	paths := make([]string, len(r.registeredPaths) + len(r.paramPaths))
-	i := 0
+	paths := make([]string, 0, len(r.registeredPaths))
 	for path := range r.registeredPaths {
-		paths[i] = path
-		i++
-	}
-	for _, path := range r.paramPaths {
-		paths[i] = path.Path
-		i++
+		paths = append(paths, path)
 	}
 	sort.Strings(paths)
 	return paths
 }
 
+// Routes returns a description of every registered route, sorted by pattern
+func (r *Router) Routes() []RouteInfo {
+	averages := r.stats.GetAverages()
+	routes := make([]RouteInfo, 0, len(r.registeredPaths))
+	for _, path := range r.AvailablePaths() {
+		info := RouteInfo{
+			Pattern: path,
+			Methods: r.routeMethods[path],
+			Scope:   r.routeScopes[path],
+			Params:  []string{},
+			Stats:   []stats.Average{},
+		}
+		if len(r.routeMethodScopes[path]) > 0 {
+			info.MethodScopes = r.routeMethodScopes[path]
+		}
+		if info.Methods == nil {
+			info.Methods = []string{}
+		}
+		if IsParameterizedPath(path) {
+			info.Params = ParseParameterizedPath(path).ParamNames()
+		}
+		for name, constraint := range r.routeConstraints[path] {
+			if info.Constraints == nil {
+				info.Constraints = make(map[string]string)
+			}
+			info.Constraints[name] = constraint.Name
+		}
+		for _, avg := range averages {
+			if strings.HasPrefix(avg.Name, statsName(path, "")) {
+				info.Stats = append(info.Stats, avg)
+			}
+		}
+		sort.Slice(info.Stats, func(i, j int) bool {
+			return info.Stats[i].Name < info.Stats[j].Name
+		})
+		routes = append(routes, info)
+	}
+	return routes
+}
+
 // ServeHTTP looks at all incoming requests and handles parsing any parameterized paths before passing the
-// request to the correct underlying handler for processing
+// request through any middleware to the correct underlying handler for processing
 func (r *Router) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
-	timer := time.Now()
+	timer := r.clock.Now()
+	match := r.match(req)
+	req = withRouteMatch(req, match)
+
+	// All endpoints will return JSON
+	writer.Header().Add("Content-Type", "application/json")
+	recorder := newStatusRecorder(writer)
+	// deferred so responses aborted by a panic are still counted
+	defer r.recordResponse(match, req.Method, timer, recorder)
+	r.handler.ServeHTTP(recorder, req)
+}
+
+// recordResponse adds a served request to the stats and metrics for the route it matched
+func (r *Router) recordResponse(match *routeMatch, method string, start time.Time, recorder *statusRecorder) {
+	if !standardMethods[method] {
+		method = otherMethod
+	}
+	r.stats.AddResponse(statsName(match.route, method), r.clock.Since(start), recorder.Status(), recorder.BytesWritten())
+	if match.panicked {
+		r.stats.AddPanic(statsName(match.route, method))
+	}
+	r.countRequest(match.route, method, recorder.Status())
+}
+
+// match parses any path parameters out of the request and works out which registered pattern it is routed to
+func (r *Router) match(req *http.Request) *routeMatch {
+	match := &routeMatch{path: req.URL.Path, escapedPath: req.URL.EscapedPath()}
 	req.ParseForm()
+	pathSplits := SplitPath(req.URL.Path)
 	for _, paramPath := range r.paramPaths {
 		if paramPath.ParseRequest(req) {
 			// Request has been updated. No more work needs to be done before serving
+			match.params = paramPath.params(pathSplits)
 			break
 		}
 	}
 
-	// All endpoints will return JSON
-	writer.Header().Add("Content-Type", "application/json")
-	r.mux.ServeHTTP(writer, req)
-	r.stats.AddCycleTime(fmt.Sprintf("%v %v", req.URL.Path, req.Method), time.Since(timer))
+	if _, pattern := r.mux.Handler(req); pattern == "" {
+		// unmatched paths come straight from the client, so they are grouped together to keep stats bounded
+		match.route = notFoundRoute
+	} else {
+		// keyed by the pattern rather than the path, as the mux also reports the pattern for non-canonical paths such
+		// as /x/../hash that it redirects, whose paths come straight from the client
+		match.pattern = pattern
+		match.route = pattern
+	}
+	return match
+}
+
+// dispatch serves the request with the handler registered for its pattern, rejecting unmatched paths and
+// disallowed methods
+func (r *Router) dispatch(writer http.ResponseWriter, req *http.Request) {
+	pattern := MatchedPattern(req)
+	if pattern == "" {
+		r.misses.Add(req.URL.Path)
+		r.notFound(writer, req)
+	} else if !r.methodAllowed(pattern, req.Method) {
+		r.methodNotAllowed(writer, req, pattern)
+	} else {
+		r.mux.ServeHTTP(writer, req)
+	}
+}
+
+func (r *Router) methodAllowed(pattern string, method string) bool {
+	methods := r.routeMethods[pattern]
+	if len(methods) == 0 {
+		return true
+	}
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Router) notFound(writer http.ResponseWriter, req *http.Request) {
+	resp := ErrorResponse{
+		Error:      fmt.Sprintf("no route matches '%v'", req.URL.Path),
+		Suggestion: r.SuggestPath(req.URL.Path),
+	}
+	WriteError(writer, req, http.StatusNotFound, resp)
+}
+
+func (r *Router) methodNotAllowed(writer http.ResponseWriter, req *http.Request, pattern string) {
+	methods := r.routeMethods[pattern]
+	writer.Header().Set("Allow", strings.Join(methods, ", "))
+	resp := ErrorResponse{
+		Error: fmt.Sprintf("'%v' only supports %v", pattern, strings.Join(methods, ", ")),
+	}
+	WriteError(writer, req, http.StatusMethodNotAllowed, resp)
+}
+
+// WriteError writes the error response, tagged with the ID of the request being rejected. Handlers registered with
+// the router use it so their errors take the same form as the router's own
+func WriteError(writer http.ResponseWriter, req *http.Request, status int, resp ErrorResponse) {
+	resp.RequestID = requestid.FromContext(req.Context())
+	// an ErrorResponse only holds strings, so it always marshals
+	jsonBytes, _ := json.Marshal(resp)
+	writer.WriteHeader(status)
+	writer.Write(jsonBytes)
+}
+
+func (r *Router) writeJSON(writer http.ResponseWriter, status int, body interface{}) {
+	jsonBytes, err := json.Marshal(body)
+	if err != nil {
+		r.logger.Error("failed to marshal response", logging.Err(err))
+		writer.WriteHeader(http.StatusInternalServerError)
+		writer.Write([]byte("failed to marshal response"))
+		return
+	}
+
+	writer.WriteHeader(status)
+	writer.Write(jsonBytes)
 }
 
 func (r *Router) selfStatsHandler(writer http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodDelete {
+		r.resetStatsHandler(writer, req)
+		return
+	}
 	if req.Method != http.MethodGet {
 		writer.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 
-	response := RouterStatsResponse{
-		StatsList: r.stats.GetAverages(),
+	response := RouterStatsResponse{Window: lifetimeWindow, Misses: r.misses.Top()}
+	averages := func(tracker *stats.AverageTracker) ([]stats.Average, error) {
+		return tracker.GetAverages(), nil
 	}
+	if windowParam := req.Form.Get("window"); windowParam != "" {
+		window, err := time.ParseDuration(windowParam)
+		if err != nil {
+			WriteError(writer, req, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("invalid window '%v'", windowParam)})
+			return
+		}
+		response.Window = windowParam
+		averages = func(tracker *stats.AverageTracker) ([]stats.Average, error) {
+			return tracker.GetWindowAverages(window)
+		}
+	}
+
+	var err error
+	response.StatsList, err = averages(r.stats)
+	if err != nil {
+		WriteError(writer, req, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if len(r.statsSections) > 0 {
+		response.Sections = make(map[string][]stats.Average)
+		for name, tracker := range r.statsSections {
+			// the window has already been validated against the router's own stats
+			response.Sections[name], _ = averages(tracker)
+		}
+	}
+	if len(r.statsGauges) > 0 {
+		response.Gauges = make(map[string]map[string]int64)
+		for name, gauges := range r.statsGauges {
+			response.Gauges[name] = gauges()
+		}
+	}
+
 	jsonBytes, err := json.Marshal(response)
 	if err != nil {
-		fmt.Println(err)
+		r.logger.Error("failed to marshal stats", logging.Err(err))
 		writer.WriteHeader(503)
 		writer.Write([]byte("failed to generate averages data"))
 		return
@@ -136,3 +534,7 @@ func (r *Router) selfStatsHandler(writer http.ResponseWriter, req *http.Request)
 	writer.WriteHeader(200)
 	writer.Write(jsonBytes)
 }
+
+func (r *Router) routesHandler(writer http.ResponseWriter, req *http.Request) {
+	r.writeJSON(writer, http.StatusOK, RoutesResponse{Routes: r.Routes()})
+}
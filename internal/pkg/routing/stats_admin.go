@@ -0,0 +1,87 @@
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/requestid"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/stats"
+	"net/http"
+	"sync/atomic"
+)
+
+// ErrSnapshotsDisabled is returned when a stats snapshot is requested but no snapshot directory is configured
+var ErrSnapshotsDisabled = errors.New("no stats snapshot directory configured")
+
+// SnapshotResponse tells the caller where a stats snapshot was written
+type SnapshotResponse struct {
+	Path string `json:"path"`
+}
+
+// ResetStats discards the stats recorded for the named entry, such as "/hash POST", returning false if there is no
+// such entry. An empty name discards every stats entry including those of added sections, the tracked misses and
+// the request counts
+func (r *Router) ResetStats(name string) bool {
+	if name != "" {
+		return r.stats.Reset(name)
+	}
+
+	r.stats.ResetAll()
+	for _, tracker := range r.statsSections {
+		tracker.ResetAll()
+	}
+	r.misses.Reset()
+	r.requestCounts.Range(func(key, value interface{}) bool {
+		r.requestCounts.Delete(key)
+		return true
+	})
+	r.countedRoutes.Range(func(key, value interface{}) bool {
+		r.countedRoutes.Delete(key)
+		atomic.AddInt64(&r.countedRouteCount, -1)
+		return true
+	})
+	return true
+}
+
+// WriteStatsSnapshot writes a timestamped report of the current stats into the configured snapshot directory in the
+// configured format, returning the path of the new file
+func (r *Router) WriteStatsSnapshot() (string, error) {
+	if r.config.SnapshotDir == "" {
+		return "", ErrSnapshotsDisabled
+	}
+	return r.stats.Report().WriteFile(r.config.SnapshotDir, r.config.SnapshotFormat)
+}
+
+func (r *Router) resetStatsHandler(writer http.ResponseWriter, req *http.Request) {
+	name := req.Form.Get("name")
+	if !r.ResetStats(name) {
+		WriteError(writer, req, http.StatusNotFound, ErrorResponse{Error: fmt.Sprintf("no stats kept for '%v'", name)})
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (r *Router) statsSnapshotHandler(writer http.ResponseWriter, req *http.Request) {
+	if r.config.SnapshotDir == "" {
+		WriteError(writer, req, http.StatusServiceUnavailable, ErrorResponse{Error: ErrSnapshotsDisabled.Error()})
+		return
+	}
+
+	format := r.config.SnapshotFormat
+	if formatParam := req.Form.Get("format"); formatParam != "" {
+		var err error
+		format, err = stats.ParseExportFormat(formatParam)
+		if err != nil {
+			WriteError(writer, req, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	path, err := r.stats.Report().WriteFile(r.config.SnapshotDir, format)
+	if err != nil {
+		r.logger.Error("failed to write stats snapshot", logging.Err(err), requestid.Field(req.Context()))
+		WriteError(writer, req, http.StatusInternalServerError, ErrorResponse{Error: "failed to write stats snapshot"})
+		return
+	}
+	r.writeJSON(writer, http.StatusCreated, SnapshotResponse{Path: path})
+}
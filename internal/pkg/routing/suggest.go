@@ -0,0 +1,84 @@
+package routing
+
+// maxSuggestionDistance is the largest edit distance at which a registered path is still considered a likely
+// match for a mistyped request path
+const maxSuggestionDistance = 3
+
+// SuggestPath returns the registered path that most closely resembles the given request path, or an empty string if
+// no registered path is close enough to be a reasonable suggestion
+func (r *Router) SuggestPath(path string) string {
+	requestSegments := SplitPath(path)
+	best := ""
+	bestDistance := maxSuggestionDistance + 1
+	for _, pattern := range r.AvailablePaths() {
+		candidate := pattern
+		if IsParameterizedPath(pattern) {
+			candidate = ParseParameterizedPath(pattern).fill(requestSegments)
+		}
+
+		distance := editDistance(path, candidate, bestDistance-1)
+		if distance < bestDistance {
+			best = pattern
+			bestDistance = distance
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between the two strings, or max+1 if it is greater than max. Only
+// the cells within max of the diagonal are worked out, and it stops as soon as a whole row is beyond max, so a long
+// path from a client costs time in proportion to its length rather than its length squared
+func editDistance(a string, b string, max int) int {
+	ar, br := []rune(a), []rune(b)
+	beyond := max + 1
+	if len(ar)-len(br) > max || len(br)-len(ar) > max {
+		return beyond
+	}
+
+	prev := make([]int, len(br)+1)
+	curr := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = minInt(j, beyond)
+	}
+
+	for i := 1; i <= len(ar); i++ {
+		low, high := maxInt(1, i-max), minInt(len(br), i+max)
+		// cells just outside the band are read by the next row, so they are marked as beyond max
+		curr[low-1] = minInt(i, beyond)
+		if low > 1 {
+			curr[low-1] = beyond
+		}
+		if high < len(br) {
+			curr[high+1] = beyond
+		}
+
+		rowMin := curr[low-1]
+		for j := low; j <= high; j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(minInt(minInt(prev[j]+1, curr[j-1]+1), prev[j-1]+cost), beyond)
+			rowMin = minInt(rowMin, curr[j])
+		}
+		if rowMin > max {
+			return beyond
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(br)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,340 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/auth"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/requestid"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/routing"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/test"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/tracing"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	t.Run("middleware runs in order around handler", func(t *testing.T) {
+		r := routing.NewRouter(0)
+		calls := make([]string, 0)
+		r.RegisterRoutes([]routing.Route{
+			{Path: "/test/{id}", Handler: func(writer http.ResponseWriter, request *http.Request) {
+				calls = append(calls, "handler")
+			}},
+		})
+		mark := func(name string) routing.Middleware {
+			return func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+					calls = append(calls, name+" "+routing.MatchedPattern(req)+" "+routing.OriginalPath(req))
+					next.ServeHTTP(writer, req)
+				})
+			}
+		}
+		r.Use(mark("outer"), mark("inner"))
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test/1", nil))
+
+		test.AssertEqual(t, len(calls), 3, "each middleware and the handler called")
+		test.AssertEqual(t, calls[0], "outer /test/{id} /test/1", "outer first, with match")
+		test.AssertEqual(t, calls[1], "inner /test/{id} /test/1", "inner second")
+		test.AssertEqual(t, calls[2], "handler", "handler last")
+	})
+
+	t.Run("short circuited requests still tracked", func(t *testing.T) {
+		r := routing.NewRouter(0)
+		r.RegisterPaths(map[string]http.HandlerFunc{"/test": func(writer http.ResponseWriter, request *http.Request) {}})
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+				writer.WriteHeader(http.StatusTeapot)
+			})
+		})
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+		test.AssertEqual(t, recorder.Code, http.StatusTeapot, "middleware response sent")
+		test.AssertEqual(t, r.Routes()[0].Stats[0].StatusClasses["4xx"], 1, "recorded against matched route")
+	})
+}
+
+func TestRequestID(t *testing.T) {
+	r := routing.NewRouter(0)
+	var seen string
+	r.RegisterPaths(map[string]http.HandlerFunc{"/test": func(writer http.ResponseWriter, request *http.Request) {
+		seen = requestid.FromContext(request.Context())
+	}})
+
+	t.Run("incoming id honored", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set(requestid.Header, "client-42")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+
+		test.AssertEqual(t, seen, "client-42", "handler sees incoming id")
+		test.AssertEqual(t, recorder.Header().Get(requestid.Header), "client-42", "id echoed")
+	})
+
+	t.Run("id assigned when missing or unsafe", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set(requestid.Header, "forged\nline")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+
+		test.AssertEqual(t, seen != "forged\nline", true, "unsafe id replaced")
+		test.AssertEqual(t, len(seen), 32, "new id assigned")
+		test.AssertEqual(t, recorder.Header().Get(requestid.Header), seen, "assigned id echoed")
+	})
+
+	t.Run("error responses include id", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+		req.Header.Set(requestid.Header, "client-43")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+
+		errResp := routing.ErrorResponse{}
+		err := json.Unmarshal(recorder.Body.Bytes(), &errResp)
+		test.AssertNil(t, err, "body should be valid json")
+		test.AssertEqual(t, errResp.RequestID, "client-43", "error tagged with request id")
+	})
+}
+
+func TestRecovery(t *testing.T) {
+	out := &bytes.Buffer{}
+	config := routing.DefaultConfig()
+	config.Logger = logging.New(out, logging.InfoLevel, logging.JSONFormat)
+	r := routing.NewRouterWithConfig(0, config)
+	r.RegisterRoutes([]routing.Route{
+		{Path: "/boom", Handler: func(writer http.ResponseWriter, request *http.Request) {
+			panic("something broke")
+		}},
+		{Path: "/partial", Handler: func(writer http.ResponseWriter, request *http.Request) {
+			writer.Write([]byte("half"))
+			panic("something broke late")
+		}},
+	})
+
+	t.Run("panic becomes json error", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/boom", nil)
+		req.Header.Set(requestid.Header, "boom-1")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+
+		test.AssertEqual(t, recorder.Code, http.StatusInternalServerError, "500 returned")
+		errResp := routing.ErrorResponse{}
+		err := json.Unmarshal(recorder.Body.Bytes(), &errResp)
+		test.AssertNil(t, err, "body should be valid json")
+		test.AssertEqual(t, errResp.RequestID, "boom-1", "error tagged with request id")
+
+		entry := make(map[string]interface{})
+		err = json.Unmarshal(out.Bytes(), &entry)
+		test.AssertNil(t, err, "panic logged as one entry")
+		test.AssertEqual(t, entry["requestId"], "boom-1", "log tagged with request id")
+		test.AssertEqual(t, entry["panic"], "something broke", "panic value logged")
+		test.AssertEqual(t, strings.Contains(entry["stack"].(string), "goroutine"), true, "stack logged")
+	})
+
+	t.Run("started response aborted", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		defer func() {
+			test.AssertEqual(t, recover(), interface{}(http.ErrAbortHandler), "response aborted")
+			test.AssertEqual(t, recorder.Body.String(), "half", "body not corrupted")
+		}()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/partial", nil))
+	})
+
+	t.Run("panics counted per route", func(t *testing.T) {
+		routes := r.Routes()
+		test.AssertEqual(t, routes[0].Pattern, "/boom", "routes sorted")
+		test.AssertEqual(t, routes[0].Stats[0].Panics, 1, "panic counted against route")
+		test.AssertEqual(t, routes[0].Stats[0].StatusClasses["5xx"], 1, "500 recorded")
+		test.AssertEqual(t, routes[1].Stats[0].Panics, 1, "late panic counted too")
+	})
+
+	t.Run("middleware panic becomes json error", func(t *testing.T) {
+		r := routing.NewRouterWithConfig(0, config)
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+				panic("middleware broke")
+			})
+		})
+		req := httptest.NewRequest(http.MethodGet, "/anything", nil)
+		req.Header.Set(requestid.Header, "boom-2")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+
+		test.AssertEqual(t, recorder.Code, http.StatusInternalServerError, "500 returned")
+		errResp := routing.ErrorResponse{}
+		err := json.Unmarshal(recorder.Body.Bytes(), &errResp)
+		test.AssertNil(t, err, "body should be valid json")
+		test.AssertEqual(t, errResp.RequestID, "boom-2", "error tagged with request id")
+	})
+}
+
+func TestAuthentication(t *testing.T) {
+	keys := auth.NewKeyStore()
+	keys.Add("read-key", auth.Principal{Name: "reader", Scopes: []auth.Scope{auth.ScopeHashRead}})
+	keys.Add("admin-key", auth.Principal{Name: "ops", Scopes: []auth.Scope{auth.ScopeAdmin}})
+	config := routing.DefaultConfig()
+	config.Keys = keys
+	config.Logger = logging.Discard()
+	r := routing.NewRouterWithConfig(0, config)
+	var principal auth.Principal
+	handler := func(writer http.ResponseWriter, request *http.Request) {
+		principal, _ = auth.FromContext(request.Context())
+	}
+	r.RegisterRoutes([]routing.Route{
+		{Path: "/read", Handler: handler, Scope: auth.ScopeHashRead},
+		{Path: "/write", Handler: handler, Scope: auth.ScopeHashWrite},
+		{Path: "/open", Handler: handler},
+		{Path: "/record", Handler: handler, Scope: auth.ScopeHashRead,
+			MethodScopes: map[string]auth.Scope{http.MethodDelete: auth.ScopeHashWrite}},
+	})
+	serve := func(path string, header string, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if header != "" {
+			req.Header.Set(header, key)
+		}
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	t.Run("missing key rejected", func(t *testing.T) {
+		recorder := serve("/read", "", "")
+		test.AssertEqual(t, recorder.Code, http.StatusUnauthorized, "401 without a key")
+		test.AssertEqual(t, recorder.Header().Get("WWW-Authenticate"), `Bearer realm="hash"`, "challenge sent")
+		errResp := routing.ErrorResponse{}
+		err := json.Unmarshal(recorder.Body.Bytes(), &errResp)
+		test.AssertNil(t, err, "body should be valid json")
+		test.AssertEqual(t, errResp.Error, "missing or invalid API key", "error explained")
+	})
+
+	t.Run("invalid key rejected", func(t *testing.T) {
+		test.AssertEqual(t, serve("/read", routing.APIKeyHeader, "wrong").Code, http.StatusUnauthorized, "401 for a bad key")
+		test.AssertEqual(t, serve("/open", routing.APIKeyHeader, "wrong").Code, http.StatusUnauthorized, "bad key rejected on open route")
+	})
+
+	t.Run("missing scope forbidden", func(t *testing.T) {
+		test.AssertEqual(t, serve("/write", "Authorization", "Bearer read-key").Code, http.StatusForbidden, "403 without scope")
+	})
+
+	t.Run("valid key accepted", func(t *testing.T) {
+		test.AssertEqual(t, serve("/read", "Authorization", "Bearer read-key").Code, http.StatusOK, "bearer token accepted")
+		test.AssertEqual(t, principal.Name, "reader", "principal on context")
+		test.AssertEqual(t, serve("/write", routing.APIKeyHeader, "admin-key").Code, http.StatusOK, "admin allowed anywhere")
+		test.AssertEqual(t, principal.Name, "ops", "principal on context")
+	})
+
+	t.Run("method scopes override route scope", func(t *testing.T) {
+		test.AssertEqual(t, serve("/record", routing.APIKeyHeader, "read-key").Code, http.StatusOK, "route scope for get")
+		req := httptest.NewRequest(http.MethodDelete, "/record", nil)
+		req.Header.Set(routing.APIKeyHeader, "read-key")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		test.AssertEqual(t, recorder.Code, http.StatusForbidden, "method scope for delete")
+		test.AssertEqual(t, r.Routes()[2].MethodScopes[http.MethodDelete], auth.ScopeHashWrite, "method scope listed")
+	})
+
+	t.Run("routes without scope open", func(t *testing.T) {
+		test.AssertEqual(t, serve("/open", "", "").Code, http.StatusOK, "no key needed")
+		test.AssertEqual(t, serve("/missing", "", "").Code, http.StatusNotFound, "unmatched paths still 404")
+	})
+}
+
+func TestTracing(t *testing.T) {
+	out := &bytes.Buffer{}
+	tracer := tracing.NewTracer("test", tracing.NewWriterExporter(out), logging.Discard())
+	config := routing.DefaultConfig()
+	config.Tracer = tracer
+	r := routing.NewRouterWithConfig(0, config)
+	var handlerSpan tracing.SpanContext
+	r.RegisterRoutes([]routing.Route{
+		{Path: "/test/{id}", Handler: func(writer http.ResponseWriter, request *http.Request) {
+			handlerSpan = tracing.SpanContextFromContext(request.Context())
+			writer.WriteHeader(http.StatusInternalServerError)
+		}},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/test/1", nil)
+	req.Header.Set(tracing.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	test.AssertNil(t, tracer.Shutdown(), "spans exported")
+
+	request := tracing.OTLPRequest{}
+	err := json.Unmarshal(out.Bytes(), &request)
+	test.AssertNil(t, err, "export is valid json")
+	span := request.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	test.AssertEqual(t, span.Name, "GET /test/{id}", "span named after the route")
+	test.AssertEqual(t, span.TraceID, "4bf92f3577b34da6a3ce929d0e0e4736", "incoming trace continued")
+	test.AssertEqual(t, span.ParentSpanID, "00f067aa0ba902b7", "child of the caller")
+	test.AssertEqual(t, span.SpanID, handlerSpan.SpanID.String(), "handler sees the server span")
+	test.AssertEqual(t, span.Status.Code, tracing.StatusError, "server error marks span failed")
+}
+
+func TestAccessLog(t *testing.T) {
+	newRouter := func(format routing.AccessLogFormat) (*routing.Router, *bytes.Buffer) {
+		out := &bytes.Buffer{}
+		config := routing.DefaultConfig()
+		config.AccessLog = out
+		config.AccessLogFormat = format
+		r := routing.NewRouterWithConfig(0, config)
+		r.RegisterRoutes([]routing.Route{
+			{Path: "/test/{id}", Methods: []string{http.MethodGet}, Handler: func(writer http.ResponseWriter, request *http.Request) {
+				writer.Write([]byte("hello"))
+			}},
+		})
+		return r, out
+	}
+
+	t.Run("combined format", func(t *testing.T) {
+		r, out := newRouter(routing.CombinedFormat)
+		req := httptest.NewRequest(http.MethodGet, "/test/7?password=hunter2", nil)
+		req.Header.Set("User-Agent", "curl/7.0")
+		req.Header.Set(requestid.Header, "abc")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+
+		line := out.String()
+		test.AssertEqual(t, strings.HasPrefix(line, "192.0.2.1 - - ["), true, "remote host first: "+line)
+		test.AssertEqual(t, strings.Contains(line, `] "GET /test/7 HTTP/1.1" 200 5 "-" "curl/7.0" "/test/{id}" `), true,
+			"request, status, bytes, referer, agent and pattern: "+line)
+		test.AssertEqual(t, strings.HasSuffix(line, " abc\n"), true, "request id last")
+		test.AssertEqual(t, strings.Contains(line, "hunter2"), false, "query string never logged")
+	})
+
+	t.Run("escaped path logged", func(t *testing.T) {
+		r, out := newRouter(routing.CombinedFormat)
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test/7%0A192.0.2.9%20-%20-%20%22GET", nil))
+
+		line := out.String()
+		test.AssertEqual(t, strings.Count(line, "\n"), 1, "single line logged: "+line)
+		test.AssertEqual(t, strings.Contains(line, `"GET /test/7%0A192.0.2.9%20-%20-%20%22GET HTTP/1.1"`), true,
+			"newline and quote left escaped: "+line)
+	})
+
+	t.Run("json format", func(t *testing.T) {
+		r, out := newRouter(routing.JSONLinesFormat)
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/test/7", nil))
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		test.AssertEqual(t, len(lines), 2, "one line per request")
+
+		entry := routing.AccessEntry{}
+		err := json.Unmarshal([]byte(lines[0]), &entry)
+		test.AssertNil(t, err, "line should be valid json")
+		test.AssertEqual(t, entry.Method, http.MethodPost, "method logged")
+		test.AssertEqual(t, entry.Path, "/test/7", "original path logged")
+		test.AssertEqual(t, entry.Pattern, "/test/{id}", "pattern logged")
+		test.AssertEqual(t, entry.Status, http.StatusMethodNotAllowed, "status logged")
+
+		err = json.Unmarshal([]byte(lines[1]), &entry)
+		test.AssertNil(t, err, "line should be valid json")
+		test.AssertEqual(t, entry.Pattern, "", "unmatched path has no pattern")
+		test.AssertEqual(t, entry.Status, http.StatusNotFound, "not found logged")
+	})
+
+	t.Run("parse format", func(t *testing.T) {
+		_, err := routing.ParseAccessLogFormat("common")
+		test.AssertNotNil(t, err, "unknown format rejected")
+	})
+}
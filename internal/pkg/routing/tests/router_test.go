@@ -1,11 +1,22 @@
 package tests
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/metrics"
 	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/routing"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/stats"
 	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/test"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestRouting(t *testing.T) {
@@ -42,6 +53,7 @@ func TestRouting(t *testing.T) {
 		})
 
 		go r.Serve()
+		test.WaitForServer(t, 8098)
 
 		resp, err := http.Get("http://127.0.0.1:8098/test")
 		test.AssertNil(t, err, "no error on http GET")
@@ -54,4 +66,345 @@ func TestRouting(t *testing.T) {
 		err = r.Shutdown()
 		test.AssertNil(t, err, "no server close error expected")
 	})
+
+	t.Run("parameterized paths counted once", func(t *testing.T) {
+		r := routing.NewRouter(0)
+		r.RegisterPaths(map[string]http.HandlerFunc{
+			"/test": func(writer http.ResponseWriter, request *http.Request) {},
+			"/test/{id}": func(writer http.ResponseWriter, request *http.Request) {},
+		})
+
+		test.AssertEqual(t, len(r.AvailablePaths()), 2, "two registered paths")
+		test.AssertEqual(t, r.AvailablePaths()[1], "/test/{id}", "parameterized path listed")
+	})
+
+	t.Run("routes describe methods and params", func(t *testing.T) {
+		r := routing.NewRouter(0)
+		r.RegisterRoutes([]routing.Route{
+			{Path: "/test/{id}/{name}", Methods: []string{http.MethodGet}, Handler: func(writer http.ResponseWriter, request *http.Request) {}},
+			{Path: "/test", Handler: func(writer http.ResponseWriter, request *http.Request) {}},
+		})
+
+		routes := r.Routes()
+		test.AssertEqual(t, len(routes), 2, "two routes")
+		test.AssertEqual(t, routes[0].Pattern, "/test", "sorted by pattern")
+		test.AssertEqual(t, len(routes[0].Methods), 0, "any method allowed")
+		test.AssertEqual(t, len(routes[1].Methods), 1, "one method allowed")
+		test.AssertEqual(t, len(routes[1].Params), 2, "two params")
+		test.AssertEqual(t, routes[1].Params[0], "id", "first param in path order")
+		test.AssertEqual(t, routes[1].Params[1], "name", "second param in path order")
+	})
+
+	t.Run("route stats reported per pattern", func(t *testing.T) {
+		r := routing.NewRouter(0)
+		r.RegisterRoutes([]routing.Route{
+			{Path: "/test/{id}", Methods: []string{http.MethodGet}, Handler: func(writer http.ResponseWriter, request *http.Request) {}},
+		})
+
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test/1", nil))
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test/2", nil))
+
+		routes := r.Routes()
+		test.AssertEqual(t, len(routes[0].Stats), 1, "one method observed")
+		test.AssertEqual(t, routes[0].Stats[0].Total, 2, "both calls counted")
+	})
+
+	t.Run("constrained params only match allowed values", func(t *testing.T) {
+		digits := routing.Constraint{Name: "int", Match: func(segment string) bool {
+			_, err := strconv.Atoi(segment)
+			return err == nil
+		}}
+		r := routing.NewRouter(0)
+		r.RegisterRoutes([]routing.Route{
+			{Path: "/test/{id}", Methods: []string{http.MethodGet}, Handler: func(writer http.ResponseWriter, request *http.Request) {},
+				Constraints: map[string]routing.Constraint{"id": digits}},
+		})
+
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/test/12", nil))
+		test.AssertEqual(t, recorder.Code, http.StatusOK, "allowed value matched")
+
+		recorder = httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/test/twelve", nil))
+		test.AssertEqual(t, recorder.Code, http.StatusNotFound, "other values not matched")
+
+		test.AssertEqual(t, r.Routes()[0].Constraints["id"], "int", "constraint listed with the route")
+	})
+
+	t.Run("constraining a missing param panics", func(t *testing.T) {
+		defer func() {
+			test.AssertNotNil(t, recover(), "registration panicked")
+		}()
+		r := routing.NewRouter(0)
+		r.RegisterRoutes([]routing.Route{
+			{Path: "/test/{id}", Handler: func(writer http.ResponseWriter, request *http.Request) {},
+				Constraints: map[string]routing.Constraint{"name": {Name: "any", Match: func(string) bool { return true }}}},
+		})
+	})
+
+	t.Run("disallowed method rejected", func(t *testing.T) {
+		r := routing.NewRouter(0)
+		r.RegisterRoutes([]routing.Route{
+			{Path: "/test", Methods: []string{http.MethodPost}, Handler: func(writer http.ResponseWriter, request *http.Request) {}},
+		})
+
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/test", nil))
+		test.AssertEqual(t, recorder.Code, http.StatusMethodNotAllowed, "GET not allowed")
+		test.AssertEqual(t, recorder.Header().Get("Allow"), http.MethodPost, "allowed methods listed")
+	})
+
+	t.Run("suggest closest path", func(t *testing.T) {
+		r := routing.NewRouter(0)
+		r.RegisterPaths(map[string]http.HandlerFunc{
+			"/hash": func(writer http.ResponseWriter, request *http.Request) {},
+			"/hash/{id}": func(writer http.ResponseWriter, request *http.Request) {},
+			"/stats": func(writer http.ResponseWriter, request *http.Request) {},
+		})
+
+		test.AssertEqual(t, r.SuggestPath("/hsah"), "/hash", "transposed letters")
+		test.AssertEqual(t, r.SuggestPath("/stat"), "/stats", "missing letter")
+		test.AssertEqual(t, r.SuggestPath("/hahs/12"), "/hash/{id}", "parameter value ignored")
+		test.AssertEqual(t, r.SuggestPath("/something/else/entirely"), "", "nothing close enough")
+
+		long := strings.Repeat("x", 1<<20)
+		test.AssertEqual(t, r.SuggestPath("/"+long), "", "long path suggests nothing")
+		test.AssertEqual(t, r.SuggestPath("/hahs/"+long), "/hash/{id}", "long parameter value ignored")
+	})
+
+	t.Run("not found includes suggestion", func(t *testing.T) {
+		r := routing.NewRouter(0)
+		r.RegisterPaths(map[string]http.HandlerFunc{
+			"/stats": func(writer http.ResponseWriter, request *http.Request) {},
+		})
+
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stat", nil))
+		test.AssertEqual(t, recorder.Code, http.StatusNotFound, "unknown path not found")
+
+		errResp := routing.ErrorResponse{}
+		err := json.Unmarshal(recorder.Body.Bytes(), &errResp)
+		test.AssertNil(t, err, "body should be valid json")
+		test.AssertEqual(t, errResp.Suggestion, "/stats", "suggests stats endpoint")
+	})
+
+	t.Run("windowed stats", func(t *testing.T) {
+		r := routing.NewRouter(0)
+		r.RegisterStatsEndpoint()
+		r.RegisterPaths(map[string]http.HandlerFunc{
+			"/test": func(writer http.ResponseWriter, request *http.Request) {},
+		})
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test", nil))
+
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stats?window=5m", nil))
+		test.AssertEqual(t, recorder.Code, http.StatusOK, "5m window accepted")
+
+		statsResp := routing.RouterStatsResponse{}
+		err := json.Unmarshal(recorder.Body.Bytes(), &statsResp)
+		test.AssertNil(t, err, "body should be valid json")
+		test.AssertEqual(t, statsResp.Window, "5m", "window echoed")
+		test.AssertEqual(t, len(statsResp.StatsList), 1, "recent call reported")
+
+		recorder = httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stats?window=3m", nil))
+		test.AssertEqual(t, recorder.Code, http.StatusBadRequest, "unsupported window rejected")
+
+		recorder = httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stats?window=soon", nil))
+		test.AssertEqual(t, recorder.Code, http.StatusBadRequest, "unparsable window rejected")
+	})
+
+	t.Run("requests counted by status", func(t *testing.T) {
+		r := routing.NewRouter(0)
+		r.RegisterRoutes([]routing.Route{
+			{Path: "/test", Methods: []string{http.MethodPost}, Handler: func(writer http.ResponseWriter, request *http.Request) {
+				writer.WriteHeader(http.StatusCreated)
+			}},
+		})
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/test", nil))
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test", nil))
+
+		buf := &bytes.Buffer{}
+		err := metrics.WriteText(buf, r.Collect())
+		test.AssertNil(t, err, "write should not error")
+		body := buf.String()
+		test.AssertEqual(t, strings.Contains(body, `http_requests_total{route="/test",method="GET",status="405"} 1`), true, "rejected GET counted")
+		test.AssertEqual(t, strings.Contains(body, `http_requests_total{route="/test",method="POST",status="201"} 1`), true, "created POST counted")
+		test.AssertEqual(t, strings.Contains(body, `http_request_duration_seconds_count{route="/test",method="POST"} 1`), true, "POST duration observed")
+	})
+
+	t.Run("request counts bounded", func(t *testing.T) {
+		r := routing.NewRouterWithConfig(0, routing.Config{MaxStatsEntries: 2, MaxTrackedMisses: 10})
+		handler := func(writer http.ResponseWriter, request *http.Request) {}
+		r.RegisterPaths(map[string]http.HandlerFunc{"/a": handler, "/b": handler, "/c": handler})
+		for _, path := range []string{"/a", "/b", "/c", "/missing"} {
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		}
+
+		buf := &bytes.Buffer{}
+		err := metrics.WriteText(buf, r.Collect())
+		test.AssertNil(t, err, "write should not error")
+		body := buf.String()
+		test.AssertEqual(t, strings.Contains(body, `http_requests_total{route="/a",method="GET",status="200"} 1`), true, "first route counted")
+		test.AssertEqual(t, strings.Contains(body, `http_requests_total{route="/b",method="GET",status="200"} 1`), true, "second route counted")
+		test.AssertEqual(t, strings.Contains(body, `route="/c"`), false, "routes beyond the limit not labelled")
+		test.AssertEqual(t, strings.Contains(body, `route="404"`), false, "misses beyond the limit not labelled")
+		test.AssertEqual(t, strings.Contains(body, `http_requests_total{route="other",method="GET",status="200"} 1`), true, "routes beyond the limit folded into overflow")
+		test.AssertEqual(t, strings.Contains(body, `http_requests_total{route="other",method="GET",status="404"} 1`), true, "misses beyond the limit folded into overflow")
+	})
+
+	t.Run("stats track status and bytes", func(t *testing.T) {
+		r := routing.NewRouter(0)
+		r.RegisterPaths(map[string]http.HandlerFunc{
+			"/test/{id}": func(writer http.ResponseWriter, request *http.Request) {
+				if request.Form.Get("id") == "bad" {
+					writer.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				writer.Write([]byte("hello"))
+			},
+		})
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test/1", nil))
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test/bad", nil))
+
+		routeStats := r.Routes()[0].Stats[0]
+		test.AssertEqual(t, routeStats.StatusClasses["2xx"], 1, "implicit 200 recorded")
+		test.AssertEqual(t, routeStats.StatusClasses["4xx"], 1, "bad request recorded")
+		test.AssertEqual(t, routeStats.ErrorRate, 0.5, "half were errors")
+		test.AssertEqual(t, routeStats.Bytes, int64(5), "body bytes recorded")
+	})
+
+	t.Run("unmatched paths share one stats entry", func(t *testing.T) {
+		r := routing.NewRouterWithConfig(0, routing.Config{MaxStatsEntries: 10, MaxTrackedMisses: 10})
+		r.RegisterStatsEndpoint()
+		for i := 0; i < 5; i++ {
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, fmt.Sprintf("/random/%d", i), nil))
+		}
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/stat", nil))
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/stat", nil))
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BREW", "/stat", nil))
+
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stats", nil))
+		statsResp := routing.RouterStatsResponse{}
+		err := json.Unmarshal(recorder.Body.Bytes(), &statsResp)
+		test.AssertNil(t, err, "body should be valid json")
+
+		test.AssertEqual(t, len(statsResp.StatsList), 2, "one entry per method for all misses")
+		test.AssertEqual(t, statsResp.StatsList[0].Name, "404 GET", "misses grouped by method")
+		test.AssertEqual(t, statsResp.StatsList[0].Total, 7, "every GET miss counted")
+		test.AssertEqual(t, statsResp.StatsList[1].Name, "404 OTHER", "non-standard method grouped")
+		test.AssertEqual(t, len(statsResp.Misses), 6, "each miss tracked")
+		test.AssertEqual(t, statsResp.Misses[0], stats.Count{Name: "/stat", Count: 3}, "most common miss first")
+	})
+
+	t.Run("redirected paths counted under their pattern", func(t *testing.T) {
+		r := routing.NewRouter(0)
+		r.RegisterRoutes([]routing.Route{
+			{Path: "/test", Methods: []string{http.MethodPost}, Handler: func(writer http.ResponseWriter, request *http.Request) {}},
+		})
+		for i := 0; i < 5; i++ {
+			recorder := httptest.NewRecorder()
+			r.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/x%d/../test", i), nil))
+			test.AssertEqual(t, recorder.Code, http.StatusMovedPermanently, "non-canonical path redirected")
+		}
+
+		averages := r.Stats().GetAverages()
+		test.AssertEqual(t, len(averages), 1, "one stats entry for every redirect")
+		test.AssertEqual(t, averages[0].Name, "/test POST", "redirects counted under the pattern")
+	})
+
+	t.Run("reset stats", func(t *testing.T) {
+		r := routing.NewRouter(0)
+		r.RegisterStatsEndpoint()
+		r.RegisterPaths(map[string]http.HandlerFunc{
+			"/a": func(writer http.ResponseWriter, request *http.Request) {},
+			"/b": func(writer http.ResponseWriter, request *http.Request) {},
+		})
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/a", nil))
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/b", nil))
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/c", nil))
+
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/stats?name=/a+GET", nil))
+		test.AssertEqual(t, recorder.Code, http.StatusNoContent, "named entry reset")
+
+		recorder = httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/stats?name=/z+GET", nil))
+		test.AssertEqual(t, recorder.Code, http.StatusNotFound, "unknown entry not found")
+
+		routes := r.Routes()
+		test.AssertEqual(t, len(routes[0].Stats), 0, "/a stats discarded")
+		test.AssertEqual(t, len(routes[1].Stats), 1, "/b stats kept")
+
+		recorder = httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/stats", nil))
+		test.AssertEqual(t, recorder.Code, http.StatusNoContent, "everything reset")
+
+		recorder = httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stats", nil))
+		statsResp := routing.RouterStatsResponse{}
+		err := json.Unmarshal(recorder.Body.Bytes(), &statsResp)
+		test.AssertNil(t, err, "body should be valid json")
+		test.AssertEqual(t, len(statsResp.StatsList), 1, "only the reset call itself remains")
+		test.AssertEqual(t, statsResp.StatsList[0].Name, "/stats DELETE", "reset call recorded after reset")
+		test.AssertEqual(t, len(statsResp.Misses), 0, "misses discarded")
+	})
+
+	t.Run("stats snapshot on demand", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "stats")
+		test.AssertNil(t, err, "temp dir should be created")
+		defer os.RemoveAll(dir)
+
+		config := routing.DefaultConfig()
+		config.SnapshotDir = dir
+		r := routing.NewRouterWithConfig(0, config)
+		r.RegisterStatsEndpoint()
+
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/stats/snapshot?format=csv", nil))
+		test.AssertEqual(t, recorder.Code, http.StatusCreated, "snapshot written")
+
+		snapResp := routing.SnapshotResponse{}
+		err = json.Unmarshal(recorder.Body.Bytes(), &snapResp)
+		test.AssertNil(t, err, "body should be valid json")
+		test.AssertEqual(t, filepath.Dir(snapResp.Path), dir, "written to configured dir")
+		test.AssertEqual(t, filepath.Ext(snapResp.Path), ".csv", "written in requested format")
+
+		recorder = httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/stats/snapshot?format=xml", nil))
+		test.AssertEqual(t, recorder.Code, http.StatusBadRequest, "unknown format rejected")
+	})
+
+	t.Run("stats snapshot disabled", func(t *testing.T) {
+		r := routing.NewRouter(0)
+		r.RegisterStatsEndpoint()
+
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/stats/snapshot", nil))
+		test.AssertEqual(t, recorder.Code, http.StatusServiceUnavailable, "no snapshot dir configured")
+
+		_, err := r.WriteStatsSnapshot()
+		test.AssertEqual(t, err, routing.ErrSnapshotsDisabled, "no snapshot dir configured")
+	})
+
+	t.Run("stats sections", func(t *testing.T) {
+		r := routing.NewRouter(0)
+		r.RegisterStatsEndpoint()
+		section := stats.NewAverageTracker()
+		section.AddCycleTime("work", time.Millisecond)
+		r.AddStatsSection("inner", section)
+
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stats?window=1m", nil))
+		statsResp := routing.RouterStatsResponse{}
+		err := json.Unmarshal(recorder.Body.Bytes(), &statsResp)
+		test.AssertNil(t, err, "body should be valid json")
+		test.AssertEqual(t, len(statsResp.Sections["inner"]), 1, "section included")
+		test.AssertEqual(t, statsResp.Sections["inner"][0].Name, "work", "section stats reported")
+
+		r.ResetStats("")
+		test.AssertEqual(t, len(section.GetAverages()), 0, "sections reset with everything else")
+	})
 }
@@ -0,0 +1,42 @@
+package routing
+
+import (
+	"fmt"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/requestid"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/tracing"
+	"net/http"
+)
+
+// Tracing returns middleware that starts a server span for every request, continuing the caller's trace when a
+// valid traceparent header is sent. The span is carried on the request context for handlers to add child spans to
+func Tracing(tracer *tracing.Tracer) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+			ctx := req.Context()
+			if parent, err := tracing.ParseTraceparent(req.Header.Get(tracing.TraceparentHeader)); err == nil {
+				ctx = tracing.ContextWithParent(ctx, parent)
+			}
+
+			route := notFoundRoute
+			if pattern := MatchedPattern(req); pattern != "" {
+				route = pattern
+			}
+			ctx, span := tracer.StartServer(ctx, req.Method+" "+route,
+				tracing.String("http.method", req.Method),
+				tracing.String("http.route", route),
+				tracing.String("http.target", OriginalPath(req)),
+				tracing.String("request.id", requestid.FromContext(ctx)))
+			defer span.End()
+
+			recorder := newStatusRecorder(writer)
+			next.ServeHTTP(recorder, req.WithContext(ctx))
+
+			span.SetAttributes(
+				tracing.Int("http.status_code", int64(recorder.Status())),
+				tracing.Int("http.response_size", recorder.BytesWritten()))
+			if recorder.Status() >= http.StatusInternalServerError {
+				span.SetError(fmt.Sprintf("responded with %d", recorder.Status()))
+			}
+		})
+	}
+}
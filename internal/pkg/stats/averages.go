@@ -1,55 +1,282 @@
 package stats
 
-import "time"
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
-// Average is data around the average for a single item
+const (
+	// DefaultMaxItems is the number of distinct names an AverageTracker keeps stats for unless told otherwise
+	DefaultMaxItems = 200
+
+	// OverflowName is the name that stats are recorded under once an AverageTracker is tracking as many distinct
+	// names as it is allowed to
+	OverflowName = "other"
+)
+
+// Average is data around the average for a single item. All durations are reported in microseconds
 type Average struct {
-	Name        string `json:"name"`
-	Total       int    `json:"total"`
-	AvgMicroSec int64  `json:"average"`
+	Name           string  `json:"name"`
+	Total          int     `json:"total"`
+	AvgMicroSec    int64   `json:"average"`
+	MinMicroSec    int64   `json:"min"`
+	MaxMicroSec    int64   `json:"max"`
+	StdDevMicroSec int64   `json:"stdDev"`
+	P50MicroSec    int64   `json:"p50"`
+	P90MicroSec    int64   `json:"p90"`
+	P99MicroSec    int64   `json:"p99"`
+	P999MicroSec   int64   `json:"p999"`
+	PerSecond      float64 `json:"perSecond"`
+
+	// StatusClasses counts responses by status class, such as "2xx" or "5xx"
+	StatusClasses map[string]int `json:"statusClasses"`
+	// ErrorRate is the fraction of responses that were client or server errors
+	ErrorRate float64 `json:"errorRate"`
+	// Bytes is the total number of response body bytes written
+	Bytes int64 `json:"bytes"`
+	// Panics is the number of responses whose handler panicked
+	Panics int `json:"panics"`
 }
 
-// AverageTracker helps with keeping track of the averages of any number of items
+// AverageTracker helps with keeping track of the averages of any number of items, both over the lifetime of the
+// tracker and over recent windows of time. It is safe for concurrent use, and recording a cycle time for an item
+// that has already been seen never takes a lock.
+//
+// The number of distinct items is bounded, keeping memory bounded no matter what names are recorded. Once the limit
+// is reached, anything recorded for a new name is folded into the OverflowName item instead
 type AverageTracker struct {
-	items map[string]*timeTracker
+	itemCount    int64    // number of items in the map, not including the overflow item
+	resetAtNanos int64    // unix nanoseconds when the tracker was created or last reset entirely
+	items        sync.Map // map of item name -> *trackedItem
+	maxItems     int64
+	overflow     atomic.Value // *trackedItem
+	clock        Clock
+
+	// resetLock serializes resets only, recording never touches it
+	resetLock sync.Mutex
+}
+
+type trackedItem struct {
+	// responses is first in the struct to guarantee 64-bit alignment for atomic operations
+	responses responseCounts
+	lifetime  *Histogram
+	recent    *rollingHistogram
+	since     time.Time // when this item started collecting, used for rates
+}
+
+// itemSnapshot is a point in time copy of everything recorded for an item over some period
+type itemSnapshot struct {
+	latency   HistogramSnapshot
+	responses ResponseSnapshot
 }
 
 // NewAverageTracker returns a new AverageTracker instance
 func NewAverageTracker() *AverageTracker {
-	return &AverageTracker{
-		items: make(map[string]*timeTracker),
+	return NewAverageTrackerWithClock(SystemClock)
+}
+
+// NewAverageTrackerWithClock returns a new AverageTracker instance that uses the given clock for windowed stats and
+// rates
+func NewAverageTrackerWithClock(clock Clock) *AverageTracker {
+	return NewAverageTrackerWithLimit(clock, DefaultMaxItems)
+}
+
+// NewAverageTrackerWithLimit returns a new AverageTracker instance that uses the given clock for windowed stats and
+// rates, and keeps separate stats for at most maxItems distinct names
+func NewAverageTrackerWithLimit(clock Clock, maxItems int) *AverageTracker {
+	now := clock.Now()
+	tracker := &AverageTracker{
+		resetAtNanos: now.UnixNano(),
+		maxItems:     int64(maxItems),
+		clock:        clock,
 	}
+	tracker.overflow.Store(newTrackedItem(now))
+	return tracker
 }
 
-type timeTracker struct {
-	totalTime time.Duration
-	totalCount int
+func newTrackedItem(since time.Time) *trackedItem {
+	return &trackedItem{
+		lifetime: NewHistogram(),
+		recent:   &rollingHistogram{},
+		since:    since,
+	}
 }
 
-// AddCycleTime will add one instance having taken the provided duration for the named item
-func (a *AverageTracker) AddCycleTime(name string, time time.Duration) {
-	if _, ok := a.items[name]; !ok {
-		a.items[name] = &timeTracker{
-			totalTime: 0,
-			totalCount: 0,
+// resetAt returns when the tracker was created or last reset entirely
+func (a *AverageTracker) resetAt() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&a.resetAtNanos))
+}
+
+func (a *AverageTracker) overflowItem() *trackedItem {
+	return a.overflow.Load().(*trackedItem)
+}
+
+func (a *AverageTracker) item(name string) *trackedItem {
+	if item, ok := a.items.Load(name); ok {
+		return item.(*trackedItem)
+	}
+
+	// reserve a place for the new item before creating it so concurrent callers can never exceed the limit
+	for {
+		count := atomic.LoadInt64(&a.itemCount)
+		if count >= a.maxItems {
+			return a.overflowItem()
 		}
+		if atomic.CompareAndSwapInt64(&a.itemCount, count, count+1) {
+			break
+		}
+	}
+	item, loaded := a.items.LoadOrStore(name, newTrackedItem(a.resetAt()))
+	if loaded {
+		// another caller created the same item first, give back the reservation
+		atomic.AddInt64(&a.itemCount, -1)
 	}
+	return item.(*trackedItem)
+}
 
-	a.items[name].totalCount++
-	a.items[name].totalTime += time
+// rangeItems calls fn for every tracked item, including the overflow item if anything has been folded into it
+func (a *AverageTracker) rangeItems(fn func(name string, item *trackedItem)) {
+	a.items.Range(func(key, value interface{}) bool {
+		fn(key.(string), value.(*trackedItem))
+		return true
+	})
+	fn(OverflowName, a.overflowItem())
 }
 
-// GetAverages returns a list of averages for all items currently tracked
+// Reset discards everything recorded for the named item, returning false if the item is not being tracked. Rates
+// for the item are measured from the time of the reset
+func (a *AverageTracker) Reset(name string) bool {
+	a.resetLock.Lock()
+	defer a.resetLock.Unlock()
+
+	now := a.clock.Now()
+	if name == OverflowName {
+		a.overflow.Store(newTrackedItem(now))
+		return true
+	}
+	if _, ok := a.items.Load(name); !ok {
+		return false
+	}
+	a.items.Store(name, newTrackedItem(now))
+	return true
+}
+
+// ResetAll discards everything recorded for every item, as if the tracker had just been created
+func (a *AverageTracker) ResetAll() {
+	a.resetLock.Lock()
+	defer a.resetLock.Unlock()
+
+	now := a.clock.Now()
+	atomic.StoreInt64(&a.resetAtNanos, now.UnixNano())
+	a.items.Range(func(key, value interface{}) bool {
+		a.items.Delete(key)
+		atomic.AddInt64(&a.itemCount, -1)
+		return true
+	})
+	a.overflow.Store(newTrackedItem(now))
+}
+
+// AddCycleTime will add one instance having taken the provided duration for the named item
+func (a *AverageTracker) AddCycleTime(name string, time time.Duration) {
+	item := a.item(name)
+	item.lifetime.Record(time)
+	item.recent.record(a.clock.Now(), time, nil)
+}
+
+// AddResponse will add one instance having taken the provided duration for the named item, additionally tracking the
+// status code and number of bytes of the response
+func (a *AverageTracker) AddResponse(name string, time time.Duration, status int, bytes int64) {
+	item := a.item(name)
+	item.lifetime.Record(time)
+	item.responses.record(status, bytes)
+	item.recent.record(a.clock.Now(), time, func(responses *responseCounts) {
+		responses.record(status, bytes)
+	})
+}
+
+// AddPanic counts a panic for the named item. The response sent in its place is recorded separately with AddResponse
+func (a *AverageTracker) AddPanic(name string) {
+	item := a.item(name)
+	item.responses.recordPanic()
+	item.recent.recordResponse(a.clock.Now(), func(responses *responseCounts) {
+		responses.recordPanic()
+	})
+}
+
+// GetAverages returns a list of averages for all items over the lifetime of the tracker, sorted by name. The
+// figures for each item are consistent with one another
 func (a *AverageTracker) GetAverages() []Average {
-	avgs := make([]Average, len(a.items))
-	i := 0
-	for name, tracker := range a.items {
-		avgs[i] = Average{
-			Name:        name,
-			Total: tracker.totalCount,
-			AvgMicroSec: int64(tracker.totalTime / time.Microsecond / time.Duration(tracker.totalCount) ),
-		}
-		i++
+	now := a.clock.Now()
+	return a.collect(func(item *trackedItem) (itemSnapshot, time.Duration) {
+		snap := itemSnapshot{latency: item.lifetime.Snapshot(), responses: item.responses.snapshot()}
+		return snap, now.Sub(item.since)
+	})
+}
+
+// GetWindowAverages returns a list of averages for all items over the given window of time leading up to now, sorted
+// by name. The window must be one of SupportedWindows. Items with nothing recorded during the window are omitted
+func (a *AverageTracker) GetWindowAverages(window time.Duration) ([]Average, error) {
+	if err := validateWindow(window); err != nil {
+		return nil, err
 	}
+
+	now := a.clock.Now()
+	return a.collect(func(item *trackedItem) (itemSnapshot, time.Duration) {
+		return item.recent.snapshot(now, window), windowCoverage(now, window, item.since)
+	}), nil
+}
+
+// GetSnapshots returns a snapshot of the lifetime histogram for every tracked item, keyed by name
+func (a *AverageTracker) GetSnapshots() map[string]HistogramSnapshot {
+	snapshots := make(map[string]HistogramSnapshot)
+	a.rangeItems(func(name string, item *trackedItem) {
+		if snap := item.lifetime.Snapshot(); snap.Count > 0 {
+			snapshots[name] = snap
+		}
+	})
+	return snapshots
+}
+
+// collect builds averages for every item from the snapshot and elapsed time returned for it by snapshot
+func (a *AverageTracker) collect(snapshot func(item *trackedItem) (itemSnapshot, time.Duration)) []Average {
+	avgs := make([]Average, 0)
+	a.rangeItems(func(name string, item *trackedItem) {
+		snap, elapsed := snapshot(item)
+		if snap.latency.Count == 0 {
+			// nothing recorded in the requested period
+			return
+		}
+		avgs = append(avgs, averageFromSnapshot(name, snap, elapsed))
+	})
+	sort.Slice(avgs, func(i, j int) bool {
+		return avgs[i].Name < avgs[j].Name
+	})
 	return avgs
-}
\ No newline at end of file
+}
+
+func averageFromSnapshot(name string, item itemSnapshot, elapsed time.Duration) Average {
+	snap := item.latency
+	perSecond := 0.0
+	if elapsed > 0 {
+		perSecond = float64(snap.Count) / elapsed.Seconds()
+	}
+	return Average{
+		Name:           name,
+		Total:          int(snap.Count),
+		AvgMicroSec:    int64(snap.Mean() / time.Microsecond),
+		MinMicroSec:    int64(snap.Min / time.Microsecond),
+		MaxMicroSec:    int64(snap.Max / time.Microsecond),
+		StdDevMicroSec: int64(snap.StdDev() / time.Microsecond),
+		P50MicroSec:    int64(snap.Percentile(50) / time.Microsecond),
+		P90MicroSec:    int64(snap.Percentile(90) / time.Microsecond),
+		P99MicroSec:    int64(snap.Percentile(99) / time.Microsecond),
+		P999MicroSec:   int64(snap.Percentile(99.9) / time.Microsecond),
+		PerSecond:      perSecond,
+		StatusClasses:  item.responses.ClassCounts(),
+		ErrorRate:      item.responses.ErrorRate(),
+		Bytes:          int64(item.responses.Bytes),
+		Panics:         int(item.responses.Panics),
+	}
+}
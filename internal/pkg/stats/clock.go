@@ -0,0 +1,9 @@
+package stats
+
+import "github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/clock"
+
+// Clock is a source of the current time. Time-dependent stats take a Clock so they can be tested deterministically
+type Clock = clock.Clock
+
+// SystemClock is a Clock backed by the system's wall clock
+var SystemClock = clock.System
@@ -0,0 +1,136 @@
+package stats
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// ExportFormat is a file format that a Report can be written in
+type ExportFormat string
+
+const (
+	// JSONFormat writes a Report as a single JSON object
+	JSONFormat ExportFormat = "json"
+	// CSVFormat writes a Report as a header row followed by one row per average
+	CSVFormat ExportFormat = "csv"
+)
+
+// reportTimeFormat is used both in CSV rows and in report file names, so it avoids characters that are awkward in
+// file names
+const reportTimeFormat = "20060102T150405.000Z"
+
+// csvHeader lists the columns of a CSV report
+var csvHeader = []string{
+	"taken", "name", "total", "average", "min", "max", "stdDev", "p50", "p90", "p99", "p999", "perSecond",
+	"errorRate", "bytes", "1xx", "2xx", "3xx", "4xx", "5xx", "other", "panics",
+}
+
+// Report is a timestamped copy of every lifetime average kept by an AverageTracker
+type Report struct {
+	Taken    time.Time `json:"taken"`
+	Averages []Average `json:"averages"`
+}
+
+// Report returns a timestamped copy of every lifetime average currently tracked
+func (a *AverageTracker) Report() Report {
+	return Report{
+		Taken:    a.clock.Now(),
+		Averages: a.GetAverages(),
+	}
+}
+
+// ParseExportFormat returns the ExportFormat with the given name, or an error if there is no such format
+func ParseExportFormat(name string) (ExportFormat, error) {
+	switch ExportFormat(name) {
+	case JSONFormat, CSVFormat:
+		return ExportFormat(name), nil
+	}
+	return "", fmt.Errorf("unsupported export format '%v', must be '%v' or '%v'", name, JSONFormat, CSVFormat)
+}
+
+// Write writes the report to the given writer in the given format
+func (r Report) Write(w io.Writer, format ExportFormat) error {
+	switch format {
+	case JSONFormat:
+		return json.NewEncoder(w).Encode(r)
+	case CSVFormat:
+		return r.writeCSV(w)
+	}
+	return fmt.Errorf("unsupported export format '%v'", format)
+}
+
+func (r Report) writeCSV(w io.Writer) error {
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write(csvHeader); err != nil {
+		return err
+	}
+
+	taken := r.Taken.UTC().Format(reportTimeFormat)
+	for _, avg := range r.Averages {
+		row := []string{
+			taken,
+			avg.Name,
+			strconv.Itoa(avg.Total),
+			strconv.FormatInt(avg.AvgMicroSec, 10),
+			strconv.FormatInt(avg.MinMicroSec, 10),
+			strconv.FormatInt(avg.MaxMicroSec, 10),
+			strconv.FormatInt(avg.StdDevMicroSec, 10),
+			strconv.FormatInt(avg.P50MicroSec, 10),
+			strconv.FormatInt(avg.P90MicroSec, 10),
+			strconv.FormatInt(avg.P99MicroSec, 10),
+			strconv.FormatInt(avg.P999MicroSec, 10),
+			strconv.FormatFloat(avg.PerSecond, 'f', -1, 64),
+			strconv.FormatFloat(avg.ErrorRate, 'f', -1, 64),
+			strconv.FormatInt(avg.Bytes, 10),
+		}
+		for _, class := range []string{"1xx", "2xx", "3xx", "4xx", "5xx", "other"} {
+			row = append(row, strconv.Itoa(avg.StatusClasses[class]))
+		}
+		row = append(row, strconv.Itoa(avg.Panics))
+		if err := csvWriter.Write(row); err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// maxReportsPerName bounds how many reports taken at the same time can be written to one directory
+const maxReportsPerName = 1000
+
+// WriteFile writes the report into the given directory in the given format, naming the file after the time the
+// report was taken. Existing files are never overwritten, so a report taken in the same millisecond as one already
+// written gets a sequence number after the time. The path of the new file is returned
+func (r Report) WriteFile(dir string, format ExportFormat) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	taken := r.Taken.UTC().Format(reportTimeFormat)
+	path := filepath.Join(dir, fmt.Sprintf("stats-%s.%s", taken, format))
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	for sequence := 1; os.IsExist(err) && sequence < maxReportsPerName; sequence++ {
+		path = filepath.Join(dir, fmt.Sprintf("stats-%s-%d.%s", taken, sequence, format))
+		file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	err = r.Write(file, format)
+	closeErr := file.Close()
+	if err != nil {
+		return "", err
+	}
+	if closeErr != nil {
+		return "", closeErr
+	}
+	return path, nil
+}
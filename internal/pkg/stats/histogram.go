@@ -0,0 +1,326 @@
+package stats
+
+import (
+	"math"
+	"math/bits"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// histogramPrecision controls the precision of a Histogram. Each power of two range is split into
+	// 2^histogramPrecision linear buckets, bounding the relative error of any reported percentile to
+	// 1/2^histogramPrecision
+	histogramPrecision = 4
+
+	// maxValueBits bounds the largest value a histogram tracks individually, anything larger is recorded in
+	// the final bucket. Values are recorded in microseconds, so 2^32 covers a little over an hour
+	maxValueBits = 32
+
+	// countMask masks off the hot index bit of Histogram.countAndHotIdx, leaving the observation count
+	countMask = 1<<63 - 1
+)
+
+// Histogram is a log-linear bucketed histogram of durations. It is safe for concurrent use, and recording never
+// takes a lock.
+//
+// Writers always record into a "hot" set of counts, while a snapshot flips which set is hot and then waits for
+// in-flight writers to finish with the now "cold" set before reading it. This keeps writers lock-free while still
+// giving readers a consistent view of every figure in the histogram
+type Histogram struct {
+	// countAndHotIdx holds the number of observations started in the lower 63 bits and the index of the hot counts
+	// in the top bit. It is first in the struct to guarantee 64-bit alignment for atomic operations
+	countAndHotIdx uint64
+	counts         [2]*histogramCounts
+
+	// snapshotLock serializes readers only, writers never touch it
+	snapshotLock sync.Mutex
+}
+
+type histogramCounts struct {
+	// count is incremented last by writers, so once it matches the number of observations started, every
+	// observation recorded into this set is complete
+	count          uint64
+	totalNanos     int64
+	minNanos       int64
+	maxNanos       int64
+	sumSquaresBits uint64 // float64 bits of the sum of squared microseconds
+	buckets        []uint64
+}
+
+// HistogramSnapshot is a point in time copy of a Histogram. Unlike a Histogram, it is not safe for concurrent use
+type HistogramSnapshot struct {
+	Count      uint64
+	Total      time.Duration
+	Min        time.Duration
+	Max        time.Duration
+	sumSquares float64
+	precision  uint
+	buckets    []uint64
+}
+
+// NewHistogram returns a new, empty Histogram
+func NewHistogram() *Histogram {
+	return &Histogram{
+		counts: [2]*histogramCounts{
+			newHistogramCounts(histogramPrecision),
+			newHistogramCounts(histogramPrecision),
+		},
+	}
+}
+
+// newHistogramCounts returns empty counts with enough buckets for the given precision. The number of buckets is
+// fixed, keeping memory constant no matter how much is recorded
+func newHistogramCounts(precision uint) *histogramCounts {
+	return &histogramCounts{
+		minNanos: math.MaxInt64,
+		buckets:  make([]uint64, bucketCount(precision)),
+	}
+}
+
+// Record adds one observation of the given duration to the histogram
+func (h *Histogram) Record(duration time.Duration) {
+	if duration < 0 {
+		duration = 0
+	}
+	n := atomic.AddUint64(&h.countAndHotIdx, 1)
+	h.counts[n>>63].record(duration, histogramPrecision)
+}
+
+// record adds one observation to the counts, incrementing count last
+func (c *histogramCounts) record(duration time.Duration, precision uint) {
+	micros := float64(duration) / float64(time.Microsecond)
+	atomic.AddUint64(&c.buckets[bucketIndex(duration, precision)], 1)
+	atomic.AddInt64(&c.totalNanos, int64(duration))
+	storeMin(&c.minNanos, int64(duration))
+	storeMax(&c.maxNanos, int64(duration))
+	addFloat(&c.sumSquaresBits, micros*micros)
+	atomic.AddUint64(&c.count, 1)
+}
+
+// snapshot copies the counts. Observations still being recorded may be partially included, so callers needing a
+// consistent view must make sure no writers are active
+func (c *histogramCounts) snapshot(precision uint) HistogramSnapshot {
+	snap := HistogramSnapshot{
+		Count:      atomic.LoadUint64(&c.count),
+		Total:      time.Duration(atomic.LoadInt64(&c.totalNanos)),
+		Min:        time.Duration(atomic.LoadInt64(&c.minNanos)),
+		Max:        time.Duration(atomic.LoadInt64(&c.maxNanos)),
+		sumSquares: math.Float64frombits(atomic.LoadUint64(&c.sumSquaresBits)),
+		precision:  precision,
+		buckets:    make([]uint64, len(c.buckets)),
+	}
+	for i := range c.buckets {
+		snap.buckets[i] = atomic.LoadUint64(&c.buckets[i])
+	}
+	if snap.Count == 0 {
+		snap.Min = 0
+	}
+	return snap
+}
+
+// Snapshot returns a consistent copy of everything recorded so far
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.snapshotLock.Lock()
+	defer h.snapshotLock.Unlock()
+
+	// flip the hot bit so new observations go to the other set of counts
+	n := atomic.AddUint64(&h.countAndHotIdx, 1<<63)
+	count := n & countMask
+	hot := h.counts[n>>63]
+	cold := h.counts[(^n)>>63]
+
+	// wait for any writers still recording into the cold counts to finish
+	for atomic.LoadUint64(&cold.count) != count {
+		runtime.Gosched()
+	}
+
+	snap := cold.snapshot(histogramPrecision)
+
+	// fold the cold counts into the hot counts so the next snapshot sees everything, leaving cold empty
+	for i := range cold.buckets {
+		if snap.buckets[i] > 0 {
+			atomic.AddUint64(&hot.buckets[i], snap.buckets[i])
+			atomic.StoreUint64(&cold.buckets[i], 0)
+		}
+	}
+	atomic.AddInt64(&hot.totalNanos, int64(snap.Total))
+	storeMin(&hot.minNanos, atomic.LoadInt64(&cold.minNanos))
+	storeMax(&hot.maxNanos, int64(snap.Max))
+	addFloat(&hot.sumSquaresBits, snap.sumSquares)
+	atomic.AddUint64(&hot.count, count)
+
+	atomic.StoreInt64(&cold.totalNanos, 0)
+	atomic.StoreInt64(&cold.minNanos, math.MaxInt64)
+	atomic.StoreInt64(&cold.maxNanos, 0)
+	atomic.StoreUint64(&cold.sumSquaresBits, 0)
+	atomic.StoreUint64(&cold.count, 0)
+
+	return snap
+}
+
+// Merge returns a snapshot combining this snapshot with another of the same precision
+func (s HistogramSnapshot) Merge(other HistogramSnapshot) HistogramSnapshot {
+	if s.Count == 0 {
+		return other
+	}
+	if other.Count == 0 {
+		return s
+	}
+
+	merged := HistogramSnapshot{
+		Count:      s.Count + other.Count,
+		Total:      s.Total + other.Total,
+		Min:        s.Min,
+		Max:        s.Max,
+		sumSquares: s.sumSquares + other.sumSquares,
+		precision:  s.precision,
+		buckets:    make([]uint64, len(s.buckets)),
+	}
+	if other.Min < merged.Min {
+		merged.Min = other.Min
+	}
+	if other.Max > merged.Max {
+		merged.Max = other.Max
+	}
+	for i := range merged.buckets {
+		merged.buckets[i] = s.buckets[i] + other.buckets[i]
+	}
+	return merged
+}
+
+// Mean returns the average of all recorded observations
+func (s HistogramSnapshot) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// StdDev returns the population standard deviation of all recorded observations
+func (s HistogramSnapshot) StdDev() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	meanMicros := float64(s.Total) / float64(time.Microsecond) / float64(s.Count)
+	variance := s.sumSquares/float64(s.Count) - meanMicros*meanMicros
+	if variance < 0 {
+		// floating point error when every observation is (nearly) identical
+		variance = 0
+	}
+	return time.Duration(math.Sqrt(variance) * float64(time.Microsecond))
+}
+
+// Percentile returns an estimate of the given percentile, where percentile is in the range [0, 100]. The estimate is
+// the midpoint of the bucket containing the percentile, clamped to the observed min and max
+func (s HistogramSnapshot) Percentile(percentile float64) time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(percentile / 100 * float64(s.Count)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen uint64
+	for i, bucket := range s.buckets {
+		seen += bucket
+		if seen >= rank {
+			lower, upper := bucketBounds(i, s.precision)
+			estimate := (lower + upper) / 2
+			if estimate < s.Min {
+				return s.Min
+			}
+			if estimate > s.Max {
+				return s.Max
+			}
+			return estimate
+		}
+	}
+	return s.Max
+}
+
+// CountAtOrBelow returns an estimate of how many observations were no larger than the given duration. Only buckets
+// that lie entirely at or below the duration are counted, so the estimate never overcounts
+func (s HistogramSnapshot) CountAtOrBelow(duration time.Duration) uint64 {
+	if duration >= s.Max {
+		return s.Count
+	}
+
+	var count uint64
+	for i, bucket := range s.buckets {
+		if _, upper := bucketBounds(i, s.precision); upper > duration {
+			break
+		}
+		count += bucket
+	}
+	return count
+}
+
+// bucketCount returns the number of buckets needed at the given precision
+func bucketCount(precision uint) int {
+	subBuckets := 1 << precision
+	return subBuckets + (maxValueBits-int(precision))*subBuckets
+}
+
+// bucketIndex returns the index of the bucket that the given duration falls in at the given precision
+func bucketIndex(duration time.Duration, precision uint) int {
+	subBuckets := uint64(1) << precision
+	micros := uint64(duration / time.Microsecond)
+	if micros < subBuckets {
+		return int(micros)
+	}
+
+	exponent := bits.Len64(micros) - 1
+	if exponent >= maxValueBits {
+		return bucketCount(precision) - 1
+	}
+	shift := uint(exponent) - precision
+	sub := (micros >> shift) & (subBuckets - 1)
+	return int(subBuckets + uint64(shift)*subBuckets + sub)
+}
+
+// bucketBounds returns the smallest and largest durations that fall in the given bucket at the given precision
+func bucketBounds(index int, precision uint) (time.Duration, time.Duration) {
+	subBuckets := 1 << precision
+	if index < subBuckets {
+		lower := time.Duration(index) * time.Microsecond
+		return lower, lower + time.Microsecond - 1
+	}
+
+	shift := uint((index - subBuckets) / subBuckets)
+	sub := uint64((index - subBuckets) % subBuckets)
+	lower := (uint64(subBuckets) + sub) << shift
+	width := uint64(1) << shift
+	return time.Duration(lower) * time.Microsecond, time.Duration(lower+width)*time.Microsecond - 1
+}
+
+func storeMin(addr *int64, value int64) {
+	for {
+		current := atomic.LoadInt64(addr)
+		if value >= current || atomic.CompareAndSwapInt64(addr, current, value) {
+			return
+		}
+	}
+}
+
+func storeMax(addr *int64, value int64) {
+	for {
+		current := atomic.LoadInt64(addr)
+		if value <= current || atomic.CompareAndSwapInt64(addr, current, value) {
+			return
+		}
+	}
+}
+
+func addFloat(addr *uint64, delta float64) {
+	for {
+		current := atomic.LoadUint64(addr)
+		next := math.Float64bits(math.Float64frombits(current) + delta)
+		if atomic.CompareAndSwapUint64(addr, current, next) {
+			return
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package stats
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// statusClassCount covers the 1xx through 5xx status classes, with index 0 collecting anything outside that range
+const statusClassCount = 6
+
+// responseCounts tallies the status classes and bytes of responses for a single item
+type responseCounts struct {
+	bytes   uint64
+	panics  uint64
+	classes [statusClassCount]uint64
+}
+
+// ResponseSnapshot is a point in time copy of the responses recorded for an item
+type ResponseSnapshot struct {
+	Bytes   uint64
+	Panics  uint64                   // responses whose handler panicked
+	Classes [statusClassCount]uint64 // index 2 holds the count of 2xx responses, and so on
+}
+
+func statusClass(status int) int {
+	class := status / 100
+	if class < 1 || class >= statusClassCount {
+		return 0
+	}
+	return class
+}
+
+func (c *responseCounts) record(status int, bytes int64) {
+	atomic.AddUint64(&c.classes[statusClass(status)], 1)
+	if bytes > 0 {
+		atomic.AddUint64(&c.bytes, uint64(bytes))
+	}
+}
+
+func (c *responseCounts) recordPanic() {
+	atomic.AddUint64(&c.panics, 1)
+}
+
+func (c *responseCounts) snapshot() ResponseSnapshot {
+	snap := ResponseSnapshot{Bytes: atomic.LoadUint64(&c.bytes), Panics: atomic.LoadUint64(&c.panics)}
+	for i := range c.classes {
+		snap.Classes[i] = atomic.LoadUint64(&c.classes[i])
+	}
+	return snap
+}
+
+// Merge returns a snapshot combining this snapshot with another
+func (s ResponseSnapshot) Merge(other ResponseSnapshot) ResponseSnapshot {
+	merged := ResponseSnapshot{Bytes: s.Bytes + other.Bytes, Panics: s.Panics + other.Panics}
+	for i := range merged.Classes {
+		merged.Classes[i] = s.Classes[i] + other.Classes[i]
+	}
+	return merged
+}
+
+// Total returns the number of responses recorded
+func (s ResponseSnapshot) Total() uint64 {
+	var total uint64
+	for _, count := range s.Classes {
+		total += count
+	}
+	return total
+}
+
+// ErrorRate returns the fraction of responses that were client or server errors (4xx or 5xx)
+func (s ResponseSnapshot) ErrorRate() float64 {
+	total := s.Total()
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Classes[4]+s.Classes[5]) / float64(total)
+}
+
+// ClassCounts returns the number of responses per status class, keyed as "2xx", "4xx" and so on. Responses with a
+// status outside the 1xx-5xx range are keyed as "other"
+func (s ResponseSnapshot) ClassCounts() map[string]int {
+	counts := make(map[string]int)
+	for class, count := range s.Classes {
+		if count == 0 {
+			continue
+		}
+		if class == 0 {
+			counts["other"] = int(count)
+		} else {
+			counts[fmt.Sprintf("%dxx", class)] = int(count)
+		}
+	}
+	return counts
+}
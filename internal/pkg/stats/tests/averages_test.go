@@ -1,8 +1,10 @@
 package tests
 
 import (
+	"fmt"
 	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/stats"
 	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/test"
+	"sync"
 	"testing"
 	"time"
 )
@@ -18,5 +20,184 @@ func TestAverages(t *testing.T) {
 		test.AssertEqual(t, allAverages[0].Name, "test", "correct name")
 		test.AssertEqual(t, allAverages[0].Total, 2, "correct call count")
 		test.AssertEqual(t, allAverages[0].AvgMicroSec, int64(200), "200 micro average")
+		test.AssertEqual(t, allAverages[0].MinMicroSec, int64(100), "100 micro min")
+		test.AssertEqual(t, allAverages[0].MaxMicroSec, int64(300), "300 micro max")
+		test.AssertEqual(t, allAverages[0].StdDevMicroSec, int64(100), "100 micro std dev")
+	})
+}
+
+func TestCardinality(t *testing.T) {
+	t.Run("names beyond the limit overflow", func(t *testing.T) {
+		avgr := stats.NewAverageTrackerWithLimit(stats.SystemClock, 2)
+		avgr.AddCycleTime("a", time.Millisecond)
+		avgr.AddCycleTime("b", time.Millisecond)
+		avgr.AddCycleTime("c", time.Millisecond)
+		avgr.AddCycleTime("d", time.Millisecond)
+		avgr.AddCycleTime("a", time.Millisecond)
+
+		allAverages := avgr.GetAverages()
+		test.AssertEqual(t, len(allAverages), 3, "two names plus overflow")
+		test.AssertEqual(t, allAverages[0].Name, "a", "first name kept")
+		test.AssertEqual(t, allAverages[0].Total, 2, "existing names still recorded")
+		test.AssertEqual(t, allAverages[2].Name, stats.OverflowName, "overflow reported")
+		test.AssertEqual(t, allAverages[2].Total, 2, "new names folded into overflow")
+	})
+
+	t.Run("concurrent new names respect the limit", func(t *testing.T) {
+		avgr := stats.NewAverageTrackerWithLimit(stats.SystemClock, 10)
+		var wg sync.WaitGroup
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					avgr.AddCycleTime(fmt.Sprintf("%d-%d", w, i), time.Millisecond)
+				}
+			}(w)
+		}
+		wg.Wait()
+
+		allAverages := avgr.GetAverages()
+		test.AssertEqual(t, len(allAverages), 11, "ten names plus overflow")
+		total := 0
+		for _, avg := range allAverages {
+			total += avg.Total
+		}
+		test.AssertEqual(t, total, 800, "nothing lost to overflow")
+	})
+}
+
+func TestReset(t *testing.T) {
+	t.Run("reset single item", func(t *testing.T) {
+		clock := newManualClock()
+		avgr := stats.NewAverageTrackerWithClock(clock)
+		avgr.AddCycleTime("a", time.Millisecond)
+		avgr.AddCycleTime("b", time.Millisecond)
+		clock.Advance(time.Minute)
+
+		test.AssertEqual(t, avgr.Reset("a"), true, "tracked item reset")
+		test.AssertEqual(t, avgr.Reset("c"), false, "untracked item not reset")
+		avgr.AddCycleTime("a", time.Millisecond)
+		clock.Advance(time.Second)
+
+		allAverages := avgr.GetAverages()
+		test.AssertEqual(t, allAverages[0].Total, 1, "reset item starts over")
+		test.AssertEqual(t, allAverages[0].PerSecond, 1.0, "rate measured from reset")
+		test.AssertEqual(t, allAverages[1].Total, 1, "other item untouched")
+	})
+
+	t.Run("reset everything", func(t *testing.T) {
+		avgr := stats.NewAverageTrackerWithLimit(stats.SystemClock, 1)
+		avgr.AddCycleTime("a", time.Millisecond)
+		avgr.AddCycleTime("b", time.Millisecond)
+		avgr.ResetAll()
+
+		test.AssertEqual(t, len(avgr.GetAverages()), 0, "nothing tracked after reset")
+
+		avgr.AddCycleTime("b", time.Millisecond)
+		allAverages := avgr.GetAverages()
+		test.AssertEqual(t, allAverages[0].Name, "b", "limit applies afresh after reset")
+	})
+}
+
+func TestResponses(t *testing.T) {
+	t.Run("status classes and error rate", func(t *testing.T) {
+		avgr := stats.NewAverageTracker()
+		avgr.AddResponse("test", time.Millisecond, 201, 10)
+		avgr.AddResponse("test", time.Millisecond, 200, 20)
+		avgr.AddResponse("test", time.Millisecond, 400, 5)
+		avgr.AddResponse("test", time.Millisecond, 503, 0)
+
+		allAverages := avgr.GetAverages()
+		test.AssertEqual(t, allAverages[0].StatusClasses["2xx"], 2, "two successes")
+		test.AssertEqual(t, allAverages[0].StatusClasses["4xx"], 1, "one client error")
+		test.AssertEqual(t, allAverages[0].StatusClasses["5xx"], 1, "one server error")
+		test.AssertEqual(t, len(allAverages[0].StatusClasses), 3, "empty classes omitted")
+		test.AssertEqual(t, allAverages[0].ErrorRate, 0.5, "half the responses were errors")
+		test.AssertEqual(t, allAverages[0].Bytes, int64(35), "bytes summed")
+	})
+
+	t.Run("cycle times have no status", func(t *testing.T) {
+		avgr := stats.NewAverageTracker()
+		avgr.AddCycleTime("test", time.Millisecond)
+
+		allAverages := avgr.GetAverages()
+		test.AssertEqual(t, len(allAverages[0].StatusClasses), 0, "no statuses recorded")
+		test.AssertEqual(t, allAverages[0].ErrorRate, 0.0, "no errors")
+	})
+
+	t.Run("panics counted", func(t *testing.T) {
+		clock := newManualClock()
+		avgr := stats.NewAverageTrackerWithClock(clock)
+		avgr.AddResponse("test", time.Millisecond, 500, 0)
+		avgr.AddPanic("test")
+		clock.Advance(2 * time.Minute)
+		avgr.AddResponse("test", time.Millisecond, 200, 0)
+
+		test.AssertEqual(t, avgr.GetAverages()[0].Panics, 1, "lifetime panic counted")
+		windowAverages, err := avgr.GetWindowAverages(time.Minute)
+		test.AssertNil(t, err, "window supported")
+		test.AssertEqual(t, windowAverages[0].Panics, 0, "old panic outside the window")
+	})
+
+	t.Run("windowed status classes", func(t *testing.T) {
+		clock := newManualClock()
+		avgr := stats.NewAverageTrackerWithClock(clock)
+		avgr.AddResponse("test", time.Millisecond, 500, 0)
+		clock.Advance(2 * time.Minute)
+		avgr.AddResponse("test", time.Millisecond, 200, 0)
+
+		lastMinute, err := avgr.GetWindowAverages(time.Minute)
+		test.AssertNil(t, err, "1m is supported")
+		test.AssertEqual(t, lastMinute[0].StatusClasses["5xx"], 0, "old error outside window")
+		test.AssertEqual(t, lastMinute[0].ErrorRate, 0.0, "no recent errors")
+
+		lastFive, err := avgr.GetWindowAverages(5 * time.Minute)
+		test.AssertNil(t, err, "5m is supported")
+		test.AssertEqual(t, lastFive[0].ErrorRate, 0.5, "old error inside window")
+	})
+}
+
+func TestConcurrentAverages(t *testing.T) {
+	t.Run("concurrent recording and reading", func(t *testing.T) {
+		avgr := stats.NewAverageTracker()
+		writers := 8
+		perWriter := 1000
+
+		var wg sync.WaitGroup
+		done := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					for _, avg := range avgr.GetAverages() {
+						if avg.AvgMicroSec != 10 {
+							t.Error("snapshot count and total out of sync")
+							return
+						}
+					}
+				}
+			}
+		}()
+
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < perWriter; i++ {
+					avgr.AddCycleTime(fmt.Sprintf("test%d", w%2), 10*time.Microsecond)
+				}
+			}(w)
+		}
+		wg.Wait()
+		close(done)
+
+		allAverages := avgr.GetAverages()
+		test.AssertEqual(t, len(allAverages), 2, "two items being averaged")
+		test.AssertEqual(t, allAverages[0].Name, "test0", "sorted by name")
+		test.AssertEqual(t, allAverages[0].Total+allAverages[1].Total, writers*perWriter, "no observations lost")
+		test.AssertEqual(t, allAverages[1].AvgMicroSec, int64(10), "10 micro average")
 	})
 }
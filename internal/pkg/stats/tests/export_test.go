@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/stats"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/test"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExport(t *testing.T) {
+	t.Run("json report", func(t *testing.T) {
+		avgr := stats.NewAverageTrackerWithClock(newManualClock())
+		avgr.AddResponse("test", 100*time.Microsecond, 200, 10)
+
+		buf := &bytes.Buffer{}
+		err := avgr.Report().Write(buf, stats.JSONFormat)
+		test.AssertNil(t, err, "write should not error")
+
+		report := stats.Report{}
+		err = json.Unmarshal(buf.Bytes(), &report)
+		test.AssertNil(t, err, "report should be valid json")
+		test.AssertEqual(t, report.Taken.Equal(time.Unix(1600000000, 0)), true, "report timestamped by clock")
+		test.AssertEqual(t, report.Averages[0].Name, "test", "average included")
+	})
+
+	t.Run("csv report", func(t *testing.T) {
+		avgr := stats.NewAverageTrackerWithClock(newManualClock())
+		avgr.AddResponse("test", 100*time.Microsecond, 404, 10)
+
+		buf := &bytes.Buffer{}
+		err := avgr.Report().Write(buf, stats.CSVFormat)
+		test.AssertNil(t, err, "write should not error")
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		test.AssertEqual(t, len(lines), 2, "header and one row")
+		test.AssertEqual(t, strings.HasPrefix(lines[0], "taken,name,total,average"), true, "header row")
+		test.AssertEqual(t, lines[1], "20200913T122640.000Z,test,1,100,100,100,0,100,100,100,100,0,1,10,0,0,0,1,0,0,0", "data row")
+	})
+
+	t.Run("unknown format rejected", func(t *testing.T) {
+		_, err := stats.ParseExportFormat("xml")
+		test.AssertNotNil(t, err, "xml not supported")
+
+		format, err := stats.ParseExportFormat("csv")
+		test.AssertNil(t, err, "csv supported")
+		test.AssertEqual(t, format, stats.CSVFormat, "csv parsed")
+	})
+
+	t.Run("report written to timestamped file", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "stats")
+		test.AssertNil(t, err, "temp dir should be created")
+		defer os.RemoveAll(dir)
+
+		avgr := stats.NewAverageTrackerWithClock(newManualClock())
+		path, err := avgr.Report().WriteFile(dir, stats.CSVFormat)
+		test.AssertNil(t, err, "write should not error")
+		test.AssertEqual(t, path, filepath.Join(dir, "stats-20200913T122640.000Z.csv"), "file named by time taken")
+
+		path, err = avgr.Report().WriteFile(dir, stats.CSVFormat)
+		test.AssertNil(t, err, "report taken at the same time still written")
+		test.AssertEqual(t, path, filepath.Join(dir, "stats-20200913T122640.000Z-1.csv"), "existing snapshot never overwritten")
+	})
+}
@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/stats"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/test"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	t.Run("empty histogram", func(t *testing.T) {
+		snap := stats.NewHistogram().Snapshot()
+		test.AssertEqual(t, snap.Count, uint64(0), "nothing recorded")
+		test.AssertEqual(t, snap.Min, time.Duration(0), "zero min")
+		test.AssertEqual(t, snap.Percentile(99), time.Duration(0), "zero percentile")
+		test.AssertEqual(t, snap.StdDev(), time.Duration(0), "zero std dev")
+	})
+
+	t.Run("min, max and mean", func(t *testing.T) {
+		hist := stats.NewHistogram()
+		hist.Record(300 * time.Microsecond)
+		hist.Record(100 * time.Microsecond)
+		hist.Record(200 * time.Microsecond)
+
+		snap := hist.Snapshot()
+		test.AssertEqual(t, snap.Count, uint64(3), "three recorded")
+		test.AssertEqual(t, snap.Min, 100*time.Microsecond, "correct min")
+		test.AssertEqual(t, snap.Max, 300*time.Microsecond, "correct max")
+		test.AssertEqual(t, snap.Mean(), 200*time.Microsecond, "correct mean")
+	})
+
+	t.Run("percentiles within bucket precision", func(t *testing.T) {
+		hist := stats.NewHistogram()
+		for i := 1; i <= 1000; i++ {
+			hist.Record(time.Duration(i) * time.Microsecond)
+		}
+
+		snap := hist.Snapshot()
+		assertWithin(t, snap.Percentile(50), 500*time.Microsecond, "p50")
+		assertWithin(t, snap.Percentile(90), 900*time.Microsecond, "p90")
+		assertWithin(t, snap.Percentile(99), 990*time.Microsecond, "p99")
+		assertWithin(t, snap.Percentile(99.9), 999*time.Microsecond, "p999")
+		assertWithin(t, snap.StdDev(), 288675*time.Nanosecond, "std dev of uniform distribution")
+	})
+
+	t.Run("snapshots are cumulative", func(t *testing.T) {
+		hist := stats.NewHistogram()
+		hist.Record(time.Millisecond)
+		hist.Snapshot()
+		hist.Record(3 * time.Millisecond)
+
+		snap := hist.Snapshot()
+		test.AssertEqual(t, snap.Count, uint64(2), "both observations kept")
+		test.AssertEqual(t, snap.Min, time.Millisecond, "min kept across snapshots")
+		test.AssertEqual(t, snap.Mean(), 2*time.Millisecond, "mean across snapshots")
+	})
+
+	t.Run("huge durations are bounded", func(t *testing.T) {
+		hist := stats.NewHistogram()
+		hist.Record(24 * time.Hour)
+
+		snap := hist.Snapshot()
+		test.AssertEqual(t, snap.Percentile(50), 24*time.Hour, "clamped to observed max")
+	})
+}
+
+// assertWithin fails the test if value is not within the histogram's relative error of expected
+func assertWithin(t *testing.T, value time.Duration, expected time.Duration, message string) {
+	tolerance := expected / 16
+	if value >= expected-tolerance && value <= expected+tolerance {
+		return
+	}
+	t.Fatalf("%v not within %v of %v: %s", value, tolerance, expected, message)
+}
@@ -0,0 +1,53 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/stats"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/test"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTopK(t *testing.T) {
+	t.Run("counts sorted most frequent first", func(t *testing.T) {
+		topK := stats.NewTopK(5)
+		topK.Add("a")
+		topK.Add("b")
+		topK.Add("b")
+
+		top := topK.Top()
+		test.AssertEqual(t, len(top), 2, "two names seen")
+		test.AssertEqual(t, top[0], stats.Count{Name: "b", Count: 2}, "most frequent first")
+		test.AssertEqual(t, top[1], stats.Count{Name: "a", Count: 1}, "least frequent last")
+	})
+
+	t.Run("capacity bounds names kept", func(t *testing.T) {
+		topK := stats.NewTopK(3)
+		for i := 0; i < 50; i++ {
+			topK.Add("frequent")
+			topK.Add(fmt.Sprintf("scan%d", i))
+		}
+
+		top := topK.Top()
+		test.AssertEqual(t, len(top), 3, "never more than capacity")
+		test.AssertEqual(t, top[0].Name, "frequent", "frequent name survives a scan")
+		test.AssertEqual(t, top[0].Count, 50, "frequent name never evicted")
+	})
+
+	t.Run("long names truncated", func(t *testing.T) {
+		topK := stats.NewTopK(1)
+		topK.Add(strings.Repeat("a", 1000))
+
+		test.AssertEqual(t, len(topK.Top()[0].Name), 256, "name truncated")
+	})
+
+	t.Run("long names truncated on a rune boundary", func(t *testing.T) {
+		topK := stats.NewTopK(1)
+		topK.Add("a" + strings.Repeat("é", 500))
+
+		name := topK.Top()[0].Name
+		test.AssertEqual(t, len(name), 255, "name cut before the rune crossing the limit")
+		test.AssertEqual(t, utf8.ValidString(name), true, "name still valid utf-8")
+	})
+}
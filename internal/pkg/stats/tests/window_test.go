@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/stats"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/test"
+	"testing"
+	"time"
+)
+
+// newManualClock returns a fake clock that only moves when told to
+func newManualClock() *test.FakeClock {
+	return test.NewFakeClock(time.Unix(1600000000, 0))
+}
+
+func TestWindows(t *testing.T) {
+	t.Run("unsupported window rejected", func(t *testing.T) {
+		avgr := stats.NewAverageTrackerWithClock(newManualClock())
+		_, err := avgr.GetWindowAverages(2 * time.Minute)
+		test.AssertNotNil(t, err, "2m is not a supported window")
+	})
+
+	t.Run("old observations fall out of window", func(t *testing.T) {
+		clock := newManualClock()
+		avgr := stats.NewAverageTrackerWithClock(clock)
+		avgr.AddCycleTime("test", 100*time.Microsecond)
+		clock.Advance(2 * time.Minute)
+		avgr.AddCycleTime("test", 300*time.Microsecond)
+
+		lastMinute, err := avgr.GetWindowAverages(time.Minute)
+		test.AssertNil(t, err, "1m is supported")
+		test.AssertEqual(t, len(lastMinute), 1, "one item in window")
+		test.AssertEqual(t, lastMinute[0].Total, 1, "only the recent call counted")
+		test.AssertEqual(t, lastMinute[0].AvgMicroSec, int64(300), "average of recent call only")
+
+		lastFive, err := avgr.GetWindowAverages(5 * time.Minute)
+		test.AssertNil(t, err, "5m is supported")
+		test.AssertEqual(t, lastFive[0].Total, 2, "both calls counted")
+		test.AssertEqual(t, lastFive[0].AvgMicroSec, int64(200), "average of both calls")
+
+		lifetime := avgr.GetAverages()
+		test.AssertEqual(t, lifetime[0].Total, 2, "lifetime keeps everything")
+	})
+
+	t.Run("idle items omitted from window", func(t *testing.T) {
+		clock := newManualClock()
+		avgr := stats.NewAverageTrackerWithClock(clock)
+		avgr.AddCycleTime("test", time.Millisecond)
+		clock.Advance(20 * time.Minute)
+
+		window, err := avgr.GetWindowAverages(15 * time.Minute)
+		test.AssertNil(t, err, "15m is supported")
+		test.AssertEqual(t, len(window), 0, "nothing recent")
+	})
+
+	t.Run("slots reused after a full rotation", func(t *testing.T) {
+		clock := newManualClock()
+		avgr := stats.NewAverageTrackerWithClock(clock)
+		avgr.AddCycleTime("test", time.Millisecond)
+		clock.Advance(stats.MaxWindow)
+		avgr.AddCycleTime("test", time.Millisecond)
+
+		window, err := avgr.GetWindowAverages(time.Minute)
+		test.AssertNil(t, err, "1m is supported")
+		test.AssertEqual(t, window[0].Total, 1, "stale slot contents discarded")
+	})
+
+	t.Run("rates", func(t *testing.T) {
+		clock := newManualClock()
+		avgr := stats.NewAverageTrackerWithClock(clock)
+		clock.Advance(10 * time.Minute)
+		for i := 0; i < 120; i++ {
+			avgr.AddCycleTime("test", time.Millisecond)
+		}
+		// land on a 20 second slot boundary, where the newest slot has only just started and the window covers the
+		// full slots before it
+		clock.Advance(20*time.Second - time.Duration(clock.Now().UnixNano())%(20*time.Second))
+
+		lifetime := avgr.GetAverages()
+		test.AssertEqual(t, lifetime[0].PerSecond > 0.19 && lifetime[0].PerSecond < 0.2, true, "120 calls over ~10m")
+
+		lastFive, err := avgr.GetWindowAverages(5 * time.Minute)
+		test.AssertNil(t, err, "5m is supported")
+		test.AssertEqual(t, lastFive[0].PerSecond, 120/(5*time.Minute-20*time.Second).Seconds(), "120 calls over the covered window")
+	})
+}
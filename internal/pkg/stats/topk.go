@@ -0,0 +1,90 @@
+package stats
+
+import (
+	"sort"
+	"sync"
+	"unicode/utf8"
+)
+
+// maxTopKNameLength bounds the length of names kept by a TopK, as they are often taken straight from user input
+const maxTopKNameLength = 256
+
+// Count is a name and how many times it has been seen
+type Count struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// TopK approximates the most frequently seen names using the Space-Saving algorithm. At most capacity names are
+// kept; when a new name arrives and the TopK is full, it replaces the least frequent name and inherits its count.
+// Counts are therefore upper bounds, but any name seen more often than 1/capacity of the time is guaranteed to be kept
+type TopK struct {
+	capacity int
+	counts   map[string]int
+	lock     sync.Mutex
+}
+
+// NewTopK returns a new TopK keeping at most capacity names
+func NewTopK(capacity int) *TopK {
+	return &TopK{
+		capacity: capacity,
+		counts:   make(map[string]int),
+	}
+}
+
+// Add records one occurrence of the given name
+func (t *TopK) Add(name string) {
+	if t.capacity <= 0 {
+		return
+	}
+	if len(name) > maxTopKNameLength {
+		// cut before any rune straddling the limit so a multi-byte character isn't left half written
+		cut := maxTopKNameLength
+		for cut > 0 && !utf8.RuneStart(name[cut]) {
+			cut--
+		}
+		name = name[:cut]
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, ok := t.counts[name]; ok || len(t.counts) < t.capacity {
+		t.counts[name]++
+		return
+	}
+
+	minName, minCount := "", 0
+	for existing, count := range t.counts {
+		if minName == "" || count < minCount {
+			minName, minCount = existing, count
+		}
+	}
+	delete(t.counts, minName)
+	t.counts[name] = minCount + 1
+}
+
+// Top returns every name currently kept, most frequent first
+func (t *TopK) Top() []Count {
+	t.lock.Lock()
+	top := make([]Count, 0, len(t.counts))
+	for name, count := range t.counts {
+		top = append(top, Count{Name: name, Count: count})
+	}
+	t.lock.Unlock()
+
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Name < top[j].Name
+	})
+	return top
+}
+
+// Reset forgets every name seen so far
+func (t *TopK) Reset() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.counts = make(map[string]int)
+}
@@ -0,0 +1,119 @@
+package stats
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+const (
+	// windowSlotWidth is the span of time covered by a single slot of a rollingHistogram. Windows slide forward one
+	// slot at a time, so this is also the granularity of every window
+	windowSlotWidth = 20 * time.Second
+
+	// windowPrecision is the precision of the histograms kept per slot. It is coarser than a lifetime Histogram to
+	// keep memory for every slot of every tracked name small
+	windowPrecision = 2
+
+	// MaxWindow is the largest window that windowed stats can be requested for
+	MaxWindow = 15 * time.Minute
+
+	windowSlotCount = int(MaxWindow / windowSlotWidth)
+)
+
+// SupportedWindows lists the windows that windowed stats can be requested for
+var SupportedWindows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// rollingHistogram keeps a ring of coarse histograms, one per windowSlotWidth of time, covering the last MaxWindow.
+// Slots are replaced as time moves on rather than cleared, so recording never takes a lock
+type rollingHistogram struct {
+	slots [windowSlotCount]unsafe.Pointer // *windowSlot
+}
+
+type windowSlot struct {
+	// responses is first in the struct to guarantee 64-bit alignment for atomic operations
+	responses responseCounts
+	epoch     int64 // number of windowSlotWidths since the unix epoch that this slot covers
+	counts    *histogramCounts
+}
+
+func slotEpoch(now time.Time) int64 {
+	return now.UnixNano() / int64(windowSlotWidth)
+}
+
+// record adds an observation to the slot covering now. If given, recordResponse is also called with the slot's
+// response counts
+func (r *rollingHistogram) record(now time.Time, duration time.Duration, recordResponse func(*responseCounts)) {
+	slot := r.slotFor(slotEpoch(now))
+	slot.counts.record(duration, windowPrecision)
+	if recordResponse != nil {
+		recordResponse(&slot.responses)
+	}
+}
+
+// recordResponse calls recordResponse with the response counts of the slot covering now, without recording a latency
+func (r *rollingHistogram) recordResponse(now time.Time, recordResponse func(*responseCounts)) {
+	recordResponse(&r.slotFor(slotEpoch(now)).responses)
+}
+
+// slotFor returns the slot for the given epoch, rotating out whatever slot previously occupied its place in the ring
+func (r *rollingHistogram) slotFor(epoch int64) *windowSlot {
+	ptr := &r.slots[epoch%int64(windowSlotCount)]
+	for {
+		current := atomic.LoadPointer(ptr)
+		slot := (*windowSlot)(current)
+		if slot != nil && slot.epoch >= epoch {
+			// a slot newer than this observation only happens if the observation is a full window late, in which
+			// case it is close enough to count it in the newer slot
+			return slot
+		}
+
+		fresh := &windowSlot{epoch: epoch, counts: newHistogramCounts(windowPrecision)}
+		if atomic.CompareAndSwapPointer(ptr, current, unsafe.Pointer(fresh)) {
+			return fresh
+		}
+		// another writer rotated the slot first, try again with theirs
+	}
+}
+
+// snapshot merges every slot that falls within the window ending at now. Observations still being recorded may be
+// partially included
+func (r *rollingHistogram) snapshot(now time.Time, window time.Duration) itemSnapshot {
+	newest := slotEpoch(now)
+	oldest := newest - int64(window/windowSlotWidth) + 1
+
+	merged := itemSnapshot{
+		latency: HistogramSnapshot{precision: windowPrecision, buckets: make([]uint64, bucketCount(windowPrecision))},
+	}
+	for i := range r.slots {
+		slot := (*windowSlot)(atomic.LoadPointer(&r.slots[i]))
+		if slot == nil || slot.epoch < oldest || slot.epoch > newest {
+			continue
+		}
+		merged.latency = merged.latency.Merge(slot.counts.snapshot(windowPrecision))
+		merged.responses = merged.responses.Merge(slot.responses.snapshot())
+	}
+	return merged
+}
+
+// validateWindow returns an error if the given window is not one of the SupportedWindows
+func validateWindow(window time.Duration) error {
+	for _, supported := range SupportedWindows {
+		if window == supported {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported window '%v', must be one of %v", window, SupportedWindows)
+}
+
+// windowCoverage returns how much time the window ending at now actually covers. The newest slot is only partially
+// elapsed, and nothing was recorded before the tracker started
+func windowCoverage(now time.Time, window time.Duration, started time.Time) time.Duration {
+	elapsedInSlot := time.Duration(now.UnixNano() % int64(windowSlotWidth))
+	coverage := window - windowSlotWidth + elapsedInSlot
+	if sinceStart := now.Sub(started); sinceStart < coverage {
+		coverage = sinceStart
+	}
+	return coverage
+}
@@ -0,0 +1,79 @@
+package test
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock is a clock.Clock whose time only moves when the test advances it, so anything waiting on it can be
+// released without sleeping. It is safe for concurrent use
+type FakeClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	until time.Time
+	ch    chan time.Time
+}
+
+// NewFakeClock returns a FakeClock reading the given time until it is advanced
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the clock's current time
+func (c *FakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+// Since returns the time passed on the clock since t
+func (c *FakeClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// After returns a channel that receives the clock's time once it has been advanced by at least d
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{until: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward, releasing everything waiting until then
+func (c *FakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+	waiting := c.waiters[:0]
+	for _, waiter := range c.waiters {
+		if waiter.until.After(c.now) {
+			waiting = append(waiting, waiter)
+		} else {
+			waiter.ch <- c.now
+		}
+	}
+	c.waiters = waiting
+}
+
+// BlockUntil waits until at least n callers are waiting on the clock, so a test only advances it once everything it
+// expects to release is waiting. Waits are started by goroutines, which would otherwise race the test
+func (c *FakeClock) BlockUntil(n int) {
+	for {
+		c.lock.Lock()
+		waiting := len(c.waiters)
+		c.lock.Unlock()
+		if waiting >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,28 @@
+package test
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// serverStartTimeout is how long WaitForServer will wait for a server to begin listening
+const serverStartTimeout = 2 * time.Second
+
+// WaitForServer blocks until something is accepting connections on the given local port, failing the test if
+// nothing starts listening before the timeout. Servers are generally started in a goroutine by tests, so this
+// avoids racing the listener
+func WaitForServer(t *testing.T, port int) {
+	deadline := time.Now().Add(serverStartTimeout)
+	for time.Now().Before(deadline) {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal(fmt.Sprintf("server on port %d did not start within %v", port, serverStartTimeout))
+}
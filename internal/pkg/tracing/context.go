@@ -0,0 +1,123 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TraceparentHeader is the W3C Trace Context header carrying the caller's span
+const TraceparentHeader = "traceparent"
+
+// traceparentVersion is the only version of the traceparent header this package writes
+const traceparentVersion = "00"
+
+// sampledFlag is the trace flag bit marking a trace as sampled
+const sampledFlag = 0x01
+
+// TraceID identifies a whole trace
+type TraceID [16]byte
+
+// SpanID identifies a single span within a trace
+type SpanID [8]byte
+
+// String returns the lowercase hex form of the ID
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// IsValid returns false for the all zero ID, which the W3C spec reserves as invalid
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+// String returns the lowercase hex form of the ID
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// IsValid returns false for the all zero ID, which the W3C spec reserves as invalid
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// SpanContext is the part of a span that is propagated to other spans and services
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid returns true if both IDs are valid
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent returns the span context formatted as a W3C traceparent header value
+func (sc SpanContext) Traceparent() string {
+	flags := 0
+	if sc.Sampled {
+		flags |= sampledFlag
+	}
+	return fmt.Sprintf("%s-%s-%s-%02x", traceparentVersion, sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent parses a W3C traceparent header value. Versions above 00 are accepted as long as they start with
+// the fields defined by version 00, as the spec requires
+func ParseTraceparent(value string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return SpanContext{}, errors.New("traceparent must have four fields")
+	}
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || len(version) != 1 || version[0] == 0xff {
+		return SpanContext{}, fmt.Errorf("invalid traceparent version '%v'", parts[0])
+	}
+	if version[0] == 0 && len(parts) != 4 {
+		return SpanContext{}, errors.New("version 00 traceparent must have exactly four fields")
+	}
+
+	sc := SpanContext{}
+	if err := decodeHex(parts[1], sc.TraceID[:]); err != nil || !sc.TraceID.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid trace id '%v'", parts[1])
+	}
+	if err := decodeHex(parts[2], sc.SpanID[:]); err != nil || !sc.SpanID.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid parent id '%v'", parts[2])
+	}
+	flags := make([]byte, 1)
+	if err := decodeHex(parts[3], flags); err != nil {
+		return SpanContext{}, fmt.Errorf("invalid trace flags '%v'", parts[3])
+	}
+	sc.Sampled = flags[0]&sampledFlag != 0
+	return sc, nil
+}
+
+// decodeHex decodes lowercase hex of exactly the destination's length
+func decodeHex(value string, dst []byte) error {
+	if len(value) != hex.EncodedLen(len(dst)) || strings.ToLower(value) != value {
+		return errors.New("wrong length or case")
+	}
+	_, err := hex.Decode(dst, []byte(value))
+	return err
+}
+
+func newTraceID() TraceID {
+	id := TraceID{}
+	randomFill(id[:])
+	return id
+}
+
+func newSpanID() SpanID {
+	id := SpanID{}
+	randomFill(id[:])
+	return id
+}
+
+func randomFill(bytes []byte) {
+	if _, err := rand.Read(bytes); err != nil {
+		// crypto/rand only fails if the OS has no source of randomness, in which case there is nothing better to do
+		panic(err)
+	}
+}
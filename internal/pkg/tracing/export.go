@@ -0,0 +1,188 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// scopeName names this package as the instrumentation scope of every exported span
+const scopeName = "github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/tracing"
+
+// Exporter sends finished spans somewhere they can be viewed
+type Exporter interface {
+	Export(service string, spans []SpanData) error
+}
+
+// WriterExporter writes each batch of spans as a single line of OTLP JSON, the same body an OTLP/HTTP collector
+// accepts on /v1/traces
+type WriterExporter struct {
+	out  io.Writer
+	lock sync.Mutex
+}
+
+// NewWriterExporter returns a WriterExporter writing to out, typically a file
+func NewWriterExporter(out io.Writer) *WriterExporter {
+	return &WriterExporter{out: out}
+}
+
+// Export writes the spans
+func (w *WriterExporter) Export(service string, spans []SpanData) error {
+	body, err := json.Marshal(NewOTLPRequest(service, spans))
+	if err != nil {
+		return err
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	_, err = w.out.Write(append(body, '\n'))
+	return err
+}
+
+// HTTPExporter posts each batch of spans as OTLP JSON to a collector, such as http://localhost:4318/v1/traces
+type HTTPExporter struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewHTTPExporter returns an HTTPExporter posting to the given collector URL
+func NewHTTPExporter(endpoint string) *HTTPExporter {
+	return &HTTPExporter{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Export posts the spans, returning an error if the collector does not accept them
+func (h *HTTPExporter) Export(service string, spans []SpanData) error {
+	body, err := json.Marshal(NewOTLPRequest(service, spans))
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.client.Post(h.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("collector at %v rejected spans with status %v", h.endpoint, resp.StatusCode)
+	}
+	return nil
+}
+
+// OTLPRequest is the JSON encoding of an OTLP ExportTraceServiceRequest
+type OTLPRequest struct {
+	ResourceSpans []OTLPResourceSpans `json:"resourceSpans"`
+}
+
+// OTLPResourceSpans groups the spans of a single service
+type OTLPResourceSpans struct {
+	Resource   OTLPResource     `json:"resource"`
+	ScopeSpans []OTLPScopeSpans `json:"scopeSpans"`
+}
+
+// OTLPResource describes the service that produced the spans
+type OTLPResource struct {
+	Attributes []OTLPAttribute `json:"attributes"`
+}
+
+// OTLPScopeSpans groups the spans produced by a single instrumentation scope
+type OTLPScopeSpans struct {
+	Scope OTLPScope  `json:"scope"`
+	Spans []OTLPSpan `json:"spans"`
+}
+
+// OTLPScope names the instrumentation that produced the spans
+type OTLPScope struct {
+	Name string `json:"name"`
+}
+
+// OTLPSpan is a single span. IDs are hex and times are nanoseconds since the epoch as a string, as the OTLP JSON
+// encoding requires
+type OTLPSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              Kind            `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []OTLPAttribute `json:"attributes,omitempty"`
+	Status            OTLPStatus      `json:"status"`
+}
+
+// OTLPStatus is the outcome of a span
+type OTLPStatus struct {
+	Code    StatusCode `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+// OTLPAttribute is a key and a typed value
+type OTLPAttribute struct {
+	Key   string    `json:"key"`
+	Value OTLPValue `json:"value"`
+}
+
+// OTLPValue holds exactly one of its fields. Integers are strings, as the OTLP JSON encoding requires
+type OTLPValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// NewOTLPRequest encodes the spans as an OTLP request from the given service
+func NewOTLPRequest(service string, spans []SpanData) OTLPRequest {
+	otlpSpans := make([]OTLPSpan, len(spans))
+	for i, span := range spans {
+		otlpSpans[i] = OTLPSpan{
+			TraceID:           span.Context.TraceID.String(),
+			SpanID:            span.Context.SpanID.String(),
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(span.Attributes),
+			Status:            OTLPStatus{Code: span.Status, Message: span.StatusMessage},
+		}
+		if span.Parent.IsValid() {
+			otlpSpans[i].ParentSpanID = span.Parent.String()
+		}
+	}
+
+	return OTLPRequest{ResourceSpans: []OTLPResourceSpans{{
+		Resource:   OTLPResource{Attributes: otlpAttributes([]Attribute{String("service.name", service)})},
+		ScopeSpans: []OTLPScopeSpans{{Scope: OTLPScope{Name: scopeName}, Spans: otlpSpans}},
+	}}}
+}
+
+func otlpAttributes(attributes []Attribute) []OTLPAttribute {
+	otlp := make([]OTLPAttribute, 0, len(attributes))
+	for _, attribute := range attributes {
+		value := OTLPValue{}
+		switch v := attribute.Value.(type) {
+		case string:
+			value.StringValue = &v
+		case int64:
+			str := strconv.FormatInt(v, 10)
+			value.IntValue = &str
+		case bool:
+			value.BoolValue = &v
+		case float64:
+			value.DoubleValue = &v
+		default:
+			str := fmt.Sprint(v)
+			value.StringValue = &str
+		}
+		otlp = append(otlp, OTLPAttribute{Key: attribute.Key, Value: value})
+	}
+	return otlp
+}
@@ -0,0 +1,153 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Kind describes the relationship of a span to the work around it, using the OTLP numbering
+type Kind int
+
+const (
+	// KindInternal is work done within the service
+	KindInternal Kind = 1
+	// KindServer is the handling of a request from a remote caller
+	KindServer Kind = 2
+)
+
+// StatusCode is the outcome of a span, using the OTLP numbering
+type StatusCode int
+
+const (
+	// StatusUnset is the default status of a span
+	StatusUnset StatusCode = 0
+	// StatusOK marks a span as explicitly successful
+	StatusOK StatusCode = 1
+	// StatusError marks a span as failed
+	StatusError StatusCode = 2
+)
+
+// Attribute is a key/value pair describing a span
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string attribute
+func String(key string, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an integer attribute
+func Int(key string, value int64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Bool returns a boolean attribute
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// SpanData is the immutable record of a finished span, as handed to an Exporter
+type SpanData struct {
+	Name          string
+	Kind          Kind
+	Context       SpanContext
+	Parent        SpanID
+	Start         time.Time
+	End           time.Time
+	Attributes    []Attribute
+	Status        StatusCode
+	StatusMessage string
+}
+
+// Span is a single timed operation within a trace. A nil Span is valid and does nothing, which is what a nil Tracer
+// hands out, so instrumented code never needs to check whether tracing is enabled
+type Span struct {
+	tracer    *Tracer
+	recording bool
+	data      SpanData
+	ended     bool
+	lock      sync.Mutex
+}
+
+type contextKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying the given span, making it the parent of spans started from ctx
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKey{}, span.Context())
+}
+
+// ContextWithParent returns a copy of ctx carrying a span context from elsewhere, such as an incoming traceparent
+// header or a request that has since finished, making it the parent of spans started from ctx
+func ContextWithParent(ctx context.Context, parent SpanContext) context.Context {
+	if !parent.IsValid() {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKey{}, parent)
+}
+
+// SpanContextFromContext returns the span context of the parent carried by ctx, which is invalid if there is none
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(contextKey{}).(SpanContext)
+	return sc
+}
+
+// Context returns the span's propagated context
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.Context
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attributes ...Attribute) {
+	if s == nil || !s.recording {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.data.Attributes = append(s.data.Attributes, attributes...)
+}
+
+// SetError marks the span as failed with the given message
+func (s *Span) SetError(message string) {
+	if s == nil || !s.recording {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.data.Status = StatusError
+	s.data.StatusMessage = message
+}
+
+// End finishes the span now
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.EndAt(s.tracer.now())
+}
+
+// EndAt finishes the span at the given time. Only the first call has any effect
+func (s *Span) EndAt(end time.Time) {
+	if s == nil || !s.recording {
+		return
+	}
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = end
+	data := s.data
+	s.lock.Unlock()
+
+	s.tracer.finish(data)
+}
@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/test"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/tracing"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const parentHeader = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestTraceparent(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		sc, err := tracing.ParseTraceparent(parentHeader)
+		test.AssertNil(t, err, "valid header parsed")
+		test.AssertEqual(t, sc.TraceID.String(), "4bf92f3577b34da6a3ce929d0e0e4736", "trace id parsed")
+		test.AssertEqual(t, sc.SpanID.String(), "00f067aa0ba902b7", "parent id parsed")
+		test.AssertEqual(t, sc.Sampled, true, "sampled flag parsed")
+		test.AssertEqual(t, sc.Traceparent(), parentHeader, "formats back to the same header")
+	})
+
+	t.Run("future versions accepted", func(t *testing.T) {
+		_, err := tracing.ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra")
+		test.AssertNil(t, err, "extra fields allowed after version 00")
+	})
+
+	t.Run("invalid headers rejected", func(t *testing.T) {
+		for _, header := range []string{
+			"",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+			"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+			"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+			"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		} {
+			_, err := tracing.ParseTraceparent(header)
+			test.AssertNotNil(t, err, "rejected: "+header)
+		}
+	})
+}
+
+func TestTracer(t *testing.T) {
+	t.Run("nil tracer does nothing", func(t *testing.T) {
+		var tracer *tracing.Tracer
+		ctx, span := tracer.Start(context.Background(), "work")
+		span.SetAttributes(tracing.String("key", "value"))
+		span.SetError("failed")
+		span.End()
+		test.AssertEqual(t, tracing.SpanContextFromContext(ctx).IsValid(), false, "no span carried")
+		test.AssertNil(t, tracer.Shutdown(), "shutdown is a no-op")
+	})
+
+	t.Run("children share the trace", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		tracer := tracing.NewTracer("svc", tracing.NewWriterExporter(out), logging.Discard())
+		parent, err := tracing.ParseTraceparent(parentHeader)
+		test.AssertNil(t, err, "valid header parsed")
+
+		ctx, server := tracer.StartServer(tracing.ContextWithParent(context.Background(), parent), "GET /hash/{id}")
+		_, child := tracer.Start(ctx, "lookup", tracing.Int("hash.id", 1))
+		child.SetError("not found")
+		child.End()
+		server.End()
+		test.AssertNil(t, tracer.Shutdown(), "spans exported")
+
+		request := tracing.OTLPRequest{}
+		err = json.Unmarshal(out.Bytes(), &request)
+		test.AssertNil(t, err, "export is valid json")
+		resource := request.ResourceSpans[0]
+		test.AssertEqual(t, resource.Resource.Attributes[0].Key, "service.name", "service named")
+		test.AssertEqual(t, *resource.Resource.Attributes[0].Value.StringValue, "svc", "service named")
+
+		spans := resource.ScopeSpans[0].Spans
+		test.AssertEqual(t, len(spans), 2, "both spans exported")
+		test.AssertEqual(t, spans[0].Name, "lookup", "child finished first")
+		test.AssertEqual(t, spans[0].TraceID, "4bf92f3577b34da6a3ce929d0e0e4736", "child continues trace")
+		test.AssertEqual(t, spans[0].ParentSpanID, spans[1].SpanID, "child of the server span")
+		test.AssertEqual(t, *spans[0].Attributes[0].Value.IntValue, "1", "int attributes are strings")
+		test.AssertEqual(t, spans[0].Status.Code, tracing.StatusError, "error status exported")
+		test.AssertEqual(t, spans[1].ParentSpanID, "00f067aa0ba902b7", "server span is a child of the caller")
+		test.AssertEqual(t, spans[1].Kind, tracing.KindServer, "server kind exported")
+	})
+
+	t.Run("unsampled traces not recorded", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		tracer := tracing.NewTracer("svc", tracing.NewWriterExporter(out), logging.Discard())
+		parent, _ := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+
+		_, span := tracer.Start(tracing.ContextWithParent(context.Background(), parent), "work")
+		span.End()
+		test.AssertEqual(t, span.Context().TraceID.String(), "4bf92f3577b34da6a3ce929d0e0e4736", "trace still propagated")
+		test.AssertNil(t, tracer.Shutdown(), "nothing to export")
+		test.AssertEqual(t, out.Len(), 0, "nothing written")
+	})
+
+	t.Run("http exporter posts to collector", func(t *testing.T) {
+		var body []byte
+		collector := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+			test.AssertEqual(t, req.Header.Get("Content-Type"), "application/json", "posted as json")
+			body, _ = ioutil.ReadAll(req.Body)
+		}))
+		defer collector.Close()
+
+		tracer := tracing.NewTracer("svc", tracing.NewHTTPExporter(collector.URL+"/v1/traces"), logging.Discard())
+		_, span := tracer.Start(context.Background(), "work")
+		span.End()
+		test.AssertNil(t, tracer.Shutdown(), "collector accepted spans")
+
+		request := tracing.OTLPRequest{}
+		err := json.Unmarshal(body, &request)
+		test.AssertNil(t, err, "collector received json")
+		test.AssertEqual(t, request.ResourceSpans[0].ScopeSpans[0].Spans[0].Name, "work", "span received")
+	})
+}
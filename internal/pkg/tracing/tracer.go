@@ -0,0 +1,157 @@
+package tracing
+
+import (
+	"context"
+	"github.com/MondayHopscotch/JumpCloudCodeChallenge/internal/pkg/logging"
+	"sync"
+	"time"
+)
+
+const (
+	// flushInterval is how often finished spans are handed to the exporter
+	flushInterval = 2 * time.Second
+	// maxPending bounds the number of finished spans held between exports. Spans finished while the buffer is full are
+	// dropped rather than letting a slow exporter grow memory without bound
+	maxPending = 4096
+)
+
+// Tracer starts spans and exports them in batches once they finish. A nil Tracer is valid and starts nil spans, so
+// tracing costs nothing when it is not configured
+type Tracer struct {
+	service  string
+	exporter Exporter
+	logger   *logging.Logger
+
+	pending []SpanData
+	dropped int
+	lock    sync.Mutex
+
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// NewTracer returns a Tracer naming the given service in exported spans, and starts exporting finished spans in the
+// background. Export failures are reported to the given logger
+func NewTracer(service string, exporter Exporter, logger *logging.Logger) *Tracer {
+	t := &Tracer{
+		service:  service,
+		exporter: exporter,
+		logger:   logger,
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go t.exportLoop()
+	return t
+}
+
+// Start starts a span for work done within the service, as a child of the span carried by ctx. The returned context
+// carries the new span
+func (t *Tracer) Start(ctx context.Context, name string, attributes ...Attribute) (context.Context, *Span) {
+	return t.start(ctx, name, KindInternal, t.now(), attributes)
+}
+
+// StartAt starts a span for work done within the service that began at the given time, such as time already spent
+// waiting in a queue
+func (t *Tracer) StartAt(ctx context.Context, name string, start time.Time, attributes ...Attribute) (context.Context, *Span) {
+	return t.start(ctx, name, KindInternal, start, attributes)
+}
+
+// StartServer starts a span for handling a request from a remote caller, as a child of the span carried by ctx
+func (t *Tracer) StartServer(ctx context.Context, name string, attributes ...Attribute) (context.Context, *Span) {
+	return t.start(ctx, name, KindServer, t.now(), attributes)
+}
+
+func (t *Tracer) start(ctx context.Context, name string, kind Kind, start time.Time, attributes []Attribute) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	parent := SpanContextFromContext(ctx)
+	sc := SpanContext{SpanID: newSpanID(), Sampled: true}
+	if parent.IsValid() {
+		// follow the caller's sampling decision so a trace is either recorded everywhere or nowhere
+		sc.TraceID = parent.TraceID
+		sc.Sampled = parent.Sampled
+	} else {
+		sc.TraceID = newTraceID()
+	}
+
+	span := &Span{
+		tracer:    t,
+		recording: sc.Sampled,
+		data: SpanData{
+			Name:       name,
+			Kind:       kind,
+			Context:    sc,
+			Parent:     parent.SpanID,
+			Start:      start,
+			Attributes: attributes,
+		},
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+func (t *Tracer) now() time.Time {
+	return time.Now()
+}
+
+func (t *Tracer) finish(data SpanData) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if len(t.pending) >= maxPending {
+		t.dropped++
+		return
+	}
+	t.pending = append(t.pending, data)
+}
+
+// Flush exports every finished span not yet exported
+func (t *Tracer) Flush() error {
+	if t == nil {
+		return nil
+	}
+
+	t.lock.Lock()
+	spans := t.pending
+	dropped := t.dropped
+	t.pending = nil
+	t.dropped = 0
+	t.lock.Unlock()
+
+	if dropped > 0 {
+		t.logger.Warn("spans dropped while waiting to be exported", logging.Int("count", dropped))
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	return t.exporter.Export(t.service, spans)
+}
+
+// Shutdown stops the background export and exports every remaining finished span
+func (t *Tracer) Shutdown() error {
+	if t == nil {
+		return nil
+	}
+	t.once.Do(func() {
+		close(t.stop)
+		<-t.stopped
+	})
+	return t.Flush()
+}
+
+func (t *Tracer) exportLoop() {
+	defer close(t.stopped)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := t.Flush(); err != nil {
+				t.logger.Warn("failed to export spans", logging.Err(err))
+			}
+		case <-t.stop:
+			return
+		}
+	}
+}